@@ -0,0 +1,542 @@
+package slim
+
+import (
+	"context"
+	"fmt"
+	"go/format"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// Field is the shape of the value which templates read.
+type Field struct {
+	Name string `json:"name,omitempty"`
+	// List is true if the value is iterated or indexed. The shape of the
+	// items is Elem.
+	List bool `json:"list,omitempty"`
+	// Method is true if the value is called as method.
+	Method bool `json:"method,omitempty"`
+	// Type is the Go type of the value inferred from the usage like the
+	// arguments of the helpers. It is empty if unknown.
+	Type   string   `json:"type,omitempty"`
+	Fields []*Field `json:"fields,omitempty"`
+	Elem   *Field   `json:"elem,omitempty"`
+}
+
+func (f *Field) child(name string) *Field {
+	for _, c := range f.Fields {
+		if c.Name == name {
+			return c
+		}
+	}
+	c := &Field{Name: name}
+	f.Fields = append(f.Fields, c)
+	return c
+}
+
+func (f *Field) elem() *Field {
+	f.List = true
+	if f.Elem == nil {
+		f.Elem = &Field{}
+	}
+	return f.Elem
+}
+
+func (f *Field) sort() {
+	sort.Slice(f.Fields, func(i, j int) bool {
+		return f.Fields[i].Name < f.Fields[j].Name
+	})
+	for _, c := range f.Fields {
+		c.sort()
+	}
+	if f.Elem != nil {
+		f.Elem.sort()
+	}
+}
+
+// Requirements is the shape of the data which templates read. It is
+// reported by Analyze without executing the templates.
+type Requirements struct {
+	Fields  []*Field `json:"fields"`
+	Helpers []string `json:"helpers"`
+}
+
+// Paths returns the paths of the values like "items[].title".
+func (r *Requirements) Paths() []string {
+	var paths []string
+	var walk func(prefix string, f *Field)
+	walk = func(prefix string, f *Field) {
+		if len(f.Fields) == 0 && f.Elem == nil {
+			paths = append(paths, prefix)
+		}
+		for _, c := range f.Fields {
+			walk(prefix+"."+c.Name, c)
+		}
+		if f.Elem != nil {
+			walk(prefix+"[]", f.Elem)
+		}
+	}
+	for _, f := range r.Fields {
+		walk(f.Name, f)
+	}
+	return paths
+}
+
+// GoStruct returns the Go struct definition named name which has the fields
+// of the requirements. The types of the values are interface{} because they
+// can't be inferred from the templates.
+func (r *Requirements) GoStruct(name string) string {
+	var sb strings.Builder
+	sb.WriteString("type " + name + " ")
+	writeStruct(&sb, r.Fields, 0)
+	sb.WriteString("\n")
+	b, err := format.Source([]byte(sb.String()))
+	if err != nil {
+		return sb.String()
+	}
+	return string(b)
+}
+
+func writeStruct(sb *strings.Builder, fields []*Field, indent int) {
+	sb.WriteString("struct {\n")
+	seen := map[string]bool{}
+	for _, f := range fields {
+		if f.Method {
+			continue
+		}
+		// the key which can't be a field is left as the comment.
+		name := exportedName(f.Name)
+		if name == "" {
+			sb.WriteString(strings.Repeat("\t", indent+1) + fmt.Sprintf("// %q is skipped: not a valid field name\n", f.Name))
+			continue
+		}
+		if seen[name] {
+			sb.WriteString(strings.Repeat("\t", indent+1) + fmt.Sprintf("// %q is skipped: %s is declared already\n", f.Name, name))
+			continue
+		}
+		seen[name] = true
+		sb.WriteString(strings.Repeat("\t", indent+1) + name + " ")
+		writeType(sb, f, indent+1)
+		sb.WriteString(fmt.Sprintf(" `json:%q`\n", f.Name))
+	}
+	sb.WriteString(strings.Repeat("\t", indent) + "}")
+}
+
+func writeType(sb *strings.Builder, f *Field, indent int) {
+	if f.List {
+		sb.WriteString("[]")
+		if f.Elem != nil {
+			writeType(sb, f.Elem, indent)
+			return
+		}
+	}
+	for _, c := range f.Fields {
+		if !c.Method {
+			writeStruct(sb, f.Fields, indent)
+			return
+		}
+	}
+	if f.Type != "" && len(f.Fields) == 0 {
+		sb.WriteString(f.Type)
+		return
+	}
+	// the methods can't be declared in the struct.
+	sb.WriteString("interface{}")
+}
+
+// exportedName returns the exported Go identifier for the key name. The
+// characters which can't be used in the identifier are dropped, and the
+// next one is upper-cased like "first-name" to "FirstName". It returns empty
+// string if nothing is left.
+func exportedName(name string) string {
+	var rs []rune
+	upper := true
+	for _, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		rs = append(rs, r)
+	}
+	if len(rs) == 0 {
+		return ""
+	}
+	if !unicode.IsUpper(rs[0]) {
+		rs = append([]rune{'X'}, rs...)
+	}
+	return string(rs)
+}
+
+// analyzer collect the requirements of the templates.
+type analyzer struct {
+	root    Field
+	helpers map[string]bool
+	visited map[*Template]bool
+}
+
+// Analyze walk the templates and the partials rendered by render(), and
+// report the shape of the data which they read.
+func Analyze(templates ...*Template) (*Requirements, error) {
+	a := &analyzer{
+		helpers: map[string]bool{},
+		visited: map[*Template]bool{},
+	}
+	for _, t := range templates {
+		if err := a.template(t); err != nil {
+			return nil, err
+		}
+	}
+	a.root.sort()
+	r := &Requirements{Fields: a.root.Fields, Helpers: []string{}}
+	for name := range a.helpers {
+		r.Helpers = append(r.Helpers, name)
+	}
+	sort.Strings(r.Helpers)
+	return r, nil
+}
+
+func (a *analyzer) template(t *Template) error {
+	if a.visited[t] {
+		return nil
+	}
+	a.visited[t] = true
+	if n := extendsNode(t.root); n != nil {
+		if err := a.partial(t, layoutName(n)); err != nil {
+			return err
+		}
+	}
+	return a.node(t, t.root, map[string]*Field{})
+}
+
+// scope is the local variables. nil means the variable is not the data
+// like the index of the loop.
+func (a *analyzer) node(t *Template, n *Node, scope map[string]*Field) error {
+	switch n.Name {
+	case "/", "/!":
+		return nil
+	case "mixin":
+		// the parameters of the mixin are not the data.
+		local := copyScope(scope)
+		if m := mixinPattern.FindStringSubmatch(strings.TrimSpace(n.Text)); m != nil {
+			if def, ok := t.mixins[m[1]]; ok {
+				for _, p := range def.params {
+					local[p] = nil
+				}
+			}
+		}
+		return a.children(t, n, local)
+	case "+":
+		expr, err := t.vm.Compile(n.Text)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		if e, ok := expr.(*vm.CallExpr); ok {
+			return a.exprs(t, e.Exprs, scope)
+		}
+		return nil
+	}
+	for _, attr := range n.Attr {
+		if attr.Name == "*" || isExprAttr(attr.Value) {
+			expr, err := t.vm.Compile(attrExpr(attr))
+			if err != nil {
+				return fmt.Errorf("line %d: %w", n.Line, err)
+			}
+			if _, err := a.expr(t, expr, scope); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := a.inline(t, attr.Value, scope); err != nil {
+			return err
+		}
+	}
+	if err := a.inline(t, n.Text, scope); err != nil {
+		return err
+	}
+	if n.Expr != "" {
+		expr, err := compileNode(t.vm, n)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		switch e := expr.(type) {
+		case *vm.ForExpr:
+			f, err := a.expr(t, e.RHS, scope)
+			if err != nil {
+				return err
+			}
+			local := copyScope(scope)
+			var el *Field
+			if f != nil {
+				el = f.elem()
+			}
+			if e.LHS2 != "" {
+				local[e.LHS1] = nil
+				local[e.LHS2] = el
+			} else {
+				local[e.LHS1] = el
+			}
+			if err := a.children(t, n, local); err != nil {
+				return err
+			}
+			return a.elseBlock(t, n, scope)
+		case *vm.DirectiveExpr:
+			if _, err := a.expr(t, e.RHS, scope); err != nil {
+				return err
+			}
+			// the directive bind the value for the following nodes.
+			scope[e.LHS] = nil
+		default:
+			if _, err := a.expr(t, expr, scope); err != nil {
+				return err
+			}
+		}
+	}
+	if err := a.children(t, n, copyScope(scope)); err != nil {
+		return err
+	}
+	return a.elseBlock(t, n, scope)
+}
+
+func (a *analyzer) elseBlock(t *Template, n *Node, scope map[string]*Field) error {
+	if n.Else == nil {
+		return nil
+	}
+	return a.children(t, n.Else, copyScope(scope))
+}
+
+func (a *analyzer) children(t *Template, n *Node, scope map[string]*Field) error {
+	for _, c := range n.Children {
+		if err := a.node(t, c, scope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyScope(scope map[string]*Field) map[string]*Field {
+	local := make(map[string]*Field, len(scope))
+	for k, v := range scope {
+		local[k] = v
+	}
+	return local
+}
+
+func (a *analyzer) inline(t *Template, s string, scope map[string]*Field) error {
+	for _, m := range rubyInlinePattern.FindAllString(s, -1) {
+		expr, err := t.vm.Compile(m[2 : len(m)-1])
+		if err != nil {
+			return err
+		}
+		if _, err := a.expr(t, expr, scope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *analyzer) isHelper(t *Template, name string) bool {
+	switch name {
+	case "render", "sanitize", "yield", "content_for":
+		return true
+	}
+	for key := range t.fm {
+		if key == name || strings.HasPrefix(key, name+".") {
+			return true
+		}
+	}
+	_, ok := vm.Default.Lookup(name)
+	return ok
+}
+
+// expr returns the field which the expression references. It returns nil if
+// the value is not the data.
+func (a *analyzer) expr(t *Template, expr vm.Expr, scope map[string]*Field) (*Field, error) {
+	switch e := expr.(type) {
+	case *vm.IdentExpr:
+		if f, ok := scope[e.Name]; ok {
+			return f, nil
+		}
+		if a.isHelper(t, e.Name) {
+			return nil, nil
+		}
+		return a.root.child(e.Name), nil
+	case *vm.MemberExpr:
+		f, err := a.expr(t, e.LHS, scope)
+		if f == nil || err != nil {
+			return nil, err
+		}
+		return f.child(e.Name), nil
+	case *vm.ItemExpr:
+		f, err := a.expr(t, e.LHS, scope)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := a.expr(t, e.Index, scope); err != nil {
+			return nil, err
+		}
+		if f == nil {
+			return nil, nil
+		}
+		if lit, ok := e.Index.(*vm.LitExpr); ok {
+			if s, ok := lit.Value.(string); ok {
+				return f.child(s), nil
+			}
+		}
+		return f.elem(), nil
+	case *vm.SliceExpr:
+		f, err := a.expr(t, e.LHS, scope)
+		if err != nil {
+			return nil, err
+		}
+		for _, x := range []vm.Expr{e.Low, e.High} {
+			if x == nil {
+				continue
+			}
+			if _, err := a.expr(t, x, scope); err != nil {
+				return nil, err
+			}
+		}
+		if f != nil {
+			f.elem()
+		}
+		return f, nil
+	case *vm.CallExpr:
+		if _, ok := scope[e.Name]; !ok {
+			a.helpers[e.Name] = true
+		}
+		args, err := a.fields(t, e.Exprs, scope)
+		if err != nil {
+			return nil, err
+		}
+		if f, ok := vm.Default.Lookup(e.Name); ok {
+			inferArgs(reflect.TypeOf(f), args)
+		}
+		if e.Name == "render" && len(e.Exprs) == 1 {
+			if lit, ok := e.Exprs[0].(*vm.LitExpr); ok {
+				if name, ok := lit.Value.(string); ok {
+					return nil, a.partial(t, name)
+				}
+			}
+		}
+		return nil, nil
+	case *vm.MethodCallExpr:
+		if err := a.exprs(t, e.Exprs, scope); err != nil {
+			return nil, err
+		}
+		if id, ok := e.LHS.(*vm.IdentExpr); ok {
+			if _, ok := scope[id.Name]; !ok && a.isHelper(t, id.Name) {
+				a.helpers[id.Name+"."+e.Name] = true
+				return nil, nil
+			}
+		}
+		f, err := a.expr(t, e.LHS, scope)
+		if f == nil || err != nil {
+			return nil, err
+		}
+		m := f.child(e.Name)
+		m.Method = true
+		return nil, nil
+	case *vm.BinOpExpr:
+		lhs, err := a.expr(t, e.LHS, scope)
+		if err != nil {
+			return nil, err
+		}
+		rhs, err := a.expr(t, e.RHS, scope)
+		if err != nil {
+			return nil, err
+		}
+		// the operand is same type as the literal. The operands of && and ||
+		// can be the different types.
+		if e.Op != "&&" && e.Op != "||" {
+			inferLit(lhs, e.RHS)
+			inferLit(rhs, e.LHS)
+		}
+		return nil, nil
+	case *vm.UnaryExpr:
+		return a.expr(t, e.Expr, scope)
+	case *vm.MapExpr:
+		return nil, a.exprs(t, e.Values, scope)
+	case *vm.ArrayExpr:
+		return nil, a.exprs(t, e.Exprs, scope)
+	case *vm.CondExpr:
+		return nil, a.exprs(t, []vm.Expr{e.Cond, e.Then, e.Else}, scope)
+	case *vm.DeadlineExpr:
+		return nil, a.exprs(t, []vm.Expr{e.Timeout}, scope)
+	case *vm.BreakExpr:
+		return a.expr(t, e.Cond, scope)
+	case *vm.ContinueExpr:
+		return a.expr(t, e.Cond, scope)
+	case *vm.AssertExpr:
+		return nil, a.exprs(t, []vm.Expr{e.Cond, e.Message}, scope)
+	}
+	return nil, nil
+}
+
+// inferLit set the type of the literal to f.
+func inferLit(f *Field, expr vm.Expr) {
+	lit, ok := expr.(*vm.LitExpr)
+	if !ok || f == nil || f.Type != "" || lit.Value == nil {
+		return
+	}
+	f.Type = reflect.TypeOf(lit.Value).String()
+}
+
+// inferArgs set the types of the parameters of the function to the fields
+// passed as the arguments.
+func inferArgs(rt reflect.Type, args []*Field) {
+	if rt.Kind() != reflect.Func {
+		return
+	}
+	offset := 0
+	if rt.NumIn() > 0 && rt.In(0) == reflect.TypeOf((*context.Context)(nil)).Elem() {
+		offset = 1
+	}
+	for i, f := range args {
+		n := i + offset
+		if n >= rt.NumIn() || (rt.IsVariadic() && n == rt.NumIn()-1) {
+			break
+		}
+		pt := rt.In(n)
+		if f == nil || f.Type != "" || len(f.Fields) > 0 || pt.Kind() == reflect.Interface {
+			continue
+		}
+		f.Type = pt.String()
+	}
+}
+
+func (a *analyzer) fields(t *Template, exprs []vm.Expr, scope map[string]*Field) ([]*Field, error) {
+	fields := make([]*Field, len(exprs))
+	for i, e := range exprs {
+		f, err := a.expr(t, e, scope)
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = f
+	}
+	return fields, nil
+}
+
+func (a *analyzer) exprs(t *Template, exprs []vm.Expr, scope map[string]*Field) error {
+	for _, e := range exprs {
+		if _, err := a.expr(t, e, scope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *analyzer) partial(t *Template, name string) error {
+	tt, err := t.lookupInner(context.Background(), name)
+	if err != nil {
+		return err
+	}
+	return a.template(tt)
+}
@@ -0,0 +1,158 @@
+package slim
+
+import (
+	"encoding/json"
+	"go/format"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+h1 = to_upper(user.name)
+a href="/users/#{user.id}" profile
+- for i, item in items
+  p = item.title + i
+  - for tag in item.tags
+    span = tag
+- memo total = stats.Count()
+p = total
+p = str.upcase(m["key"])
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.FuncMap(Funcs{"str.upcase": ToUpper})
+	r, err := Analyze(tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		"items[].tags[]",
+		"items[].title",
+		"m.key",
+		"stats.Count",
+		"user.id",
+		"user.name",
+	}
+	if got := r.Paths(); !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+	if expect := []string{"str.upcase", "to_upper"}; !reflect.DeepEqual(r.Helpers, expect) {
+		t.Fatalf("expected %v but %v", expect, r.Helpers)
+	}
+	if _, err := json.Marshal(r); err != nil {
+		t.Fatal(err)
+	}
+	expectStruct := "type View struct {\n" +
+		"\tItems []struct {\n" +
+		"\t\tTags  []interface{} `json:\"tags\"`\n" +
+		"\t\tTitle interface{}   `json:\"title\"`\n" +
+		"\t} `json:\"items\"`\n" +
+		"\tM struct {\n" +
+		"\t\tKey interface{} `json:\"key\"`\n" +
+		"\t} `json:\"m\"`\n" +
+		"\tStats interface{} `json:\"stats\"`\n" +
+		"\tUser  struct {\n" +
+		"\t\tId   interface{} `json:\"id\"`\n" +
+		"\t\tName interface{} `json:\"name\"`\n" +
+		"\t} `json:\"user\"`\n" +
+		"}\n"
+	if got := r.GoStruct("View"); got != expectStruct {
+		t.Fatalf("expected %v but %v", expectStruct, got)
+	}
+}
+
+func TestAnalyzePartial(t *testing.T) {
+	tmpl, err := ParseFile("testdata/test_render.slim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := Analyze(tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Paths()) == 0 {
+		t.Fatal("expected paths of the partial")
+	}
+}
+
+func TestAnalyzeTypes(t *testing.T) {
+	RegisterFunc1("test_analyze_len", func(s string) int { return len(s) })
+	tmpl, err := Parse(strings.NewReader(`
+p = test_analyze_len(name)
+p = price * 1.5
+p = count + 1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := Analyze(tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := map[string]string{}
+	for _, f := range r.Fields {
+		types[f.Name] = f.Type
+	}
+	expect := map[string]string{"name": "string", "price": "float64", "count": "int64"}
+	if !reflect.DeepEqual(types, expect) {
+		t.Fatalf("expected %v but %v", expect, types)
+	}
+}
+
+func TestAnalyzeMixin(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+mixin card(title)
+  h2 = title
+div
+  +card(page.title)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := Analyze(tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"page.title"}
+	if got := r.Paths(); !reflect.DeepEqual(expect, got) {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+}
+
+func TestAnalyzeKeys(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+p = m[""]
+p = m["first-name"]
+p = m["first_name"]
+p = m["first name"]
+p = m["1st"]
+p = m["-"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := Analyze(tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "type View struct {\n" +
+		"\tM struct {\n" +
+		"\t\t// \"\" is skipped: not a valid field name\n" +
+		"\t\t// \"-\" is skipped: not a valid field name\n" +
+		"\t\tX1st      interface{} `json:\"1st\"`\n" +
+		"\t\tFirstName interface{} `json:\"first name\"`\n" +
+		"\t\t// \"first-name\" is skipped: FirstName is declared already\n" +
+		"\t\tFirst_name interface{} `json:\"first_name\"`\n" +
+		"\t} `json:\"m\"`\n" +
+		"}\n"
+	got := r.GoStruct("View")
+	if got != expect {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+	if _, err := format.Source([]byte(got)); err != nil {
+		t.Fatalf("invalid Go code %v: %v", got, err)
+	}
+}
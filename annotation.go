@@ -0,0 +1,64 @@
+package slim
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// annotationPattern matches the annotations like `@deprecated "use _card2"`
+// in the front-matter, the lines before the first node of the template.
+var annotationPattern = regexp.MustCompile(`^@([A-Za-z_]\w*)(?:\s+(.*))?$`)
+
+// parseAnnotation returns the name and the value of the annotation in l.
+func parseAnnotation(l string) (string, string, bool) {
+	m := annotationPattern.FindStringSubmatch(strings.TrimSpace(l))
+	if m == nil {
+		return "", "", false
+	}
+	value := strings.TrimSpace(m[2])
+	if s, err := strconv.Unquote(value); err == nil {
+		value = s
+	}
+	return m[1], value, true
+}
+
+// Annotation returns the value of the annotation named name in the
+// front-matter of the template, like "use _card2" of
+// `@deprecated "use _card2"`.
+func (t *Template) Annotation(name string) (string, bool) {
+	value, ok := t.annotations[name]
+	return value, ok
+}
+
+// warnDeprecated warn that t renders tt which is annotated with @deprecated.
+// It is warned to the logger only once per template, and recorded to the
+// result of the rendering with ctx.
+func (t *Template) warnDeprecated(ctx context.Context, tt *Template) {
+	logger := t.top().logger
+	if logger == nil && resultOf(ctx) == nil {
+		return
+	}
+	message, ok := tt.Annotation("deprecated")
+	if !ok {
+		return
+	}
+	text := "template is deprecated: " + tt.name
+	if message != "" {
+		text += ": " + message
+	}
+	w := &Warning{
+		Template: t.name,
+		Name:     tt.name,
+		Message:  text,
+	}
+	recordWarning(ctx, w)
+	type deprecatedKey struct {
+		name string
+	}
+	if _, loaded := t.warned.LoadOrStore(deprecatedKey{tt.name}, true); loaded || logger == nil {
+		return
+	}
+	logger.Warn(w)
+}
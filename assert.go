@@ -0,0 +1,43 @@
+package slim
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// printAssert evaluate "- assert cond, message". If cond is false, the
+// rendering fails. In the null-object mode like the Production profile, the
+// warning is reported to Logger instead.
+func printAssert(t *Template, v *vm.VM, n *Node, ae *vm.AssertExpr) error {
+	ok, err := cond(v, ae.Cond)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+	message := strings.TrimSpace(n.Expr)
+	if ae.Message != nil {
+		r, err := v.Eval(ae.Message)
+		if err != nil {
+			return err
+		}
+		message = fmt.Sprint(r)
+	}
+	if !v.NullObject() {
+		return fmt.Errorf("line %d: assertion failed: %s", n.Line, message)
+	}
+	w := &Warning{
+		Template: t.name,
+		Line:     n.Line,
+		Name:     "assert",
+		Message:  "assertion failed: " + message,
+	}
+	recordWarning(v.Context(), w)
+	if logger := t.top().logger; logger != nil {
+		logger.Warn(w)
+	}
+	return nil
+}
@@ -0,0 +1,442 @@
+package slim
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// isExprAttr returns true if the value of the attribute is the expression in
+// the parentheses like class=(names), the map like data={id: 1}, or the
+// array like class=["a", cond && "b"].
+func isExprAttr(s string) bool {
+	return len(s) > 2 && (s[0] == '(' && s[len(s)-1] == ')' || s[0] == '{' && s[len(s)-1] == '}' || s[0] == '[' && s[len(s)-1] == ']')
+}
+
+// attrExpr returns the source of the expression of the attribute.
+func attrExpr(a Attr) string {
+	if a.Name == "*" || a.Value[0] == '{' || a.Value[0] == '[' {
+		return a.Value
+	}
+	return a.Value[1 : len(a.Value)-1]
+}
+
+// evalAttr returns the value of the attribute. The expression in the
+// parentheses is evaluated.
+func evalAttr(v *vm.VM, a Attr) (interface{}, error) {
+	expr, err := v.Compile(attrExpr(a))
+	if err != nil {
+		return nil, err
+	}
+	return v.Eval(expr)
+}
+
+// attrPart is the part of the value of the attribute. value is escaped by
+// the writer if expr is true, and raw is written as is.
+type attrPart struct {
+	raw   string
+	value interface{}
+	expr  bool
+}
+
+// key returns the text of p.
+func (p attrPart) key() string {
+	if p.expr {
+		return fmt.Sprint(p.value)
+	}
+	return p.raw
+}
+
+// attrValue is the evaluated attribute. The attribute which has no parts is
+// written as the boolean attribute.
+type attrValue struct {
+	name  string
+	parts []attrPart
+}
+
+// write write a to ow.
+func (a attrValue) write(ow OutputWriter) error {
+	if err := ow.WriteRaw(" " + a.name); err != nil || a.parts == nil {
+		return err
+	}
+	if err := ow.WriteRaw(`="`); err != nil {
+		return err
+	}
+	var prefix strings.Builder
+	for _, p := range a.parts {
+		var err error
+		if p.expr {
+			err = writeEscapedAttr(ow, a.name, prefix.String(), p.value)
+		} else {
+			err = ow.WriteRaw(p.raw)
+		}
+		if err != nil {
+			return err
+		}
+		prefix.WriteString(p.key())
+	}
+	return ow.WriteRaw(`"`)
+}
+
+// isSplat returns true if s is the splat of the attributes like "*attrs".
+func isSplat(s string) bool {
+	if len(s) < 2 || s[0] != '*' {
+		return false
+	}
+	for i, r := range s[1:] {
+		if !(r == '_' || unicode.IsLetter(r) || i > 0 && (r == '.' || unicode.IsDigit(r))) {
+			return false
+		}
+	}
+	return true
+}
+
+// validAttrName returns true if s can be written as the name of the
+// attribute.
+func validAttrName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || strings.ContainsRune("\"'<>/=`", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// splatPair is the pair of the name and the value of the splat.
+type splatPair struct {
+	Name  string
+	Value interface{}
+}
+
+// splatAttrs returns the pairs of the map of the splat a.
+func splatAttrs(v *vm.VM, a Attr) ([]splatPair, error) {
+	value, err := evalAttr(v, a)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, nil
+	}
+	pairs, ok := mapPairs(value)
+	if !ok {
+		return nil, fmt.Errorf("cannot splat %T as attributes", value)
+	}
+	return pairs, nil
+}
+
+// mapPairs returns the pairs of the map value. The pairs of OrderedMap are
+// in the order, and the others are sorted by the keys. It returns false if
+// value is not a map.
+func mapPairs(value interface{}) ([]splatPair, bool) {
+	var pairs []splatPair
+	if m, ok := value.(*OrderedMap); ok {
+		for _, k := range m.Keys() {
+			pairs = append(pairs, splatPair{k, m.Get(k)})
+		}
+		return pairs, true
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Map {
+		return nil, false
+	}
+	for _, k := range sortedKeys(rv) {
+		pairs = append(pairs, splatPair{fmt.Sprint(k.Interface()), rv.MapIndex(k).Interface()})
+	}
+	return pairs, true
+}
+
+// nestedAttrs returns the pairs of the map value for the attribute named
+// name, which is data, aria, or the hyphenated name of them like
+// "data-user". The names of the pairs are hyphenated like "data-user-id",
+// and the booleans are written as "true" or "false".
+func nestedAttrs(name string, value interface{}) ([]splatPair, bool) {
+	if name != "data" && name != "aria" && !strings.HasPrefix(name, "data-") && !strings.HasPrefix(name, "aria-") {
+		return nil, false
+	}
+	pairs, ok := mapPairs(value)
+	if !ok {
+		return nil, false
+	}
+	for i := range pairs {
+		pairs[i].Name = name + "-" + pairs[i].Name
+		if b, ok := pairs[i].Value.(bool); ok {
+			pairs[i].Value = strconv.FormatBool(b)
+		}
+	}
+	return pairs, true
+}
+
+// evalAttrs returns the attributes of n with the evaluated values. The class
+// of the shorthand and the class attributes are merged into one attribute
+// separated with the spaces, and the ids are joined with "_". The merged
+// attribute is placed at the first of them. The second value is true if the
+// attributes have the expressions.
+func evalAttrs(v *vm.VM, n *Node) ([]attrValue, bool, error) {
+	var attrs []attrValue
+	var ids, classes []attrPart
+	idAt, classAt := -1, -1
+	if n.ID != "" {
+		idAt = len(attrs)
+		attrs = append(attrs, attrValue{name: "id"})
+		ids = append(ids, attrPart{raw: n.ID})
+	}
+	if len(n.Class) > 0 {
+		classAt = len(attrs)
+		attrs = append(attrs, attrValue{name: "class"})
+		for _, c := range n.Class {
+			classes = append(classes, attrPart{raw: c})
+		}
+	}
+
+	addNames := func(name string, names []attrPart) {
+		if name == "id" {
+			if idAt < 0 {
+				idAt = len(attrs)
+				attrs = append(attrs, attrValue{name: "id"})
+			}
+			ids = append(ids, names...)
+		} else {
+			if classAt < 0 {
+				classAt = len(attrs)
+				attrs = append(attrs, attrValue{name: "class"})
+			}
+			classes = append(classes, names...)
+		}
+	}
+
+	var addPair func(p splatPair) error
+	addPair = func(p splatPair) error {
+		if !validAttrName(p.Name) {
+			return fmt.Errorf("line %d: invalid attribute name: %q", n.Line, p.Name)
+		}
+		name := strings.ToLower(p.Name)
+		if pairs, ok := nestedAttrs(name, p.Value); ok {
+			for _, p := range pairs {
+				if err := addPair(p); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		switch {
+		case name == "id" || name == "class":
+			var names []attrPart
+			for _, s := range classNames(p.Value) {
+				names = append(names, attrPart{value: s, expr: true})
+			}
+			addNames(name, names)
+		case p.Value == nil || p.Value == false:
+		case p.Value == true:
+			attrs = append(attrs, attrValue{name: p.Name})
+		default:
+			// the value of the event handler is encoded as JSON, and
+			// checked like the other values.
+			value := p.Value
+			var err error
+			if strings.HasPrefix(name, "on") {
+				err = v.CheckPrint(value)
+			} else {
+				value, err = printable(v, value)
+			}
+			if err != nil {
+				return err
+			}
+			attrs = append(attrs, attrValue{name: p.Name, parts: []attrPart{{value: value, expr: true}}})
+		}
+		return nil
+	}
+
+	dynamic := false
+	for _, a := range n.Attr {
+		if a.Name == "*" {
+			pairs, err := splatAttrs(v, a)
+			if err != nil {
+				return nil, false, err
+			}
+			for _, p := range pairs {
+				if err := addPair(p); err != nil {
+					return nil, false, err
+				}
+			}
+			dynamic = true
+			continue
+		}
+		name := strings.ToLower(a.Name)
+		if name != "id" && name != "class" {
+			av := attrValue{name: a.Name}
+			if isExprAttr(a.Value) {
+				iv, err := evalAttr(v, a)
+				if err != nil {
+					return nil, false, err
+				}
+				dynamic = true
+				if err := addPair(splatPair{a.Name, iv}); err != nil {
+					return nil, false, err
+				}
+				continue
+			} else if a.Value != "" {
+				err := eachInline(v, a.Value, func(s string) error {
+					av.parts = append(av.parts, attrPart{raw: s})
+					return nil
+				}, func(value interface{}) error {
+					av.parts = append(av.parts, attrPart{value: value, expr: true})
+					return nil
+				})
+				if err != nil {
+					return nil, false, err
+				}
+				dynamic = dynamic || hasInline(a.Value)
+			}
+			attrs = append(attrs, av)
+			continue
+		}
+
+		var names []attrPart
+		if isExprAttr(a.Value) {
+			iv, err := evalAttr(v, a)
+			if err != nil {
+				return nil, false, err
+			}
+			for _, s := range classNames(iv) {
+				names = append(names, attrPart{value: s, expr: true})
+			}
+			dynamic = true
+		} else {
+			value, err := attrInline(v, a)
+			if err != nil {
+				return nil, false, err
+			}
+			for _, s := range strings.Fields(value) {
+				names = append(names, attrPart{raw: s})
+			}
+			dynamic = dynamic || hasInline(a.Value)
+		}
+		addNames(name, names)
+	}
+
+	if idAt >= 0 {
+		attrs[idAt].parts = join(ids, "_")
+	}
+	if classAt >= 0 {
+		attrs[classAt].parts = join(uniq(classes), " ")
+	}
+	result := attrs[:0]
+	for i, a := range attrs {
+		if a.parts == nil && (i == idAt || i == classAt) {
+			continue
+		}
+		result = append(result, a)
+	}
+	return result, dynamic, nil
+}
+
+// escapedAttrs returns the attributes escaped by the default writer.
+func escapedAttrs(attrs []attrValue) []Attr {
+	result := make([]Attr, 0, len(attrs))
+	for _, a := range attrs {
+		var sb strings.Builder
+		ow := NewOutputWriter(&sb)
+		for _, p := range a.parts {
+			if p.expr {
+				writeEscapedAttr(ow, a.name, sb.String(), p.value)
+			} else {
+				ow.WriteRaw(p.raw)
+			}
+		}
+		result = append(result, Attr{Name: a.name, Value: sb.String()})
+	}
+	return result
+}
+
+// classNames returns the names of the class in value. The string is split
+// with the spaces. The items of the slice and the keys of the map are the
+// names if they are truthy, or the values of them are truthy.
+func classNames(value interface{}) []string {
+	if value == nil {
+		return nil
+	}
+	switch s := value.(type) {
+	case string:
+		return strings.Fields(s)
+	case HTML:
+		return strings.Fields(string(s))
+	case bool:
+		return nil
+	}
+	var names []string
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < rv.Len(); i++ {
+			item := rv.Index(i).Interface()
+			if Truthy(item) {
+				names = append(names, classNames(item)...)
+			}
+		}
+	case reflect.Map:
+		var keys []string
+		for _, k := range rv.MapKeys() {
+			if Truthy(rv.MapIndex(k).Interface()) {
+				keys = append(keys, fmt.Sprint(k.Interface()))
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			names = append(names, strings.Fields(k)...)
+		}
+	default:
+		names = strings.Fields(fmt.Sprint(value))
+	}
+	return names
+}
+
+// uniq returns parts without the duplicates.
+func uniq(parts []attrPart) []attrPart {
+	seen := make(map[string]bool, len(parts))
+	result := parts[:0]
+	for _, p := range parts {
+		if key := p.key(); !seen[key] {
+			seen[key] = true
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// join returns parts separated with sep. It returns nil if parts is empty.
+func join(parts []attrPart, sep string) []attrPart {
+	var result []attrPart
+	for i, p := range parts {
+		if i > 0 {
+			result = append(result, attrPart{raw: sep})
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+// writeAttrs write the attributes to out.
+func writeAttrs(out io.Writer, line int, attrs []attrValue, dynamic bool) error {
+	write := func() error {
+		ow := outputWriter(out)
+		for _, a := range attrs {
+			if err := a.write(ow); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if !dynamic {
+		return write()
+	}
+	return markDynamic(out, line, write)
+}
@@ -0,0 +1,17 @@
+package slim
+
+import (
+	"context"
+	"io"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// ExecuteAudit is same as ExecuteContext but reports the paths of the data
+// which the rendering accessed, like "user.email" or "items[].name". It is
+// useful to know what reached the page, and to trim over-fetching.
+func (t *Template) ExecuteAudit(ctx context.Context, out io.Writer, value interface{}) (*vm.Audit, error) {
+	a := vm.NewAudit()
+	err := t.executeContext(ctx, out, value, a)
+	return a, err
+}
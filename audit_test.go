@@ -0,0 +1,57 @@
+package slim
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExecuteAudit(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+mixin contact(c)
+  a = c.email
+div
+  h1 = to_upper(user.name)
+  ul
+    - for x in user.orders
+      li = x.id
+  +contact(user.profile)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	a, err := tmpl.ExecuteAudit(context.Background(), &buf, Values{
+		"user": map[string]interface{}{
+			"name":     "mattn",
+			"password": "secret",
+			"orders": []map[string]interface{}{
+				{"id": 1},
+				{"id": 2},
+			},
+			"profile": map[string]interface{}{
+				"email": "mattn@example.com",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		"user",
+		"user.name",
+		"user.orders",
+		"user.orders[]",
+		"user.orders[].id",
+		"user.profile",
+		"user.profile.email",
+	}
+	if got := a.Paths(); !reflect.DeepEqual(expect, got) {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+	if n := a.Count("user.orders[].id"); n != 2 {
+		t.Fatalf("expected 2 but %d", n)
+	}
+}
@@ -0,0 +1,60 @@
+package slim
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// SetBuffered set the buffered mode. By default, the output is written to
+// the writer node by node while the rendering, so the early part of the
+// large page is sent without waiting the rest. In the buffered mode, the
+// output is kept in the memory and written at once only if the rendering
+// succeeds, so the broken output is never written on the error.
+func (t *Template) SetBuffered(on bool) {
+	t.buffered = on
+}
+
+// buffer returns the writer of the output in the buffered mode, and the
+// function to write the buffered output to out on the success. The writer of
+// ExecuteHeatmap keeps recording the segments. OutputWriter is not buffered
+// to keep the calls.
+func (t *Template) buffer(out io.Writer) (io.Writer, func(err error) error) {
+	if _, ok := out.(OutputWriter); ok || !t.buffered {
+		return out, func(err error) error { return err }
+	}
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	dst := out
+	w := io.Writer(buf)
+	if hw, ok := out.(*heatWriter); ok {
+		dst = hw.w
+		hw.w = buf
+		w = hw
+	}
+	return w, func(err error) error {
+		defer bufferPool.Put(buf)
+		if hw, ok := out.(*heatWriter); ok {
+			hw.w = dst
+		}
+		if err != nil {
+			return err
+		}
+		_, err = dst.Write(buf.Bytes())
+		return err
+	}
+}
+
+// SetBuffered set the buffered mode of the templates in the set.
+func (s *TemplateSet) SetBuffered(on bool) {
+	s.mu.Lock()
+	s.buffered = on
+	s.mu.Unlock()
+	s.cache.each(func(t *Template) {
+		t.buffered = on
+	})
+}
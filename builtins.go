@@ -1,12 +1,36 @@
 package slim
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
+
+	"github.com/mattn/go-slim/vm"
 )
 
+func init() {
+	RegisterGlobalFunc("trim", Trim)
+	RegisterGlobalFunc("to_upper", ToUpper)
+	RegisterGlobalFunc("to_lower", ToLower)
+	RegisterGlobalFunc("repeat", Repeat)
+	RegisterGlobalFunc("starts_with", StartsWith)
+	RegisterGlobalFunc("ends_with", EndsWith)
+	RegisterGlobalFunc("json_ld", JSONLD)
+}
+
+// RegisterGlobalFunc register the helper function which templates parsed
+// after the registration can call. It is safe to call from init functions
+// of multiple packages. It panics if f is not a function.
+func RegisterGlobalFunc(name string, f interface{}) {
+	if f == nil || reflect.TypeOf(f).Kind() != reflect.Func {
+		panic("slim: RegisterGlobalFunc requires function: " + name)
+	}
+	vm.Default.Register(name, f)
+}
+
 // Trim is builtin function provide trim(s).
 func Trim(args ...Value) (Value, error) {
 	if len(args) != 1 {
@@ -42,3 +66,43 @@ func Repeat(args ...Value) (Value, error) {
 	}
 	return strings.Repeat(fmt.Sprint(args[0]), int(i)), nil
 }
+
+// StartsWith is builtin function provide starts_with(s, prefix).
+func StartsWith(args ...Value) (Value, error) {
+	if len(args) != 2 {
+		return nil, errors.New("starts_with require 2 arguments")
+	}
+	return strings.HasPrefix(fmt.Sprint(args[0]), fmt.Sprint(args[1])), nil
+}
+
+// EndsWith is builtin function provide ends_with(s, suffix).
+func EndsWith(args ...Value) (Value, error) {
+	if len(args) != 2 {
+		return nil, errors.New("ends_with require 2 arguments")
+	}
+	return strings.HasSuffix(fmt.Sprint(args[0]), fmt.Sprint(args[1])), nil
+}
+
+// JSONLD is builtin function provide json_ld(v). It returns script tag of
+// application/ld+json which contains v serialized as JSON. The tag is returned
+// as HTML, so it is not escaped.
+func JSONLD(args ...Value) (Value, error) {
+	if len(args) != 1 {
+		return nil, errors.New("json_ld require 1 argument")
+	}
+	s, err := jsonLD(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return HTML(`<script type="application/ld+json">` + s + `</script>`), nil
+}
+
+// jsonLD serialize v as JSON which can be embedded in script tag safely.
+// json.Marshal escapes <, > and & so the content never close the tag.
+func jsonLD(v Value) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
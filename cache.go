@@ -0,0 +1,342 @@
+package slim
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache is the LRU cache of the parsed templates keyed by the name and the
+// version of the source, which is the modification time or the hash of the
+// content. The templates rendered by render(), include() and extends from
+// the templates in the cache are cached too.
+//
+// Each change of the cache makes the new generation. The renderings see the
+// generation when they started, so the templates replaced by the reloading
+// in the middle of the rendering are not mixed with the old ones.
+type Cache struct {
+	loader  Loader
+	max     int
+	dev     bool
+	tags    map[string]bool
+	trees   map[string]*Tree
+	mu      sync.Mutex
+	ll      *list.List
+	entries map[string]*list.Element
+	adopt   func(t *Template)
+	gen     atomic.Value // *generation
+}
+
+// generation is the immutable view of the templates in the cache.
+type generation struct {
+	n         uint64
+	templates map[string]*Template
+}
+
+type cacheEntry struct {
+	name    string
+	modTime time.Time
+	hash    [sha256.Size]byte
+	t       *Template
+}
+
+// NewCache create the cache which loads the templates with l, and keeps max
+// templates at most. Zero means unlimited.
+func NewCache(l Loader, max int) *Cache {
+	c := &Cache{
+		loader:  l,
+		max:     max,
+		ll:      list.New(),
+		entries: map[string]*list.Element{},
+	}
+	c.gen.Store(&generation{templates: map[string]*Template{}})
+	return c
+}
+
+// Generation returns the number of the current generation. It is increased
+// when the templates are loaded, replaced or removed.
+func (c *Cache) Generation() uint64 {
+	return c.current().n
+}
+
+// current returns the current generation without locking.
+func (c *Cache) current() *generation {
+	return c.gen.Load().(*generation)
+}
+
+// publish make the new generation from the entries. c.mu must be held.
+func (c *Cache) publish() {
+	templates := make(map[string]*Template, len(c.entries))
+	for name, e := range c.entries {
+		templates[name] = e.Value.(*cacheEntry).t
+	}
+	c.gen.Store(&generation{n: c.current().n + 1, templates: templates})
+}
+
+// cacheView is the templates seen by a rendering.
+type cacheView struct {
+	c    *Cache
+	gen  *generation
+	mu   sync.Mutex
+	seen map[string]*Template
+}
+
+type cacheViewKey struct{}
+
+// withView returns ctx which has the view of the current generation of c,
+// unless ctx already has the one of c.
+func (c *Cache) withView(ctx context.Context) context.Context {
+	if cv, ok := ctx.Value(cacheViewKey{}).(*cacheView); ok && cv.c == c {
+		return ctx
+	}
+	return context.WithValue(ctx, cacheViewKey{}, &cacheView{c: c, gen: c.current(), seen: map[string]*Template{}})
+}
+
+// lookup returns the template named name for the rendering with ctx. The
+// name is resolved to the same template in the rendering, and the template
+// in the generation when the rendering started is used if it exists. Only in
+// the development mode, the changed sources are loaded in the middle of the
+// rendering.
+func (c *Cache) lookup(ctx context.Context, name string) (*Template, error) {
+	cv, ok := ctx.Value(cacheViewKey{}).(*cacheView)
+	if !ok || cv.c != c {
+		return c.Get(name)
+	}
+	name = cleanName(name)
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	if t, ok := cv.seen[name]; ok {
+		return t, nil
+	}
+	c.mu.Lock()
+	dev := c.dev
+	c.mu.Unlock()
+	t, ok := cv.gen.templates[name]
+	if !ok || dev {
+		var err error
+		if t, err = c.Get(name); err != nil {
+			return nil, err
+		}
+	}
+	cv.seen[name] = t
+	return t, nil
+}
+
+// SetDev set the development mode. In the mode, the source is checked on
+// each Get, and the template is parsed again if it is changed. In the
+// production mode, the template is never parsed again until Invalidate is
+// called.
+func (c *Cache) SetDev(on bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dev = on
+}
+
+// SetMax set the number of the templates kept in the cache. Zero means
+// unlimited.
+func (c *Cache) SetMax(max int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.max = max
+	for c.max > 0 && c.ll.Len() > c.max {
+		last := c.ll.Back()
+		c.ll.Remove(last)
+		delete(c.entries, last.Value.(*cacheEntry).name)
+	}
+	c.publish()
+}
+
+// cleanName returns the name of the template in the cache.
+func cleanName(name string) string {
+	name = strings.TrimPrefix(path.Clean(name), "/")
+	if path.Ext(name) == "" {
+		name += ".slim"
+	}
+	return name
+}
+
+// Get returns the template named name. ".slim" can be omitted.
+func (c *Cache) Get(name string) (*Template, error) {
+	name = cleanName(name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[name]
+	if ok && !c.dev {
+		c.ll.MoveToFront(e)
+		return e.Value.(*cacheEntry).t, nil
+	}
+	if tree, found := c.trees[name]; found {
+		if ok {
+			c.ll.MoveToFront(e)
+			return e.Value.(*cacheEntry).t, nil
+		}
+		t, err := c.newTreeTemplate(name, tree)
+		if err != nil {
+			return nil, err
+		}
+		c.put(&cacheEntry{name: name, t: t})
+		return t, nil
+	}
+
+	rc, err := c.loader.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	modTime := modTimeOf(rc)
+	if ok && !modTime.IsZero() && modTime.Equal(e.Value.(*cacheEntry).modTime) {
+		c.ll.MoveToFront(e)
+		return e.Value.(*cacheEntry).t, nil
+	}
+	src, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(src)
+	if ok && modTime.IsZero() && hash == e.Value.(*cacheEntry).hash {
+		c.ll.MoveToFront(e)
+		return e.Value.(*cacheEntry).t, nil
+	}
+
+	t, err := c.parse(name, src)
+	if err != nil {
+		return nil, err
+	}
+	c.put(&cacheEntry{name: name, modTime: modTime, hash: hash, t: t})
+	return t, nil
+}
+
+// reload parse the template named name again, and replace the cached one
+// only if it is parsed and compiled successfully. The renderings in progress
+// keep using the old one.
+func (c *Cache) reload(name string) error {
+	name = cleanName(name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rc, err := c.loader.Open(name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	modTime := modTimeOf(rc)
+	src, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+	t, err := c.parse(name, src)
+	if err != nil {
+		return err
+	}
+	if err := t.compile(t.root); err != nil {
+		return err
+	}
+	c.put(&cacheEntry{name: name, modTime: modTime, hash: sha256.Sum256(src), t: t})
+	return nil
+}
+
+// modTimeOf returns the modification time of rc, or zero if it is unknown.
+func modTimeOf(rc io.ReadCloser) time.Time {
+	if f, ok := rc.(interface{ Stat() (fs.FileInfo, error) }); ok {
+		if fi, err := f.Stat(); err == nil {
+			return fi.ModTime()
+		}
+	}
+	return time.Time{}
+}
+
+func (c *Cache) parse(name string, src []byte) (*Template, error) {
+	t, err := parseLoader(c.loader, name, bytes.NewReader(src), c.tags)
+	if err != nil {
+		return nil, err
+	}
+	t.cache = c
+	if c.adopt != nil {
+		c.adopt(t)
+	}
+	return t, nil
+}
+
+// put add entry to the front, and evict the oldest if the cache is full.
+func (c *Cache) put(entry *cacheEntry) {
+	if e, ok := c.entries[entry.name]; ok {
+		e.Value = entry
+		c.ll.MoveToFront(e)
+	} else {
+		c.entries[entry.name] = c.ll.PushFront(entry)
+	}
+	if c.max > 0 && c.ll.Len() > c.max {
+		last := c.ll.Back()
+		c.ll.Remove(last)
+		delete(c.entries, last.Value.(*cacheEntry).name)
+	}
+	c.publish()
+}
+
+// Invalidate remove the template named name, so it is parsed again at the
+// next Get.
+func (c *Cache) Invalidate(name string) {
+	name = cleanName(name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[name]; ok {
+		c.ll.Remove(e)
+		delete(c.entries, name)
+		c.publish()
+	}
+}
+
+// Clear remove all templates.
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.entries = map[string]*list.Element{}
+	c.publish()
+}
+
+// Len returns the number of the templates in the cache.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// peek returns the cached template named name without loading it.
+func (c *Cache) peek(name string) *Template {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[cleanName(name)]; ok {
+		return e.Value.(*cacheEntry).t
+	}
+	return nil
+}
+
+// names returns the names of the cached templates in the sorted order.
+func (c *Cache) names() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := make([]string, 0, len(c.entries))
+	for name := range c.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// each call f with the cached templates.
+func (c *Cache) each(f func(t *Template)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for e := c.ll.Front(); e != nil; e = e.Next() {
+		f(e.Value.(*cacheEntry).t)
+	}
+}
@@ -0,0 +1,89 @@
+package slim
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	files := MapLoader{
+		"a.slim": "p a",
+		"b.slim": "p b",
+		"c.slim": "p c",
+	}
+	c := NewCache(files, 2)
+	a, err := c.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aa, _ := c.Get("a.slim"); aa != a {
+		t.Fatal("expected the cached template")
+	}
+	files["a.slim"] = "p changed"
+	if aa, _ := c.Get("a"); aa != a {
+		t.Fatal("expected the cached template in the production mode")
+	}
+	c.SetDev(true)
+	aa, err := c.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aa == a {
+		t.Fatal("expected the template is parsed again")
+	}
+	if aaa, _ := c.Get("a"); aaa != aa {
+		t.Fatal("expected the cached template if not changed")
+	}
+	c.SetDev(false)
+
+	c.Get("b")
+	c.Get("c")
+	if n := c.Len(); n != 2 {
+		t.Fatalf("expected 2 but %d", n)
+	}
+	if c.peek("a") != nil {
+		t.Fatal("expected the least recently used template is evicted")
+	}
+	b := c.peek("b")
+	c.Invalidate("b")
+	if bb, _ := c.Get("b"); bb == b {
+		t.Fatal("expected the template is parsed again after Invalidate")
+	}
+}
+
+func TestCacheModTime(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "index.slim")
+	if err := os.WriteFile(name, []byte("p = x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := NewCache(OSLoader(dir), 0)
+	c.SetDev(true)
+	render := func() string {
+		tmpl, err := c.Get("index")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, Values{"x": 1}); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	if got := render(); got != "<p>1</p>\n" {
+		t.Fatalf("unexpected output %q", got)
+	}
+	if err := os.WriteFile(name, []byte("span = x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(name, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if got := render(); got != "<span>1</span>\n" {
+		t.Fatalf("unexpected output %q", got)
+	}
+}
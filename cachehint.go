@@ -0,0 +1,147 @@
+package slim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// CacheHints is the aggregate of the hints of the cacheability recorded in
+// the fragments while the rendering, like "- cache ttl = 5m",
+// `- cache vary = "Accept-Language"` or `- cache scope = "private"`.
+type CacheHints struct {
+	mu      sync.Mutex
+	hasTTL  bool
+	ttl     time.Duration
+	vary    map[string]bool
+	private bool
+}
+
+type cacheHintsKey struct{}
+
+// WithCacheHints returns the context which records the hints of the
+// renderings with it.
+func WithCacheHints(ctx context.Context) (context.Context, *CacheHints) {
+	h := &CacheHints{vary: map[string]bool{}}
+	return context.WithValue(ctx, cacheHintsKey{}, h), h
+}
+
+// TTL returns the minimum TTL of the fragments. It returns false if no
+// fragment has the TTL.
+func (h *CacheHints) TTL() (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.ttl, h.hasTTL
+}
+
+// Vary returns the keys which the fragments vary by in the sorted order.
+func (h *CacheHints) Vary() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	keys := make([]string, 0, len(h.vary))
+	for key := range h.vary {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Private returns true if any fragment is private.
+func (h *CacheHints) Private() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.private
+}
+
+// SetHeader set Cache-Control, Surrogate-Control and Vary of header by the
+// hints. Nothing is set if no fragment has the TTL.
+func (h *CacheHints) SetHeader(header http.Header) {
+	ttl, ok := h.TTL()
+	if !ok {
+		return
+	}
+	if vary := h.Vary(); len(vary) > 0 {
+		header.Set("Vary", strings.Join(vary, ", "))
+	}
+	if ttl <= 0 {
+		header.Set("Cache-Control", "no-store")
+		return
+	}
+	maxAge := "max-age=" + strconv.Itoa(int(ttl/time.Second))
+	if h.Private() {
+		header.Set("Cache-Control", "private, "+maxAge)
+		return
+	}
+	header.Set("Cache-Control", "public, "+maxAge)
+	header.Set("Surrogate-Control", maxAge)
+}
+
+func (h *CacheHints) setTTL(ttl time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.hasTTL || ttl < h.ttl {
+		h.ttl = ttl
+		h.hasTTL = true
+	}
+}
+
+// cacheDirective record the hint of "- cache name = value" to the hints in
+// the context of the rendering.
+func cacheDirective(v *vm.VM, d *vm.DirectiveExpr) error {
+	r, err := v.Eval(d.RHS)
+	if err != nil {
+		return err
+	}
+	h, ok := v.Context().Value(cacheHintsKey{}).(*CacheHints)
+	if !ok {
+		return nil
+	}
+	switch d.LHS {
+	case "ttl":
+		ttl, ok := r.(time.Duration)
+		if !ok {
+			if ttl, err = time.ParseDuration(fmt.Sprint(r)); err != nil {
+				return errors.New("invalid ttl: " + fmt.Sprint(r))
+			}
+		}
+		h.setTTL(ttl)
+	case "vary":
+		var keys []string
+		switch rv := r.(type) {
+		case []string:
+			keys = rv
+		case []interface{}:
+			for _, key := range rv {
+				keys = append(keys, fmt.Sprint(key))
+			}
+		default:
+			keys = []string{fmt.Sprint(r)}
+		}
+		h.mu.Lock()
+		for _, key := range keys {
+			h.vary[http.CanonicalHeaderKey(key)] = true
+		}
+		h.mu.Unlock()
+	case "scope":
+		switch fmt.Sprint(r) {
+		case "private":
+			h.mu.Lock()
+			h.private = true
+			h.mu.Unlock()
+		case "public":
+		default:
+			return errors.New("invalid cache scope: " + fmt.Sprint(r))
+		}
+	default:
+		return errors.New("unknown cache hint: " + d.LHS)
+	}
+	return nil
+}
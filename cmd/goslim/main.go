@@ -20,6 +20,7 @@ func run(w io.Writer, r io.Reader, args []string) error {
 		"to_upper": slim.ToUpper,
 		"to_lower": slim.ToLower,
 		"repeat":   slim.Repeat,
+		"json_ld":  slim.JSONLD,
 	})
 
 	m := make(map[string]interface{})
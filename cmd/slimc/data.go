@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/mattn/go-slim"
+)
+
+func parseFiles(names []string) ([]*slim.Template, error) {
+	if len(names) == 0 {
+		return nil, errors.New("no template files")
+	}
+	var templates []*slim.Template
+	for _, name := range names {
+		t, err := slim.ParseFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+func runData(args []string, in io.Reader, out io.Writer) error {
+	fs := flag.NewFlagSet("data", flag.ContinueOnError)
+	format := fs.String("format", "json", "output format: json or go")
+	name := fs.String("name", "View", "name of the struct for go format")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	templates, err := parseFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	r, err := slim.Analyze(templates...)
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case "go":
+		_, err = io.WriteString(out, r.GoStruct(*name))
+		return err
+	}
+	return fmt.Errorf("unknown format: %s", *format)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/mattn/go-slim"
+)
+
+func runDiff(args []string, in io.Reader, out io.Writer) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("usage: slimc diff old.slim new.slim")
+	}
+	templates, err := parseFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	changes := slim.Diff(templates[0], templates[1])
+	for _, c := range changes {
+		fname := fs.Arg(1)
+		if c.Kind == "removed node" {
+			fname = fs.Arg(0)
+		}
+		fmt.Fprintf(out, "%s:%d: %s\n", fname, c.Line, c)
+	}
+	if len(changes) > 0 {
+		fmt.Fprintf(out, "%d changes\n", len(changes))
+	}
+	return nil
+}
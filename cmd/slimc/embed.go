@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-slim"
+)
+
+func runEmbed(args []string, in io.Reader, out io.Writer) error {
+	fs := flag.NewFlagSet("embed", flag.ContinueOnError)
+	pkg := fs.String("package", "views", "name of the package")
+	name := fs.String("var", "Templates", "name of the variable of the set")
+	output := fs.String("o", "", "output file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: slimc embed [-package name] [-var name] [-o file] dir")
+	}
+	trees, err := parseTrees(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := generateEmbed(*pkg, *name, fs.Arg(0), trees)
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		return os.WriteFile(*output, b, 0644)
+	}
+	_, err = out.Write(b)
+	return err
+}
+
+// parseTrees parse the templates in dir, and returns the trees keyed by the
+// names relative to dir. The expressions are compiled to check the errors.
+func parseTrees(dir string) (map[string]*slim.Tree, error) {
+	trees := map[string]*slim.Tree{}
+	set := slim.NewTemplateSet(nil)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(p) != ".slim" {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		tree, err := slim.ParseTree(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		name := filepath.ToSlash(rel)
+		if err := set.AddTree(name, tree); err != nil {
+			return err
+		}
+		trees[name] = tree
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(trees) == 0 {
+		return nil, fmt.Errorf("no templates in %s", dir)
+	}
+	return trees, nil
+}
+
+// generateEmbed returns the source which adds the trees to the set named
+// name at init.
+func generateEmbed(pkg, name, dir string, trees map[string]*slim.Tree) ([]byte, error) {
+	names := make([]string, 0, len(trees))
+	for n := range trees {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by slimc embed; DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	fmt.Fprint(&buf, "import \"github.com/mattn/go-slim\"\n\n")
+	fmt.Fprintf(&buf, "// %s is the set of the templates embedded from %s.\n", name, filepath.ToSlash(dir))
+	fmt.Fprintf(&buf, "var %s = slim.NewTemplateSet(nil)\n\n", name)
+	fmt.Fprint(&buf, "func init() {\n\tfor name, tree := range map[string]*slim.Tree{\n")
+	for _, n := range names {
+		tree := trees[n]
+		fmt.Fprintf(&buf, "%s: {\n", strconv.Quote(n))
+		if len(tree.Annotations) > 0 {
+			keys := make([]string, 0, len(tree.Annotations))
+			for k := range tree.Annotations {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			buf.WriteString("Annotations: map[string]string{\n")
+			for _, k := range keys {
+				fmt.Fprintf(&buf, "%s: %s,\n", strconv.Quote(k), strconv.Quote(tree.Annotations[k]))
+			}
+			buf.WriteString("},\n")
+		}
+		buf.WriteString("Root: &slim.Node")
+		writeNode(&buf, tree.Root)
+		buf.WriteString(",\n},\n")
+	}
+	fmt.Fprintf(&buf, "\t} {\n\t\tif err := %s.AddTree(name, tree); err != nil {\n\t\t\tpanic(err)\n\t\t}\n\t}\n}\n", name)
+	return format.Source(buf.Bytes())
+}
+
+// writeNode write the literal of n without the type.
+func writeNode(buf *bytes.Buffer, n *slim.Node) {
+	var fields []string
+	str := func(name, s string) {
+		if s != "" {
+			fields = append(fields, name+": "+strconv.Quote(s))
+		}
+	}
+	str("Name", n.Name)
+	str("ID", n.ID)
+	if len(n.Class) > 0 {
+		var cs []string
+		for _, c := range n.Class {
+			cs = append(cs, strconv.Quote(c))
+		}
+		fields = append(fields, "Class: []string{"+strings.Join(cs, ", ")+"}")
+	}
+	if len(n.Attr) > 0 {
+		var as []string
+		for _, a := range n.Attr {
+			as = append(as, fmt.Sprintf("{Name: %s, Value: %s}", strconv.Quote(a.Name), strconv.Quote(a.Value)))
+		}
+		fields = append(fields, "Attr: []slim.Attr{"+strings.Join(as, ", ")+"}")
+	}
+	str("Text", n.Text)
+	str("Expr", n.Expr)
+	if n.Raw {
+		fields = append(fields, "Raw: true")
+	}
+	if n.Leading {
+		fields = append(fields, "Leading: true")
+	}
+	if n.Trailing {
+		fields = append(fields, "Trailing: true")
+	}
+	if n.Indent != 0 {
+		fields = append(fields, "Indent: "+strconv.Itoa(n.Indent))
+	}
+	if n.Line != 0 {
+		fields = append(fields, "Line: "+strconv.Itoa(n.Line))
+	}
+	buf.WriteString("{" + strings.Join(fields, ", "))
+	if len(n.Children) > 0 {
+		if len(fields) > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString("Children: []*slim.Node{\n")
+		for _, c := range n.Children {
+			writeNode(buf, c)
+			buf.WriteString(",\n")
+		}
+		buf.WriteString("}")
+	}
+	buf.WriteString("}")
+}
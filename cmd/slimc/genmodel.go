@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-slim"
+)
+
+// modelName returns the name of the model from the file name like
+// "user_list.slim" to "UserList".
+func modelName(fname string) string {
+	base := filepath.Base(fname)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	var sb strings.Builder
+	for _, s := range strings.FieldsFunc(base, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		rs := []rune(s)
+		rs[0] = unicode.ToUpper(rs[0])
+		sb.WriteString(string(rs))
+	}
+	return sb.String()
+}
+
+func runGenModel(args []string, in io.Reader, out io.Writer) error {
+	fs := flag.NewFlagSet("gen-model", flag.ContinueOnError)
+	pkg := fs.String("package", "views", "name of the package")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	templates, err := parseFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by slimc gen-model; DO NOT EDIT.\n\npackage %s\n\n", *pkg)
+	fmt.Fprint(&buf, "import (\n\t\"io\"\n\n\t\"github.com/mattn/go-slim\"\n)\n")
+	for i, t := range templates {
+		r, err := slim.Analyze(t)
+		if err != nil {
+			return fmt.Errorf("%s: %w", fs.Arg(i), err)
+		}
+		name := modelName(fs.Arg(i))
+		base := filepath.Base(fs.Arg(i))
+		fmt.Fprintf(&buf, "\n// %sModel is the model of %s.\n", name, base)
+		buf.WriteString(r.GoStruct(name + "Model"))
+		fmt.Fprintf(&buf, "\n// Execute%s render %s with m.\n", name, base)
+		fmt.Fprintf(&buf, "func Execute%s(t *slim.Template, w io.Writer, m %sModel) error {\n", name, name)
+		fmt.Fprint(&buf, "\treturn slim.ExecuteTyped(t, w, m)\n}\n")
+	}
+	b, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(b)
+	return err
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/mattn/go-slim"
+)
+
+func runLint(args []string, in io.Reader, out io.Writer) error {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	templates, err := parseFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	var count int
+	logger := slim.LoggerFunc(func(w *slim.Warning) {
+		count++
+		if w.Line > 0 {
+			fmt.Fprintf(out, "%s:%d: %s\n", w.Template, w.Line, w.Message)
+		} else {
+			fmt.Fprintf(out, "%s: %s\n", w.Template, w.Message)
+		}
+	})
+	for _, t := range templates {
+		t.SetLogger(logger)
+	}
+	if _, err := slim.Analyze(templates...); err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%d warnings", count)
+	}
+	return nil
+}
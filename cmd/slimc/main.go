@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+type command struct {
+	usage string
+	run   func(args []string, in io.Reader, out io.Writer) error
+}
+
+var commands = map[string]command{
+	"data":      {"report the data which templates read", runData},
+	"diff":      {"show semantic changes between templates", runDiff},
+	"embed":     {"generate the code which embeds templates", runEmbed},
+	"gen-model": {"generate the models of templates", runGenModel},
+	"lint":      {"warn the uses of deprecated templates", runLint},
+	"repl":      {"evaluate expressions interactively", runREPL},
+	"serve":     {"serve rendered templates with live reload", runServe},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage of %s: <command> [arguments]\n\nCommands:\n", os.Args[0])
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].usage)
+	}
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+	if err := cmd.run(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
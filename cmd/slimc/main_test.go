@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestREPL(t *testing.T) {
+	var buf bytes.Buffer
+	err := runREPL([]string{"-data", "../../testdata/test_issue4-001.json", "-e", "to_upper(repeat(\"a\", 2))"}, nil, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "\"AA\" (string)\n" {
+		t.Fatalf("unexpected output: %v", got)
+	}
+
+	buf.Reset()
+	err = runREPL(nil, strings.NewReader("1 + 2\n"), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "> 3 (int64)\n> \n" {
+		t.Fatalf("unexpected output: %q", got)
+	}
+}
+
+func TestData(t *testing.T) {
+	var buf bytes.Buffer
+	err := runData([]string{"-format", "go", "../../testdata/test_each.slim"}, nil, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.Contains(got, "type View struct") {
+		t.Fatalf("unexpected output: %v", got)
+	}
+	if err := runData(nil, nil, &buf); err == nil {
+		t.Fatal("should be fail")
+	}
+}
+
+func TestGenModel(t *testing.T) {
+	var buf bytes.Buffer
+	err := runGenModel([]string{"-package", "models", "../../testdata/test_member.slim"}, nil, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, s := range []string{"package models", "type TestMemberModel struct", "func ExecuteTestMember("} {
+		if !strings.Contains(got, s) {
+			t.Fatalf("expected %q in output: %v", s, got)
+		}
+	}
+	if name := modelName("user_list.slim"); name != "UserList" {
+		t.Fatalf("unexpected name: %v", name)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	var buf bytes.Buffer
+	err := runDiff([]string{"../../testdata/test_each.slim", "../../testdata/test_member.slim"}, nil, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.Contains(got, "changes\n") {
+		t.Fatalf("unexpected output: %v", got)
+	}
+	if err := runDiff([]string{"../../testdata/test_each.slim"}, nil, &buf); err == nil {
+		t.Fatal("should be fail")
+	}
+}
+
+func TestServe(t *testing.T) {
+	dir := t.TempDir()
+	index := filepath.Join(dir, "index.slim")
+	if err := os.WriteFile(index, []byte("html\n  body\n    h1 = name\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	data := filepath.Join(dir, "data.json")
+	if err := os.WriteFile(data, []byte(`{"name": "slim"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(newServer(dir, data))
+	defer ts.Close()
+
+	get := func(p string) (int, string) {
+		resp, err := http.Get(ts.URL + p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(b)
+	}
+
+	code, body := get("/")
+	if code != http.StatusOK || !strings.Contains(body, "<h1>slim</h1>") || !strings.Contains(body, reloadPath+"\"") {
+		t.Fatalf("unexpected response: %d %v", code, body)
+	}
+	if i, j := strings.Index(body, "<script>"), strings.Index(body, "</body>"); i < 0 || i > j {
+		t.Fatalf("script should be in body: %v", body)
+	}
+	if code, _ := get("/index"); code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", code)
+	}
+	if code, _ := get("/missing"); code != http.StatusNotFound {
+		t.Fatalf("unexpected status: %d", code)
+	}
+
+	_, version := get(reloadPath)
+	later := time.Now().Add(time.Hour)
+	if err := os.WriteFile(index, []byte("h1 = name +\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(index, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, v := get(reloadPath); v == version {
+		t.Fatalf("version should be changed: %v", v)
+	}
+	if code, body := get("/"); code != http.StatusInternalServerError || !strings.Contains(body, "index.slim") || !strings.Contains(body, "<script>") {
+		t.Fatalf("unexpected response: %d %v", code, body)
+	}
+
+	if err := runServe(nil, nil, io.Discard); err == nil {
+		t.Fatal("should be fail")
+	}
+}
+
+func TestLint(t *testing.T) {
+	var buf bytes.Buffer
+	err := runLint([]string{"../../testdata/test_deprecated.slim"}, nil, &buf)
+	if err == nil {
+		t.Fatal("should be fail")
+	}
+	if got := buf.String(); !strings.Contains(got, "template is deprecated: ") || !strings.Contains(got, "use test_card.slim") {
+		t.Fatalf("unexpected output: %v", got)
+	}
+
+	buf.Reset()
+	if err := runLint([]string{"../../testdata/test_each.slim"}, nil, &buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "partials"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.slim"), []byte("@title Index\ndiv\n  p = name\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "partials", "foot.slim"), []byte("footer.f Bye\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := runEmbed([]string{"-package", "views", dir}, nil, &buf); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, s := range []string{"package views", "var Templates = slim.NewTemplateSet(nil)", `"partials/foot.slim": {`, `"title": "Index"`, `{Name: "p", Expr: " name"`} {
+		if !strings.Contains(got, s) {
+			t.Fatalf("expected %q in output: %v", s, got)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "broken.slim"), []byte("p = (\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runEmbed([]string{dir}, nil, &buf); err == nil {
+		t.Fatal("should be fail")
+	}
+}
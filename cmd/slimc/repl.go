@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mattn/go-slim"
+)
+
+// readData read the JSON file which is used as the value of the templates.
+func readData(fname string) (slim.Values, error) {
+	values := slim.Values{}
+	if fname == "" {
+		return values, nil
+	}
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(&values); err != nil {
+		return nil, fmt.Errorf("%s: %w", fname, err)
+	}
+	return values, nil
+}
+
+func runREPL(args []string, in io.Reader, out io.Writer) error {
+	fs := flag.NewFlagSet("repl", flag.ContinueOnError)
+	data := fs.String("data", "", "JSON file of the values")
+	expr := fs.String("e", "", "evaluate the expression and exit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	values, err := readData(*data)
+	if err != nil {
+		return err
+	}
+	r := slim.NewREPL(values, nil)
+	if *expr != "" {
+		result, err := r.Eval(*expr)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%#v (%T)\n", result, result)
+		return nil
+	}
+	return r.Run(in, out)
+}
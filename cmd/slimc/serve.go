@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-slim"
+)
+
+// reloadPath is the path which returns the version of the templates. The
+// pages poll it, and reload themselves when the version is changed.
+const reloadPath = "/_slimc/reload"
+
+const reloadScript = `<script>
+(function() {
+  var version = null;
+  setInterval(function() {
+    fetch(%q).then(function(r) { return r.text(); }).then(function(v) {
+      if (version !== null && v !== version) location.reload();
+      version = v;
+    }).catch(function() {});
+  }, 1000);
+})();
+</script>
+`
+
+func runServe(args []string, in io.Reader, out io.Writer) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", "localhost:8080", "address to listen")
+	data := fs.String("data", "", "JSON file of the values")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// the flags can follow the directory like "slimc serve dir --data data.json".
+	dir := fs.Arg(0)
+	if fs.NArg() > 1 {
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() > 0 {
+			dir = ""
+		}
+	}
+	if dir == "" {
+		return errors.New("usage: slimc serve [-addr host:port] [-data data.json] dir")
+	}
+	if _, err := readData(*data); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "serving %s on http://%s/\n", dir, *addr)
+	return http.ListenAndServe(*addr, newServer(dir, *data))
+}
+
+// server render the templates in dir with the values of data at each
+// request, so the changes of the files are reflected without restart.
+type server struct {
+	dir  string
+	data string
+}
+
+func newServer(dir, data string) *server {
+	return &server{dir: dir, data: data}
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == reloadPath {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		io.WriteString(w, s.version())
+		return
+	}
+	fname, ok := s.lookup(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	var buf bytes.Buffer
+	code := http.StatusOK
+	if err := s.render(&buf, fname); err != nil {
+		log.Printf("%s: %v", fname, err)
+		code = http.StatusInternalServerError
+		buf.Reset()
+		fmt.Fprintf(&buf, "<!DOCTYPE html>\n<html><body><pre>%s: %s</pre></body></html>\n",
+			html.EscapeString(filepath.ToSlash(fname)), html.EscapeString(err.Error()))
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	w.Write(injectReload(buf.Bytes()))
+}
+
+// lookup returns the file of the template for the path. "/users" is
+// "users.slim", and "/users/" is "users/index.slim" in the directory.
+func (s *server) lookup(p string) (string, bool) {
+	p = path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") {
+		p += "index"
+	} else if fi, err := os.Stat(filepath.Join(s.dir, filepath.FromSlash(p))); err == nil && fi.IsDir() {
+		p += "/index"
+	}
+	p = strings.TrimSuffix(p, ".slim") + ".slim"
+	fname := filepath.Join(s.dir, filepath.FromSlash(p))
+	if fi, err := os.Stat(fname); err != nil || fi.IsDir() {
+		return "", false
+	}
+	return fname, true
+}
+
+// render parse the template fname, and render it with the values.
+func (s *server) render(out io.Writer, fname string) error {
+	values, err := readData(s.data)
+	if err != nil {
+		return err
+	}
+	t, err := slim.ParseFile(fname)
+	if err != nil {
+		return err
+	}
+	return t.Execute(out, values)
+}
+
+// version returns the latest modified time of the templates and the data.
+func (s *server) version() string {
+	var latest int64
+	update := func(fi fs.FileInfo) {
+		if t := fi.ModTime().UnixNano(); t > latest {
+			latest = t
+		}
+	}
+	filepath.WalkDir(s.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if fi, err := d.Info(); err == nil {
+			update(fi)
+		}
+		return nil
+	})
+	if s.data != "" {
+		if fi, err := os.Stat(s.data); err == nil {
+			update(fi)
+		}
+	}
+	return strconv.FormatInt(latest, 10)
+}
+
+// injectReload insert the script of the live reload before </body>, or
+// append it if the page has no body.
+func injectReload(b []byte) []byte {
+	script := fmt.Sprintf(reloadScript, reloadPath)
+	if i := bytes.LastIndex(b, []byte("</body>")); i >= 0 {
+		return append(b[:i:i], append([]byte(script), b[i:]...)...)
+	}
+	return append(b, script...)
+}
@@ -0,0 +1,24 @@
+package slim
+
+import (
+	"io"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// printConditional render the children of n in the conditional comment of
+// IE like "/[if IE]".
+func printConditional(t *Template, out io.Writer, v *vm.VM, n *Node, indent int) error {
+	writeIndent(out, v, indent)
+	io.WriteString(out, "<!--["+n.Text+"]>")
+	writeNewLine(out, v)
+	for _, c := range n.Children {
+		if err := printNode(t, out, v, c, indent+1); err != nil {
+			return err
+		}
+	}
+	writeIndent(out, v, indent)
+	io.WriteString(out, "<![endif]-->")
+	writeNewLine(out, v)
+	return nil
+}
@@ -0,0 +1,146 @@
+package slim
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// Component is the component which the tag of the name registered by
+// RegisterComponent like "Card" is expanded to. *Template is Component.
+type Component interface {
+	RenderComponent(ctx context.Context, out io.Writer, attrs Values) error
+}
+
+// ComponentFunc is an adapter to allow the use of ordinary functions as
+// Component.
+type ComponentFunc func(ctx context.Context, out io.Writer, attrs Values) error
+
+// RenderComponent calls f(ctx, out, attrs).
+func (f ComponentFunc) RenderComponent(ctx context.Context, out io.Writer, attrs Values) error {
+	return f(ctx, out, attrs)
+}
+
+// RenderComponent render t with the attributes as the values.
+func (t *Template) RenderComponent(ctx context.Context, out io.Writer, attrs Values) error {
+	return t.ExecuteContext(ctx, out, attrs)
+}
+
+var components = struct {
+	sync.RWMutex
+	m map[string]Component
+}{m: make(map[string]Component)}
+
+// maxComponentDepth is the limit of nested components.
+const maxComponentDepth = 32
+
+type componentKey struct{}
+
+// RegisterComponent register the component which all templates can use. The
+// tag named name like `Card title="Hi"` is expanded to the output of c with
+// the attributes, and the children are passed as "content". The name must
+// start with the upper case letter to be distinguished from the elements.
+func RegisterComponent(name string, c Component) {
+	if r, _ := utf8.DecodeRuneInString(name); !unicode.IsUpper(r) {
+		panic("slim: component name must start with upper case letter: " + name)
+	}
+	components.Lock()
+	defer components.Unlock()
+	components.m[name] = c
+}
+
+func lookupComponent(name string) (Component, bool) {
+	if r, _ := utf8.DecodeRuneInString(name); !unicode.IsUpper(r) {
+		return nil, false
+	}
+	components.RLock()
+	defer components.RUnlock()
+	c, ok := components.m[name]
+	return c, ok
+}
+
+// componentAttrs returns the attributes of n as the values. The expressions
+// are not converted to the strings, and the attributes without the value are
+// true. The values of #{} in the attributes are escaped, and the attributes
+// are passed as HTML.
+func componentAttrs(v *vm.VM, n *Node) (Values, error) {
+	attrs := Values{}
+	if n.ID != "" {
+		attrs["id"] = n.ID
+	}
+	if len(n.Class) > 0 {
+		attrs["class"] = strings.Join(n.Class, " ")
+	}
+	for _, a := range n.Attr {
+		switch {
+		case a.Name == "*":
+			pairs, err := splatAttrs(v, a)
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range pairs {
+				attrs[p.Name] = p.Value
+			}
+		case isExprAttr(a.Value):
+			value, err := evalAttr(v, a)
+			if err != nil {
+				return nil, err
+			}
+			attrs[a.Name] = value
+		case a.Value == "":
+			attrs[a.Name] = true
+		default:
+			value, err := rubyInline(v, a.Value)
+			if err != nil {
+				return nil, err
+			}
+			attrs[a.Name] = HTML(value)
+		}
+	}
+	return attrs, nil
+}
+
+// printComponent render the component c for n. The children of n are
+// rendered at first, and passed as "content".
+func printComponent(t *Template, out io.Writer, v *vm.VM, n *Node, c Component) error {
+	attrs, err := componentAttrs(v, n)
+	if err != nil {
+		return err
+	}
+	ctx := v.Context()
+	depth, _ := ctx.Value(componentKey{}).(int)
+	if depth >= maxComponentDepth {
+		return errors.New("component nested too deeply: " + n.Name)
+	}
+	v.SetContext(context.WithValue(ctx, componentKey{}, depth+1))
+	defer v.SetContext(ctx)
+	if len(n.Children) > 0 {
+		var buf bytes.Buffer
+		err := withWriter(v, &buf, func() error {
+			for _, child := range n.Children {
+				if err := printNode(t, &buf, v, child, 0); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		attrs["content"] = HTML(buf.String())
+	} else if n.Text != "" {
+		text, err := textInline(v, n)
+		if err != nil {
+			return err
+		}
+		attrs["content"] = HTML(text)
+	}
+	return c.RenderComponent(v.Context(), out, attrs)
+}
@@ -0,0 +1,117 @@
+package slim
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// contents is the named buffers captured by "- content_for :name", and
+// emitted by "= yield :name".
+type contents struct {
+	mu     sync.Mutex
+	values map[string]*bytes.Buffer
+}
+
+type contentKey struct{}
+
+// withContents returns ctx which has the buffers of content_for. The buffers
+// of the parent are shared by the partials and the layouts.
+func withContents(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(contentKey{}).(*contents); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, contentKey{}, &contents{values: map[string]*bytes.Buffer{}})
+}
+
+// append add s to the buffer named name.
+func (c *contents) append(name string, s []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	buf, ok := c.values[name]
+	if !ok {
+		buf = new(bytes.Buffer)
+		c.values[name] = buf
+	}
+	buf.Write(s)
+}
+
+// get returns the content of the buffer named name.
+func (c *contents) get(name string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if buf, ok := c.values[name]; ok {
+		return buf.String()
+	}
+	return ""
+}
+
+// isContentFor returns true if expr is "content_for :name".
+func isContentFor(expr vm.Expr) bool {
+	ce, ok := expr.(*vm.CallExpr)
+	return ok && ce.Name == "content_for"
+}
+
+// printContentFor render the children of n, and append the output to the
+// buffer named with the argument of "content_for". Nothing is written to
+// out.
+func printContentFor(t *Template, v *vm.VM, n *Node, expr vm.Expr) error {
+	ce := expr.(*vm.CallExpr)
+	if len(ce.Exprs) != 1 {
+		return errors.New("content_for takes the name: " + n.Expr)
+	}
+	name, err := v.Eval(ce.Exprs[0])
+	if err != nil {
+		return err
+	}
+	c, ok := v.Context().Value(contentKey{}).(*contents)
+	if !ok {
+		return nil
+	}
+	var buf bytes.Buffer
+	err = withWriter(v, &buf, func() error {
+		for _, child := range n.Children {
+			if err := printNode(t, &buf, v, child, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	c.append(fmt.Sprint(name), buf.Bytes())
+	return nil
+}
+
+// printContents render the top level "content_for" of t before the layout,
+// because the layout yields them before the blocks of t are rendered.
+func (t *Template) printContents(v *vm.VM) error {
+	for _, c := range t.root.Children {
+		if c.Name != "" || c.Expr == "" {
+			continue
+		}
+		expr, err := v.CompileStmt(c.Expr)
+		if err != nil {
+			return err
+		}
+		if isContentFor(expr) {
+			if err := printContentFor(t, v, c, expr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// yield returns the content captured by "content_for" with the name.
+func yield(ctx context.Context, name string) HTML {
+	if c, ok := ctx.Value(contentKey{}).(*contents); ok {
+		return HTML(c.get(name))
+	}
+	return ""
+}
@@ -0,0 +1,178 @@
+package slim
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Change is a semantic change between the templates reported by Diff.
+type Change struct {
+	// Path is the path of the node like "html > body > p[2]".
+	Path string
+	// Kind is the kind of the change like "added attribute".
+	Kind string
+	Old  string
+	New  string
+	// Line is the line number in the new template, or in the old template
+	// for removed nodes.
+	Line int
+}
+
+func (c *Change) String() string {
+	switch {
+	case c.Old == "" && c.New == "":
+		return fmt.Sprintf("%s: %s", c.Path, c.Kind)
+	case c.Old == "":
+		return fmt.Sprintf("%s: %s: %s", c.Path, c.Kind, c.New)
+	case c.New == "":
+		return fmt.Sprintf("%s: %s: %s", c.Path, c.Kind, c.Old)
+	}
+	return fmt.Sprintf("%s: %s: %s -> %s", c.Path, c.Kind, c.Old, c.New)
+}
+
+// Diff compare the trees of the templates and returns the semantic changes.
+// The differences of the whitespaces and the order of the attributes and
+// the classes are ignored.
+func Diff(old, new *Template) []*Change {
+	var changes []*Change
+	diffChildren(&changes, "", old.root, new.root)
+	return changes
+}
+
+// nodeLabel returns the label of the node used in the path.
+func nodeLabel(n *Node) string {
+	switch {
+	case n.Name != "":
+		if n.ID != "" {
+			return n.Name + "#" + n.ID
+		}
+		return n.Name
+	case n.Expr != "":
+		if f := strings.Fields(n.Expr); len(f) > 0 {
+			return "- " + f[0]
+		}
+		return "-"
+	}
+	return "|"
+}
+
+func normalize(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func diffChildren(changes *[]*Change, path string, old, new *Node) {
+	a, b := old.Children, new.Children
+	// longest common subsequence of the labels
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if nodeLabel(a[i]) == nodeLabel(b[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	labels := map[string]int{}
+	for _, c := range b {
+		labels[nodeLabel(c)]++
+	}
+	seen := map[string]int{}
+	childPath := func(n *Node) string {
+		label := nodeLabel(n)
+		seen[label]++
+		if labels[label] > 1 {
+			label = fmt.Sprintf("%s[%d]", label, seen[label])
+		}
+		if path == "" {
+			return label
+		}
+		return path + " > " + label
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && nodeLabel(a[i]) == nodeLabel(b[j]):
+			diffNode(changes, childPath(b[j]), a[i], b[j])
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			*changes = append(*changes, &Change{Path: childPath(b[j]), Kind: "added node", Line: b[j].Line})
+			j++
+		default:
+			p := nodeLabel(a[i])
+			if path != "" {
+				p = path + " > " + p
+			}
+			*changes = append(*changes, &Change{Path: p, Kind: "removed node", Line: a[i].Line})
+			i++
+		}
+	}
+}
+
+func diffNode(changes *[]*Change, path string, old, new *Node) {
+	add := func(kind, o, n string) {
+		*changes = append(*changes, &Change{Path: path, Kind: kind, Old: o, New: n, Line: new.Line})
+	}
+	oattrs, nattrs := map[string]string{}, map[string]string{}
+	for _, a := range old.Attr {
+		oattrs[a.Name] = normalize(a.Value)
+	}
+	for _, a := range new.Attr {
+		nattrs[a.Name] = normalize(a.Value)
+	}
+	var names []string
+	for name := range oattrs {
+		names = append(names, name)
+	}
+	for name := range nattrs {
+		if _, ok := oattrs[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		o, ook := oattrs[name]
+		n, nok := nattrs[name]
+		switch {
+		case !ook:
+			add("added attribute", "", name+"="+n)
+		case !nok:
+			add("removed attribute", name+"="+o, "")
+		case o != n:
+			add("changed attribute "+name, o, n)
+		}
+	}
+	oclass := append([]string(nil), old.Class...)
+	nclass := append([]string(nil), new.Class...)
+	sort.Strings(oclass)
+	sort.Strings(nclass)
+	if o, n := strings.Join(oclass, " "), strings.Join(nclass, " "); o != n {
+		add("changed class", o, n)
+	}
+	if o, n := normalize(old.Expr), normalize(new.Expr); o != n {
+		add("changed expression", o, n)
+	}
+	if o, n := normalize(old.Text), normalize(new.Text); o != n {
+		add("changed text", o, n)
+	}
+	if old.Raw != new.Raw {
+		add("changed escaping", fmt.Sprint(!old.Raw), fmt.Sprint(!new.Raw))
+	}
+	diffChildren(changes, path, old, new)
+	oelse, nelse := old.Else, new.Else
+	switch {
+	case oelse == nil && nelse != nil:
+		add("added else", "", "")
+	case oelse != nil && nelse == nil:
+		add("removed else", "", "")
+	case oelse != nil:
+		diffChildren(changes, path+" > - else", oelse, nelse)
+	}
+}
@@ -0,0 +1,52 @@
+package slim
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old, err := Parse(strings.NewReader(`
+html
+  body
+    p id="x" title="t" = user.name
+    p  hello   world
+    div.a.b
+    ul
+      - for x in items
+        li = x
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := Parse(strings.NewReader(`
+html
+  body
+    p title="t" data-id="1" = user.full_name
+    p hello world
+    div.b.a
+    h2 new
+    ul
+      - for x in items
+        li = x
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range Diff(old, new) {
+		got = append(got, c.String())
+	}
+	expect := []string{
+		"html > body > p[1]: added attribute: data-id=1",
+		"html > body > p[1]: removed attribute: id=x",
+		"html > body > p[1]: changed expression: user.name -> user.full_name",
+		"html > body > h2: added node",
+	}
+	if strings.Join(got, "\n") != strings.Join(expect, "\n") {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+	if changes := Diff(old, old); len(changes) != 0 {
+		t.Fatalf("expected no changes but %v", changes)
+	}
+}
@@ -0,0 +1,64 @@
+package slim
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// doctypes is the declarations of the variants of "doctype". The variants
+// except html and 5 are XHTML.
+var doctypes = map[string]string{
+	"html":         "<!doctype html>",
+	"5":            "<!doctype html>",
+	"transitional": `<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">`,
+	"strict":       `<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd">`,
+	"frameset":     `<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Frameset//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-frameset.dtd">`,
+	"1.1":          `<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.1//EN" "http://www.w3.org/TR/xhtml11/DTD/xhtml11.dtd">`,
+	"basic":        `<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML Basic 1.1//EN" "http://www.w3.org/TR/xhtml-basic/xhtml-basic11.dtd">`,
+	"mobile":       `<!DOCTYPE html PUBLIC "-//WAPFORUM//DTD XHTML Mobile 1.2//EN" "http://www.openmobilealliance.org/tech/DTD/xhtml-mobile12.dtd">`,
+}
+
+type xhtmlKey struct{}
+
+// isXHTML returns true if the document has the doctype of XHTML, so the
+// empty elements are closed like "<br />".
+func isXHTML(v *vm.VM) bool {
+	on, _ := v.Context().Value(xhtmlKey{}).(bool)
+	return on
+}
+
+// printDoctype write the declaration of "doctype". "doctype xml" writes the
+// XML declaration with the encoding like "doctype xml ISO-8859-1". The
+// doctypes except html and 5 turn the XHTML mode on for the rest of the
+// document.
+func printDoctype(out io.Writer, v *vm.VM, n *Node, indent int) error {
+	fields := strings.Fields(n.Text)
+	name := "html"
+	if len(fields) > 0 {
+		name = strings.ToLower(fields[0])
+	}
+	var decl string
+	if name == "xml" {
+		encoding := "utf-8"
+		if len(fields) > 1 {
+			encoding = fields[1]
+		}
+		decl = `<?xml version="1.0" encoding="` + encoding + `" ?>`
+	} else {
+		var ok bool
+		if decl, ok = doctypes[name]; !ok || len(fields) > 1 {
+			return fmt.Errorf("line %d: unknown doctype: %s", n.Line, n.Text)
+		}
+	}
+	if name != "html" && name != "5" {
+		v.SetContext(context.WithValue(v.Context(), xhtmlKey{}, true))
+	}
+	writeIndent(out, v, indent)
+	_, err := io.WriteString(out, decl)
+	writeNewLine(out, v)
+	return err
+}
@@ -0,0 +1,33 @@
+// Package echoslim provides the echo.Renderer of the templates of go-slim.
+//
+//	e := echo.New()
+//	e.Renderer = echoslim.New(set)
+//	e.GET("/", func(c echo.Context) error {
+//		return c.Render(http.StatusOK, "index", data)
+//	})
+package echoslim
+
+import (
+	"io"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mattn/go-slim"
+)
+
+// Renderer is the echo.Renderer which renders the templates in the set.
+type Renderer struct {
+	set *slim.TemplateSet
+}
+
+var _ echo.Renderer = (*Renderer)(nil)
+
+// New create the renderer of the templates in s.
+func New(s *slim.TemplateSet) *Renderer {
+	return &Renderer{set: s}
+}
+
+// Render render the template named name with data. The rendering is
+// cancelled when the request is done.
+func (r *Renderer) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
+	return r.set.RenderContext(c.Request().Context(), w, name, data)
+}
@@ -0,0 +1,40 @@
+package echoslim
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mattn/go-slim"
+)
+
+func TestRender(t *testing.T) {
+	set := slim.NewTemplateSet(nil)
+	if err := set.AddRaw("index", "p = name\n"); err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.Renderer = New(set)
+	e.GET("/", func(c echo.Context) error {
+		return c.Render(http.StatusOK, "index", slim.Values{"name": "<slim>"})
+	})
+	e.GET("/missing", func(c echo.Context) error {
+		return c.Render(http.StatusOK, "missing", nil)
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	if expect := "<p>&lt;slim&gt;</p>\n"; rec.Body.String() != expect {
+		t.Fatalf("expected %q but %q", expect, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+}
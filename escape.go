@@ -0,0 +1,189 @@
+package slim
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// HTML is the string which is safe as HTML. The values of HTML are not
+// escaped in the texts and the attributes.
+type HTML string
+
+// JS is the string which is safe as javascript. The values of JS are not
+// escaped in the script element and the event handlers like onclick.
+type JS string
+
+// CSS is the string which is safe as CSS. The values of CSS are not escaped
+// in the style element and the style attribute.
+type CSS string
+
+// URL is the string which is safe as URL. The values of URL are not filtered
+// in the URL attributes like href and src.
+type URL string
+
+func init() {
+	RegisterGlobalFunc("raw", Raw)
+}
+
+// Raw is builtin function provide raw(s). It returns s as HTML, so it is not
+// escaped.
+func Raw(args ...Value) (Value, error) {
+	if len(args) != 1 {
+		return nil, errors.New("raw require 1 argument")
+	}
+	if s, ok := args[0].(HTML); ok {
+		return s, nil
+	}
+	return HTML(fmt.Sprint(args[0])), nil
+}
+
+// unsafeURL is the value of the URL which has the unsafe scheme like
+// "javascript:". It is same as html/template.
+const unsafeURL = "#ZgotmplZ"
+
+// unsafeCSS is the value of the unsafe CSS.
+const unsafeCSS = "ZgotmplZ"
+
+// urlAttrs is the attributes which have the URL.
+var urlAttrs = map[string]bool{
+	"action":     true,
+	"background": true,
+	"cite":       true,
+	"formaction": true,
+	"href":       true,
+	"icon":       true,
+	"poster":     true,
+	"src":        true,
+	"xlink:href": true,
+}
+
+// escapeValue returns the escaped string of the values except HTML.
+func escapeValue(value interface{}) string {
+	if s, ok := value.(HTML); ok {
+		return string(s)
+	}
+	return html.EscapeString(fmt.Sprint(value))
+}
+
+// escapeJS returns the value as the literal of javascript. The characters
+// which can close the script like "</script>" are escaped.
+func escapeJS(value interface{}) string {
+	if s, ok := value.(JS); ok {
+		return string(s)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if err := enc.Encode(value); err != nil {
+		return "null"
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// escapeURL returns the escaped string of the value in the URL. The value at
+// the beginning of the URL is filtered if it has the unsafe scheme, and the
+// value in the query or the fragment is escaped as the component.
+func escapeURL(prefix string, value interface{}) string {
+	if s, ok := value.(URL); ok {
+		return html.EscapeString(string(s))
+	}
+	s := fmt.Sprint(value)
+	if strings.ContainsAny(prefix, "?#") {
+		return html.EscapeString(url.QueryEscape(s))
+	}
+	if prefix == "" && !safeURL(s) {
+		return unsafeURL
+	}
+	return html.EscapeString(normalizeURL(s))
+}
+
+// escapeCSS returns the escaped string of the value in CSS. The value which
+// has the characters except the alphanumerics, the spaces and "#%,-._" is
+// replaced with "ZgotmplZ", so it can't break out the declaration. The
+// values of CSS are returned as is like escapeJS, so escape the result as
+// HTML in the style attribute.
+func escapeCSS(value interface{}) string {
+	if s, ok := value.(CSS); ok {
+		return string(s)
+	}
+	s := fmt.Sprint(value)
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune(" #%,-._", r)) {
+			return unsafeCSS
+		}
+	}
+	return s
+}
+
+// safeURL returns true if s is relative, or has the scheme http, https,
+// mailto or tel.
+func safeURL(s string) bool {
+	i := strings.IndexAny(s, ":/?#")
+	if i < 0 || s[i] != ':' {
+		return true
+	}
+	switch strings.ToLower(s[:i]) {
+	case "http", "https", "mailto", "tel":
+		return true
+	}
+	return false
+}
+
+// normalizeURL percent-encode the characters which are not allowed in the
+// URL, like the spaces and the quotes.
+func normalizeURL(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`"'<>\^`+"`{|}", c) >= 0 {
+			fmt.Fprintf(&sb, "%%%02X", c)
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// attrInline evaluate #{} in the value of a, and escape them with the
+// context of the attribute: javascript for the event handlers like onclick,
+// URL for href and src, CSS for style, and HTML for others.
+func attrInline(v *vm.VM, a Attr) (string, error) {
+	var sb strings.Builder
+	ow := NewOutputWriter(&sb)
+	err := eachInline(v, a.Value, ow.WriteRaw, func(value interface{}) error {
+		return writeEscapedAttr(ow, a.Name, sb.String(), value)
+	})
+	return sb.String(), err
+}
+
+// textInline evaluate #{} in the text of n, and escape them with the
+// context of n.
+func textInline(v *vm.VM, n *Node) (string, error) {
+	return interpolate(v, n.Text, func(_ string, value interface{}) string {
+		return escapeNodeValue(n, value)
+	})
+}
+
+// escapeNodeValue escape the value in n. The values in the script are
+// escaped as javascript, and the values in the style are escaped as CSS.
+func escapeNodeValue(n *Node, value interface{}) string {
+	return escapeElemValue(n.Name, value)
+}
+
+// escapeElemValue escape the value in the text of the element named name.
+// It is shared by the elements and the filters rendered as them.
+func escapeElemValue(name string, value interface{}) string {
+	switch name {
+	case "script":
+		return escapeJS(value)
+	case "style":
+		return escapeCSS(value)
+	}
+	return escapeValue(value)
+}
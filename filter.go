@@ -0,0 +1,47 @@
+package slim
+
+import (
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// Filter transform the body of the filter block like "sass:" to HTML at the
+// render time. The body is dedented and #{} in it is evaluated before.
+type Filter func(body string) (string, error)
+
+var filters = struct {
+	sync.RWMutex
+	m map[string]Filter
+}{m: make(map[string]Filter)}
+
+// RegisterFilter register the filter which all templates can use. Renderers
+// registered with RegisterRenderer take precedence over filters.
+func RegisterFilter(name string, f Filter) {
+	filters.Lock()
+	defer filters.Unlock()
+	filters.m[name] = f
+}
+
+func lookupFilter(name string) (Renderer, bool) {
+	filters.RLock()
+	f, ok := filters.m[name]
+	filters.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return func(out io.Writer, n *Node, v *vm.VM) error {
+		text, err := rubyInline(v, n.Text)
+		if err != nil {
+			return err
+		}
+		s, err := f(dedent(text))
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(out, strings.TrimSpace(s)+"\n")
+		return err
+	}, true
+}
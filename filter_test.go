@@ -0,0 +1,85 @@
+package slim
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRegisterFilter(t *testing.T) {
+	RegisterFilter("test_shout", func(body string) (string, error) {
+		return "<p>" + strings.ToUpper(body) + "</p>", nil
+	})
+	RegisterFilter("test_fail", func(body string) (string, error) {
+		return "", errors.New("fail")
+	})
+	tmpl, err := Parse(strings.NewReader(`
+div
+  test_shout:
+    hello #{name}
+  p end
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"name": "golang",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <p>HELLO GOLANG</p>\n  <p>end</p>\n</div>\n"
+	got := buf.String()
+	if expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+
+	tmpl, err = Parse(strings.NewReader("test_fail:\n  x\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tmpl.Execute(&buf, nil); err == nil {
+		t.Fatal("expected error but nil")
+	}
+}
+
+func TestGoTemplate(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  p = name
+  gotemplate:
+    <ul>{{range .items}}<li>{{greet .}}</li>{{end}}</ul>
+  p end
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.FuncMap(Funcs{
+		"greet": func(args ...Value) (Value, error) {
+			return "Hello " + args[0].(string), nil
+		},
+	})
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"name":  "golang",
+		"items": []string{"<a>", "b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <p>golang</p>\n  <ul><li>Hello &lt;a&gt;</li><li>Hello b</li></ul>\n  <p>end</p>\n</div>\n"
+	got := buf.String()
+	if expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+
+	tmpl, err = Parse(strings.NewReader("gotemplate:\n  {{.x\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpl.Execute(&buf, nil); err == nil {
+		t.Fatal("should be error")
+	}
+}
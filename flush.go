@@ -0,0 +1,67 @@
+package slim
+
+import (
+	"io"
+	"net/http"
+)
+
+// SetFlushThreshold set the number of the bytes after which the output is
+// flushed, if the writer is http.Flusher like http.ResponseWriter. It sends
+// the early part of the large page to the client before the rendering is
+// done. Zero means flushing only at "- flush". It is ignored in the buffered
+// mode.
+func (t *Template) SetFlushThreshold(n int) {
+	t.flushThreshold = n
+}
+
+// flushWriter calls Flush of w when the written bytes exceed the threshold.
+type flushWriter struct {
+	w         io.Writer
+	f         http.Flusher
+	threshold int
+	pending   int
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.pending += n
+	if err == nil && fw.threshold > 0 && fw.pending >= fw.threshold {
+		fw.Flush()
+	}
+	return n, err
+}
+
+// Flush flush the output written so far.
+func (fw *flushWriter) Flush() {
+	fw.pending = 0
+	fw.f.Flush()
+}
+
+// flusher returns the writer which flushes out at the threshold.
+func (t *Template) flusher(out io.Writer) io.Writer {
+	f, ok := out.(http.Flusher)
+	if !ok || t.flushThreshold <= 0 {
+		return out
+	}
+	return &flushWriter{w: out, f: f, threshold: t.flushThreshold}
+}
+
+// printFlush flush the output for "- flush". It does nothing if out is not
+// http.Flusher, like in the buffered mode or in the partials rendered by
+// include.
+func printFlush(out io.Writer) {
+	if f, ok := out.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// SetFlushThreshold set the number of the bytes after which the output of
+// the templates in the set is flushed.
+func (s *TemplateSet) SetFlushThreshold(n int) {
+	s.mu.Lock()
+	s.flushThreshold = n
+	s.mu.Unlock()
+	s.cache.each(func(t *Template) {
+		t.flushThreshold = n
+	})
+}
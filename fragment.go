@@ -0,0 +1,80 @@
+package slim
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// fragments is the collector of the named fragments of ExecuteFragments.
+type fragments struct {
+	mu     sync.Mutex
+	values map[string]interface{}
+}
+
+type fragmentsKey struct{}
+
+func (f *fragments) set(name string, value interface{}) {
+	f.mu.Lock()
+	f.values[name] = value
+	f.mu.Unlock()
+}
+
+// ExecuteFragments render t with value, and returns the named fragments for
+// the JSON APIs, like {"rows_html": "...", "count": 12}. The output of each
+// "block name" is the fragment of the name, and "- json name = expr" adds
+// the value of expr. The blocks are rendered as usual in Execute, and
+// "- json" is ignored.
+func (t *Template) ExecuteFragments(ctx context.Context, value interface{}) (map[string]interface{}, error) {
+	f := &fragments{values: map[string]interface{}{}}
+	ctx = context.WithValue(ctx, fragmentsKey{}, f)
+	if err := t.ExecuteContext(ctx, io.Discard, value); err != nil {
+		return nil, err
+	}
+	return f.values, nil
+}
+
+// printFragment render the block n to out, and record the output as the
+// fragment if it is in ExecuteFragments.
+func printFragment(out io.Writer, v *vm.VM, n *Node, f func(out io.Writer) error) error {
+	fr, ok := v.Context().Value(fragmentsKey{}).(*fragments)
+	if !ok {
+		return f(out)
+	}
+	var buf bytes.Buffer
+	if err := withWriter(v, &buf, func() error { return f(&buf) }); err != nil {
+		return err
+	}
+	fr.set(strings.TrimSpace(n.Text), buf.String())
+	_, err := out.Write(buf.Bytes())
+	return err
+}
+
+// jsonDirective is the directive "- json name = expr" which adds the value
+// to the fragments of ExecuteFragments.
+func jsonDirective(v *vm.VM, d *vm.DirectiveExpr) error {
+	fr, ok := v.Context().Value(fragmentsKey{}).(*fragments)
+	if !ok {
+		return nil
+	}
+	r, err := v.Eval(d.RHS)
+	if err != nil {
+		return err
+	}
+	fr.set(d.LHS, r)
+	return nil
+}
+
+// RenderFragments render the template named name with value, and returns
+// the named fragments. See Template.ExecuteFragments.
+func (s *TemplateSet) RenderFragments(ctx context.Context, name string, value interface{}) (map[string]interface{}, error) {
+	t, err := s.load(name)
+	if err != nil {
+		return nil, err
+	}
+	return t.ExecuteFragments(ctx, value)
+}
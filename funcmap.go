@@ -0,0 +1,135 @@
+package slim
+
+import (
+	"fmt"
+	"html/template"
+	"reflect"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// FromFuncMap returns the function map of m, which is the function map of
+// html/template, so the existing helpers can be used in the templates
+// without changes. The functions are called with the arguments converted to
+// the types of the parameters, the variadic parameters are supported. The
+// results of template.HTML, template.JS, template.CSS and template.URL are
+// trusted as HTML, JS, CSS and URL of slim, and vice versa for the
+// arguments. Like html/template, the functions must return one value, or two
+// values which the second is error, and the panics are returned as error.
+func FromFuncMap(m template.FuncMap) (Funcs, error) {
+	fm := make(Funcs, len(m))
+	for name, f := range m {
+		fn, err := wrapFunc(name, f)
+		if err != nil {
+			return nil, err
+		}
+		fm[name] = fn
+	}
+	return fm, nil
+}
+
+// wrapFunc returns f as Func.
+func wrapFunc(name string, f interface{}) (Func, error) {
+	switch fn := f.(type) {
+	case Func:
+		return fn, nil
+	case func(...Value) (Value, error):
+		return fn, nil
+	}
+	rf := reflect.ValueOf(f)
+	if rf.Kind() != reflect.Func {
+		return nil, fmt.Errorf("%s: value is not a function: %T", name, f)
+	}
+	rt := rf.Type()
+	if !(rt.NumOut() == 1 || rt.NumOut() == 2 && rt.Out(1) == errorType) {
+		return nil, fmt.Errorf("%s: function must return 1 value, or 2 values with error: %v", name, rt)
+	}
+	return func(args ...Value) (ret Value, err error) {
+		in, err := funcArgs(rt, args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				ret, err = nil, fmt.Errorf("error calling %s: %v", name, r)
+			}
+		}()
+		rets := rf.Call(in)
+		if len(rets) == 2 && !rets[1].IsNil() {
+			return nil, rets[1].Interface().(error)
+		}
+		return fromTemplateValue(rets[0].Interface()), nil
+	}, nil
+}
+
+// funcArgs returns args converted to the parameters of the function typed rt.
+func funcArgs(rt reflect.Type, args []Value) ([]reflect.Value, error) {
+	n := rt.NumIn()
+	if rt.IsVariadic() {
+		if len(args) < n-1 {
+			return nil, fmt.Errorf("require at least %d arguments but %d", n-1, len(args))
+		}
+	} else if len(args) != n {
+		return nil, fmt.Errorf("require %d arguments but %d", n, len(args))
+	}
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var pt reflect.Type
+		if rt.IsVariadic() && i >= n-1 {
+			pt = rt.In(n - 1).Elem()
+		} else {
+			pt = rt.In(i)
+		}
+		rv, ok := convertArg(arg, pt)
+		if !ok {
+			return nil, fmt.Errorf("argument %d must be %v but %T", i+1, pt, arg)
+		}
+		in[i] = rv
+	}
+	return in, nil
+}
+
+// safeTypes is the pairs of the trusted types of slim and html/template.
+var safeTypes = map[reflect.Type]reflect.Type{
+	reflect.TypeOf(HTML("")): reflect.TypeOf(template.HTML("")),
+	reflect.TypeOf(JS("")):   reflect.TypeOf(template.JS("")),
+	reflect.TypeOf(CSS("")):  reflect.TypeOf(template.CSS("")),
+	reflect.TypeOf(URL("")):  reflect.TypeOf(template.URL("")),
+}
+
+// convertArg returns value as pt. The numbers are converted because integer
+// literals are int64 in templates. The strings are converted to string, or
+// to the trusted type of html/template only if value is the same one of
+// slim, so the untrusted strings are not passed as trusted. It returns false
+// if value cannot be converted.
+func convertArg(value interface{}, pt reflect.Type) (reflect.Value, bool) {
+	if value == nil {
+		return reflect.Zero(pt), true
+	}
+	rv := reflect.ValueOf(value)
+	switch {
+	case rv.Type().AssignableTo(pt):
+		return rv, true
+	case isNumber(rv.Kind()) && isNumber(pt.Kind()):
+		return rv.Convert(pt), true
+	case rv.Kind() == reflect.String && (pt == reflect.TypeOf("") || safeTypes[rv.Type()] == pt):
+		return rv.Convert(pt), true
+	}
+	return reflect.Value{}, false
+}
+
+// fromTemplateValue returns the trusted value of html/template as the one of
+// slim.
+func fromTemplateValue(value interface{}) interface{} {
+	switch s := value.(type) {
+	case template.HTML:
+		return HTML(s)
+	case template.JS:
+		return JS(s)
+	case template.CSS:
+		return CSS(s)
+	case template.URL:
+		return URL(s)
+	}
+	return value
+}
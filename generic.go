@@ -0,0 +1,126 @@
+package slim
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// func0 and others are the call shims of the functions which implement
+// vm.Caller, so the functions are called without reflect.Call.
+type (
+	func0[R any]             func() R
+	func1[T1, R any]         func(T1) R
+	func2[T1, T2, R any]     func(T1, T2) R
+	func3[T1, T2, T3, R any] func(T1, T2, T3) R
+)
+
+func (f func0[R]) Call(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0); err != nil {
+		return nil, err
+	}
+	return f(), nil
+}
+
+func (f func1[T1, R]) Call(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1); err != nil {
+		return nil, err
+	}
+	a1, err := argAs[T1](args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return f(a1), nil
+}
+
+func (f func2[T1, T2, R]) Call(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2); err != nil {
+		return nil, err
+	}
+	a1, err := argAs[T1](args, 0)
+	if err != nil {
+		return nil, err
+	}
+	a2, err := argAs[T2](args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return f(a1, a2), nil
+}
+
+func (f func3[T1, T2, T3, R]) Call(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 3); err != nil {
+		return nil, err
+	}
+	a1, err := argAs[T1](args, 0)
+	if err != nil {
+		return nil, err
+	}
+	a2, err := argAs[T2](args, 1)
+	if err != nil {
+		return nil, err
+	}
+	a3, err := argAs[T3](args, 2)
+	if err != nil {
+		return nil, err
+	}
+	return f(a1, a2, a3), nil
+}
+
+func checkArgs(args []interface{}, n int) error {
+	if len(args) != n {
+		return fmt.Errorf("require %d arguments but %d", n, len(args))
+	}
+	return nil
+}
+
+// argAs returns i-th argument as T. Numbers are converted because integer
+// literals are int64 and float literals are float64 in templates.
+func argAs[T any](args []interface{}, i int) (T, error) {
+	if a, ok := args[i].(T); ok {
+		return a, nil
+	}
+	var zero T
+	if args[i] == nil {
+		return zero, nil
+	}
+	rt := reflect.TypeOf(&zero).Elem()
+	rv := reflect.ValueOf(args[i])
+	if isNumber(rt.Kind()) && isNumber(rv.Kind()) {
+		return rv.Convert(rt).Interface().(T), nil
+	}
+	return zero, fmt.Errorf("argument %d must be %v but %T", i+1, rt, args[i])
+}
+
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// RegisterFunc0 is same as RegisterGlobalFunc but f is called without
+// reflection.
+func RegisterFunc0[R any](name string, f func() R) {
+	RegisterGlobalFunc(name, func0[R](f))
+}
+
+// RegisterFunc1 is same as RegisterGlobalFunc but f is called without
+// reflection. The signature of f is checked at compile time.
+func RegisterFunc1[T1, R any](name string, f func(T1) R) {
+	RegisterGlobalFunc(name, func1[T1, R](f))
+}
+
+// RegisterFunc2 is same as RegisterFunc1 but for the function which takes 2
+// arguments.
+func RegisterFunc2[T1, T2, R any](name string, f func(T1, T2) R) {
+	RegisterGlobalFunc(name, func2[T1, T2, R](f))
+}
+
+// RegisterFunc3 is same as RegisterFunc1 but for the function which takes 3
+// arguments.
+func RegisterFunc3[T1, T2, T3, R any](name string, f func(T1, T2, T3) R) {
+	RegisterGlobalFunc(name, func3[T1, T2, T3, R](f))
+}
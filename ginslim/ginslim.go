@@ -0,0 +1,85 @@
+// Package ginslim provides the render.HTMLRender of gin for the templates of
+// go-slim.
+//
+//	r := gin.New()
+//	r.HTMLRender = ginslim.New(set)
+//	r.GET("/", func(c *gin.Context) {
+//		c.HTML(http.StatusOK, "index", data)
+//	})
+//
+// The render.HTMLRender of gin doesn't take the request, so c.HTML renders the
+// templates without the context of the request. Use HTMLRender.HTML to cancel
+// the rendering with the request.
+//
+//	render := ginslim.New(set)
+//	r.GET("/", func(c *gin.Context) {
+//		render.HTML(c, http.StatusOK, "index", data)
+//	})
+package ginslim
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"github.com/mattn/go-slim"
+)
+
+// HTMLRender is the render.HTMLRender which renders the templates in the set.
+type HTMLRender struct {
+	set *slim.TemplateSet
+}
+
+var _ render.HTMLRender = (*HTMLRender)(nil)
+
+// New create the renderer of the templates in s.
+func New(s *slim.TemplateSet) *HTMLRender {
+	return &HTMLRender{set: s}
+}
+
+// Instance returns the render of the template named name with data.
+func (r *HTMLRender) Instance(name string, data interface{}) render.Render {
+	return r.InstanceContext(context.Background(), name, data)
+}
+
+// InstanceContext is same as Instance but the rendering is cancelled when ctx
+// is done.
+func (r *HTMLRender) InstanceContext(ctx context.Context, name string, data interface{}) render.Render {
+	return &HTML{set: r.set, ctx: ctx, name: name, data: data}
+}
+
+// HTML render the template named name with data to c, with the context of
+// the request.
+func (r *HTMLRender) HTML(c *gin.Context, code int, name string, data interface{}) {
+	c.Render(code, r.InstanceContext(c.Request.Context(), name, data))
+}
+
+// HTML is the render.Render of the template.
+type HTML struct {
+	set  *slim.TemplateSet
+	ctx  context.Context
+	name string
+	data interface{}
+}
+
+// Render render the template to w. The output is buffered, so nothing is
+// written if the rendering fails.
+func (h *HTML) Render(w http.ResponseWriter) error {
+	h.WriteContentType(w)
+	var buf bytes.Buffer
+	if err := h.set.RenderContext(h.ctx, &buf, h.name, h.data); err != nil {
+		return err
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// WriteContentType set the Content-Type of the response.
+func (h *HTML) WriteContentType(w http.ResponseWriter) {
+	header := w.Header()
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", slim.DefaultContentType)
+	}
+}
@@ -0,0 +1,77 @@
+package ginslim
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mattn/go-slim"
+)
+
+func TestRender(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	set := slim.NewTemplateSet(nil)
+	if err := set.AddRaw("index", "p = name\n"); err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.HTMLRender = New(set)
+	r.GET("/", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "index", slim.Values{"name": "<slim>"})
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != slim.DefaultContentType {
+		t.Fatalf("unexpected content type: %v", ct)
+	}
+	if expect := "<p>&lt;slim&gt;</p>\n"; rec.Body.String() != expect {
+		t.Fatalf("expected %q but %q", expect, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	if err := New(set).Instance("missing", nil).Render(rec); err == nil {
+		t.Fatal("should be fail")
+	}
+	if rec.Body.Len() > 0 {
+		t.Fatalf("nothing should be written: %q", rec.Body.String())
+	}
+}
+
+type userKey struct{}
+
+func TestRenderContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	set := slim.NewTemplateSet(nil)
+	if err := set.AddRaw("index", "p = user()\n"); err != nil {
+		t.Fatal(err)
+	}
+	values := slim.Values{
+		"user": func(ctx context.Context) interface{} { return ctx.Value(userKey{}) },
+	}
+	render := New(set)
+	r := gin.New()
+	r.HTMLRender = render
+	r.GET("/", func(c *gin.Context) {
+		render.HTML(c, http.StatusOK, "index", values)
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.ServeHTTP(rec, req.WithContext(context.WithValue(req.Context(), userKey{}, "mattn")))
+	if expect := "<p>mattn</p>\n"; rec.Body.String() != expect {
+		t.Fatalf("expected %q but %q", expect, rec.Body.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec = httptest.NewRecorder()
+	if err := render.InstanceContext(ctx, "index", values).Render(rec); err == nil {
+		t.Fatal("should be fail")
+	}
+}
@@ -0,0 +1,38 @@
+package slim
+
+import (
+	"context"
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+type dataKey struct{}
+
+// withData returns ctx which has the value passed to Execute.
+func withData(ctx context.Context, value interface{}) context.Context {
+	return context.WithValue(ctx, dataKey{}, value)
+}
+
+// gotemplateRenderer execute the block with html/template, for the files
+// migrating from html/template. The dot is the value passed to Execute, and
+// the functions of FuncMap are available. The variables of slim like the
+// loop variables are not visible in the block.
+func (t *Template) gotemplateRenderer(out io.Writer, n *Node, v *vm.VM) error {
+	fm := template.FuncMap{}
+	for name, f := range t.fm {
+		fm[name] = f
+	}
+	tmpl, err := template.New(t.name).Funcs(fm).Parse(dedent(n.Text))
+	if err != nil {
+		return err
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, v.Context().Value(dataKey{})); err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, strings.TrimSpace(sb.String())+"\n")
+	return err
+}
@@ -0,0 +1,107 @@
+package slim
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// Segment is a byte range of the output. Line is the line number of the node
+// which emitted the dynamic segment.
+type Segment struct {
+	Start   int  `json:"start"`
+	End     int  `json:"end"`
+	Dynamic bool `json:"dynamic"`
+	Line    int  `json:"line,omitempty"`
+}
+
+// Heatmap is the report of which byte ranges of the output are static or
+// dynamically evaluated. It is useful to find parts which can be cached.
+type Heatmap struct {
+	Segments []Segment `json:"segments"`
+}
+
+// Static returns the number of the static bytes.
+func (h *Heatmap) Static() int {
+	return h.bytes(false)
+}
+
+// Dynamic returns the number of the dynamic bytes.
+func (h *Heatmap) Dynamic() int {
+	return h.bytes(true)
+}
+
+func (h *Heatmap) bytes(dynamic bool) int {
+	n := 0
+	for _, s := range h.Segments {
+		if s.Dynamic == dynamic {
+			n += s.End - s.Start
+		}
+	}
+	return n
+}
+
+// ExecuteHeatmap is same as ExecuteContext but reports the heatmap of the
+// output. It is slower than ExecuteContext, so use it only for debugging.
+func (t *Template) ExecuteHeatmap(ctx context.Context, out io.Writer, value interface{}) (*Heatmap, error) {
+	hw := &heatWriter{w: out}
+	err := t.ExecuteContext(ctx, hw, value)
+	return &Heatmap{Segments: hw.segs}, err
+}
+
+// heatWriter records the segments written to w.
+type heatWriter struct {
+	w     io.Writer
+	off   int
+	depth int
+	line  int
+	segs  []Segment
+}
+
+func (hw *heatWriter) Write(p []byte) (int, error) {
+	n, err := hw.w.Write(p)
+	if n == 0 {
+		return n, err
+	}
+	dynamic := hw.depth > 0
+	line := 0
+	if dynamic {
+		line = hw.line
+	}
+	if l := len(hw.segs); l > 0 && hw.segs[l-1].Dynamic == dynamic && hw.segs[l-1].Line == line {
+		hw.segs[l-1].End += n
+	} else {
+		hw.segs = append(hw.segs, Segment{Start: hw.off, End: hw.off + n, Dynamic: dynamic, Line: line})
+	}
+	hw.off += n
+	return n, err
+}
+
+// markDynamic call f, and the writes to out in f are reported as dynamic if
+// out is the writer of ExecuteHeatmap.
+func markDynamic(out io.Writer, line int, f func() error) error {
+	hw, ok := out.(*heatWriter)
+	if !ok || hw.depth > 0 {
+		return f()
+	}
+	hw.depth++
+	hw.line = line
+	defer func() { hw.depth-- }()
+	return f()
+}
+
+// writeText write s to out. It is reported as dynamic if dynamic is true.
+func writeText(out io.Writer, line int, s string, dynamic bool) {
+	if !dynamic {
+		out.Write([]byte(s))
+		return
+	}
+	markDynamic(out, line, func() error {
+		_, err := out.Write([]byte(s))
+		return err
+	})
+}
+
+func hasInline(s string) bool {
+	return strings.Contains(s, "#{")
+}
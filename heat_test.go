@@ -0,0 +1,44 @@
+package slim
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestExecuteHeatmap(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  p hello
+  p = name
+  a href="/#{name}" link
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	h, err := tmpl.ExecuteHeatmap(context.Background(), &buf, Values{
+		"name": "golang",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	var dynamic []string
+	for _, s := range h.Segments {
+		if s.Dynamic {
+			dynamic = append(dynamic, out[s.Start:s.End])
+		}
+	}
+	expect := []string{"golang", ` href="/golang"`}
+	if strings.Join(dynamic, "|") != strings.Join(expect, "|") {
+		t.Fatalf("expected %q but %q", expect, dynamic)
+	}
+	if h.Static()+h.Dynamic() != len(out) {
+		t.Fatalf("expected %d bytes but %d", len(out), h.Static()+h.Dynamic())
+	}
+	if h.Segments[1].Line != 4 {
+		t.Fatalf("expected line 4 but %d", h.Segments[1].Line)
+	}
+}
@@ -0,0 +1,124 @@
+package slim
+
+import (
+	"io"
+	"strings"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// Tag is the element passed to the hooks. The hooks can change the
+// attributes in OnOpenTag before they are written.
+type Tag struct {
+	// Template is the name of the template.
+	Template string
+	// Name is the name of the element like "div".
+	Name string
+	// Attr is the attributes with the evaluated values. The id and the class
+	// are the first attributes if they are set.
+	Attr []Attr
+	// Node is the node of the element.
+	Node *Node
+}
+
+// Get returns the value of the attribute named name.
+func (tag *Tag) Get(name string) (string, bool) {
+	for _, a := range tag.Attr {
+		if a.Name == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// Set set the value of the attribute named name.
+func (tag *Tag) Set(name, value string) {
+	for i, a := range tag.Attr {
+		if a.Name == name {
+			tag.Attr[i].Value = value
+			return
+		}
+	}
+	tag.Attr = append(tag.Attr, Attr{Name: name, Value: value})
+}
+
+// Hooks is the hooks called while rendering the elements. The nil hooks are
+// not called.
+type Hooks struct {
+	// OnOpenTag is called before the start tag is written.
+	OnOpenTag func(tag *Tag) error
+	// OnText returns the text written in the element. tag is nil if the text
+	// is not in the element. The text is already escaped.
+	OnText func(tag *Tag, text string) (string, error)
+	// OnCloseTag is called before the end tag is written, or the end of the
+	// empty element.
+	OnCloseTag func(tag *Tag) error
+}
+
+// SetHooks set the hooks of the rendering. Templates rendered by render()
+// share the hooks of the parent.
+func (t *Template) SetHooks(h *Hooks) {
+	t.hooks = h
+}
+
+// openTag call OnOpenTag with the attributes of n, and write them.
+func (t *Template) openTag(out io.Writer, v *vm.VM, n *Node) (*Tag, error) {
+	tag := &Tag{
+		Template: t.name,
+		Name:     strings.TrimSuffix(n.Name, ":"),
+		Node:     n,
+	}
+	attrs, dynamic, err := evalAttrs(v, n)
+	if err != nil {
+		return nil, err
+	}
+	tag.Attr = escapedAttrs(attrs)
+	if settingsOf(v).testid {
+		if _, ok := tag.Get("data-testid"); !ok {
+			if id := t.testID(n); id != "" {
+				tag.Set("data-testid", id)
+			}
+		}
+	}
+	if t.hooks != nil && t.hooks.OnOpenTag != nil {
+		if err := t.hooks.OnOpenTag(tag); err != nil {
+			return nil, err
+		}
+	}
+	var sb strings.Builder
+	for _, a := range tag.Attr {
+		if a.Value == "" {
+			sb.WriteString(" " + a.Name)
+		} else {
+			sb.WriteString(" " + a.Name + `="` + a.Value + `"`)
+		}
+	}
+	writeText(out, n.Line, sb.String(), dynamic)
+	return tag, nil
+}
+
+// hookText returns the text of OnText.
+func (t *Template) hookText(tag *Tag, text string) (string, error) {
+	if t.hooks == nil || t.hooks.OnText == nil {
+		return text, nil
+	}
+	return t.hooks.OnText(tag, text)
+}
+
+// closeTag call OnCloseTag.
+func (t *Template) closeTag(tag *Tag) error {
+	if tag == nil || t.hooks == nil || t.hooks.OnCloseTag == nil {
+		return nil
+	}
+	return t.hooks.OnCloseTag(tag)
+}
+
+// SetHooks set the hooks of the templates in the set.
+func (s *TemplateSet) SetHooks(h *Hooks) {
+	s.mu.Lock()
+	s.hooks = h
+	s.mu.Unlock()
+	s.cache.each(func(t *Template) {
+		t.hooks = h
+	})
+}
@@ -0,0 +1,168 @@
+// Package hotspot provides an aggregator of the trace events of templates
+// which reports the slowest expressions and partials.
+//
+//	agg := hotspot.New()
+//	tmpl.SetTracer(agg)
+//	http.Handle("/debug/slim/hotspots", hotspot.Handler(agg))
+package hotspot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-slim"
+)
+
+// Entry is the statistics of an expression or a partial.
+type Entry struct {
+	Kind     string        `json:"kind"`
+	Template string        `json:"template"`
+	Line     int           `json:"line"`
+	Source   string        `json:"source"`
+	Count    int           `json:"count"`
+	Errors   int           `json:"errors"`
+	Total    time.Duration `json:"total"`
+	Max      time.Duration `json:"max"`
+}
+
+// Average returns the average duration of the entry.
+func (e *Entry) Average() time.Duration {
+	if e.Count == 0 {
+		return 0
+	}
+	return e.Total / time.Duration(e.Count)
+}
+
+// Report is the list of entries sorted by the total duration.
+type Report struct {
+	Since   time.Time `json:"since"`
+	Until   time.Time `json:"until"`
+	Entries []*Entry  `json:"entries"`
+}
+
+type key struct {
+	kind     slim.TraceKind
+	template string
+	line     int
+	source   string
+}
+
+// Aggregator is a slim.Tracer which aggregates the events.
+type Aggregator struct {
+	mu      sync.Mutex
+	since   time.Time
+	entries map[key]*Entry
+}
+
+// New create the aggregator.
+func New() *Aggregator {
+	return &Aggregator{
+		since:   time.Now(),
+		entries: make(map[key]*Entry),
+	}
+}
+
+// Trace implements slim.Tracer.
+func (a *Aggregator) Trace(e *slim.TraceEvent) {
+	k := key{e.Kind, e.Template, e.Line, e.Source}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry, ok := a.entries[k]
+	if !ok {
+		entry = &Entry{
+			Kind:     e.Kind.String(),
+			Template: e.Template,
+			Line:     e.Line,
+			Source:   e.Source,
+		}
+		a.entries[k] = entry
+	}
+	entry.Count++
+	if e.Err != nil {
+		entry.Errors++
+	}
+	entry.Total += e.Duration
+	if e.Duration > entry.Max {
+		entry.Max = e.Duration
+	}
+}
+
+// Report returns the top n entries. If n is zero or negative, returns all.
+func (a *Aggregator) Report(n int) *Report {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.report(n)
+}
+
+func (a *Aggregator) report(n int) *Report {
+	r := &Report{
+		Since:   a.since,
+		Until:   time.Now(),
+		Entries: make([]*Entry, 0, len(a.entries)),
+	}
+	for _, e := range a.entries {
+		c := *e
+		r.Entries = append(r.Entries, &c)
+	}
+	sort.Slice(r.Entries, func(i, j int) bool {
+		if r.Entries[i].Total != r.Entries[j].Total {
+			return r.Entries[i].Total > r.Entries[j].Total
+		}
+		return r.Entries[i].Count > r.Entries[j].Count
+	})
+	if n > 0 && len(r.Entries) > n {
+		r.Entries = r.Entries[:n]
+	}
+	return r
+}
+
+// Reset clear the aggregated entries.
+func (a *Aggregator) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.since = time.Now()
+	a.entries = make(map[key]*Entry)
+}
+
+// Run call f with the report of the top n entries every interval, and reset
+// the entries. It blocks until ctx is done.
+func (a *Aggregator) Run(ctx context.Context, interval time.Duration, n int, f func(*Report)) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			a.mu.Lock()
+			r := a.report(n)
+			a.since = time.Now()
+			a.entries = make(map[key]*Entry)
+			a.mu.Unlock()
+			f(r)
+		}
+	}
+}
+
+// Handler returns the handler which serves the report as JSON. The number
+// of entries can be given with the query parameter "n" (default 20).
+func Handler(a *Aggregator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := 20
+		if s := r.URL.Query().Get("n"); s != "" {
+			i, err := strconv.Atoi(s)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			n = i
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.Report(n))
+	})
+}
@@ -0,0 +1,87 @@
+package hotspot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-slim"
+)
+
+func TestAggregator(t *testing.T) {
+	tmpl, err := slim.Parse(strings.NewReader(`
+ul
+  - for x in items
+    li = slow(x)
+  li = fast()
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.FuncMap(slim.Funcs{
+		"slow": func(args ...slim.Value) (slim.Value, error) {
+			time.Sleep(time.Millisecond)
+			return args[0], nil
+		},
+		"fast": func(args ...slim.Value) (slim.Value, error) {
+			return "fast", nil
+		},
+	})
+	agg := New()
+	tmpl.SetTracer(agg)
+	for i := 0; i < 2; i++ {
+		var buf bytes.Buffer
+		err = tmpl.Execute(&buf, slim.Values{
+			"items": []int{1, 2, 3},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := agg.Report(1)
+	if len(r.Entries) != 1 {
+		t.Fatalf("expected %v but %v", 1, len(r.Entries))
+	}
+	e := r.Entries[0]
+	if e.Source != " slow(x)" || e.Line != 4 || e.Count != 6 || e.Kind != "expr" {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+
+	rec := httptest.NewRecorder()
+	Handler(agg).ServeHTTP(rec, httptest.NewRequest("GET", "/?n=5", nil))
+	var got Report
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Entries) != 3 {
+		t.Fatalf("expected %v but %v", 3, len(got.Entries))
+	}
+
+	agg.Reset()
+	if r := agg.Report(0); len(r.Entries) != 0 {
+		t.Fatalf("expected %v but %v", 0, len(r.Entries))
+	}
+}
+
+func TestRun(t *testing.T) {
+	agg := New()
+	agg.Trace(&slim.TraceEvent{Kind: slim.TracePartial, Source: "foo.slim", Duration: time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan *Report, 1)
+	go agg.Run(ctx, time.Millisecond, 10, func(r *Report) {
+		select {
+		case ch <- r:
+		default:
+		}
+	})
+	r := <-ch
+	cancel()
+	if len(r.Entries) != 1 || r.Entries[0].Kind != "partial" {
+		t.Fatalf("unexpected report: %+v", r)
+	}
+}
@@ -0,0 +1,66 @@
+package slim
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// DefaultContentType is the Content-Type of the responses rendered by
+// HTTPRenderer.
+const DefaultContentType = "text/html; charset=utf-8"
+
+// HTTPRenderer renders the templates in the set to http.ResponseWriter.
+// The output is buffered, so the response is not written at all if the
+// rendering fails, and the handler can respond the error instead.
+type HTTPRenderer struct {
+	set         *TemplateSet
+	contentType string
+	pool        sync.Pool
+}
+
+// NewHTTPRenderer create the renderer of the templates in s.
+func NewHTTPRenderer(s *TemplateSet) *HTTPRenderer {
+	return &HTTPRenderer{
+		set:         s,
+		contentType: DefaultContentType,
+		pool: sync.Pool{
+			New: func() interface{} { return new(bytes.Buffer) },
+		},
+	}
+}
+
+// SetContentType set the Content-Type of the responses.
+func (r *HTTPRenderer) SetContentType(contentType string) {
+	r.contentType = contentType
+}
+
+// Render render the template named name with data, and write it to w with
+// the status code.
+func (r *HTTPRenderer) Render(w http.ResponseWriter, name string, data interface{}, code int) error {
+	return r.RenderContext(context.Background(), w, name, data, code)
+}
+
+// RenderContext is same as Render but the rendering is cancelled when ctx is
+// done. Pass the context of the request. The hints recorded by "- cache" are
+// set to the headers like Cache-Control.
+func (r *HTTPRenderer) RenderContext(ctx context.Context, w http.ResponseWriter, name string, data interface{}, code int) error {
+	buf := r.pool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer r.pool.Put(buf)
+	ctx, hints := WithCacheHints(ctx)
+	if err := r.set.RenderContext(ctx, buf, name, data); err != nil {
+		return err
+	}
+	h := w.Header()
+	hints.SetHeader(h)
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", r.contentType)
+	}
+	h.Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(code)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,120 @@
+package slim
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPRenderer(t *testing.T) {
+	set := NewTemplateSet(MapLoader{
+		"index.slim": "p = name",
+		"bad.slim":   "p = missing()",
+	})
+	r := NewHTTPRenderer(set)
+
+	w := httptest.NewRecorder()
+	if err := r.Render(w, "index", Values{"name": "bob"}, http.StatusCreated); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected %d but %d", http.StatusCreated, w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != DefaultContentType {
+		t.Fatalf("expected %q but %q", DefaultContentType, got)
+	}
+	expect := "<p>bob</p>\n"
+	if got := w.Body.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+
+	w = httptest.NewRecorder()
+	if err := r.Render(w, "bad", nil, http.StatusOK); err == nil {
+		t.Fatal("expected error but not")
+	}
+	if w.Body.Len() != 0 || w.Header().Get("Content-Type") != "" {
+		t.Fatalf("expected nothing is written but %q", w.Body.String())
+	}
+}
+
+type flushRecorder struct {
+	bytes.Buffer
+	flushed []int
+}
+
+func (r *flushRecorder) Flush() {
+	r.flushed = append(r.flushed, r.Len())
+}
+
+func TestFlush(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  p head
+  - flush
+  p body
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var w flushRecorder
+	if err := tmpl.Execute(&w, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.flushed) != 1 || !strings.HasSuffix(w.String()[:w.flushed[0]], "<p>head</p>\n") {
+		t.Fatalf("expected flush after head but %v: %q", w.flushed, w.String())
+	}
+
+	tmpl.SetFlushThreshold(8)
+	w = flushRecorder{}
+	if err := tmpl.Execute(&w, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.flushed) < 3 {
+		t.Fatalf("expected flushes at threshold but %v", w.flushed)
+	}
+
+	tmpl.SetBuffered(true)
+	w = flushRecorder{}
+	if err := tmpl.Execute(&w, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.flushed) != 0 {
+		t.Fatalf("expected no flush in buffered mode but %v", w.flushed)
+	}
+}
+
+func TestCacheHints(t *testing.T) {
+	set := NewTemplateSet(MapLoader{
+		"index.slim":   "div\n  - cache ttl = 10m\n  - render(\"sidebar\")\n  p main\n",
+		"sidebar.slim": "div\n  - cache ttl = 5m\n  - cache vary = \"accept-language\"\n  p side\n",
+		"user.slim":    "div\n  - cache ttl = 1m\n  - cache scope = \"private\"\n  p me\n",
+	})
+	r := NewHTTPRenderer(set)
+
+	w := httptest.NewRecorder()
+	if err := r.Render(w, "index", nil, http.StatusOK); err != nil {
+		t.Fatal(err)
+	}
+	for key, expect := range map[string]string{
+		"Cache-Control":     "public, max-age=300",
+		"Surrogate-Control": "max-age=300",
+		"Vary":              "Accept-Language",
+	} {
+		if got := w.Header().Get(key); got != expect {
+			t.Fatalf("expected %s: %q but %q", key, expect, got)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	if err := r.Render(w, "user", nil, http.StatusOK); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "private, max-age=60" {
+		t.Fatalf("unexpected Cache-Control: %q", got)
+	}
+	if got := w.Header().Get("Surrogate-Control"); got != "" {
+		t.Fatalf("unexpected Surrogate-Control: %q", got)
+	}
+}
@@ -0,0 +1,104 @@
+package slim
+
+import (
+	"fmt"
+	"strings"
+)
+
+// applyTags remove the nodes excluded by "- ifdef FLAG" and "- ifndef FLAG"
+// with tags. The directive can have the children, or close the following
+// nodes with "- endif".
+func applyTags(n *Node, tags map[string]bool) error {
+	type cond struct {
+		line int
+		on   bool
+	}
+	var stack []cond
+	enabled := func() bool {
+		for _, c := range stack {
+			if !c.on {
+				return false
+			}
+		}
+		return true
+	}
+
+	children := n.Children[:0]
+	for _, c := range n.Children {
+		name, flag, ok := tagDirective(c)
+		if !ok {
+			if enabled() {
+				if err := applyTags(c, tags); err != nil {
+					return err
+				}
+				children = append(children, c)
+			}
+			continue
+		}
+		switch name {
+		case "endif":
+			if len(stack) == 0 {
+				return fmt.Errorf("line %d: unexpected endif", c.Line)
+			}
+			stack = stack[:len(stack)-1]
+		case "ifdef", "ifndef":
+			if flag == "" {
+				return fmt.Errorf("line %d: %s requires the flag", c.Line, name)
+			}
+			on := tags[flag] == (name == "ifdef")
+			if len(c.Children) == 0 {
+				stack = append(stack, cond{line: c.Line, on: on})
+				continue
+			}
+			if !on || !enabled() {
+				continue
+			}
+			if err := applyTags(c, tags); err != nil {
+				return err
+			}
+			children = append(children, c.Children...)
+		}
+	}
+	if len(stack) > 0 {
+		return fmt.Errorf("line %d: ifdef is not closed", stack[len(stack)-1].line)
+	}
+	n.Children = children
+	return nil
+}
+
+// tagDirective returns the name and the flag of the directive "- ifdef",
+// "- ifndef" or "- endif".
+func tagDirective(n *Node) (string, string, bool) {
+	if n.Name != "" || n.Expr == "" {
+		return "", "", false
+	}
+	fields := strings.Fields(n.Expr)
+	switch fields[0] {
+	case "ifdef", "ifndef", "endif":
+	default:
+		return "", "", false
+	}
+	if len(fields) > 2 || (fields[0] == "endif" && len(fields) > 1) {
+		return "", "", false
+	}
+	flag := ""
+	if len(fields) == 2 {
+		flag = fields[1]
+	}
+	return fields[0], flag, true
+}
+
+// SetTags set the build tags of the set like "debug". The nodes in
+// "- ifdef FLAG" are removed at the parse when FLAG is not in the tags, and
+// the nodes in "- ifndef FLAG" are removed when it is. The parsed templates
+// are parsed again.
+func (s *TemplateSet) SetTags(tags ...string) {
+	m := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		m[tag] = true
+	}
+	s.cache.mu.Lock()
+	s.cache.tags = m
+	s.cache.mu.Unlock()
+	s.cache.Clear()
+}
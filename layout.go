@@ -0,0 +1,111 @@
+package slim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+type layoutKey struct{}
+
+// layoutState is the blocks overridden by the templates which extend the
+// layout, and the names of them to detect the cycle.
+type layoutState struct {
+	blocks map[string]*block
+	stack  []string
+}
+
+// block is the overriding block and the template which defines it.
+type block struct {
+	node *Node
+	t    *Template
+}
+
+// extendsNode returns the node of "extends" if it is the first node of the
+// template.
+func extendsNode(root *Node) *Node {
+	if len(root.Children) > 0 && root.Children[0].Name == "extends" {
+		return root.Children[0]
+	}
+	return nil
+}
+
+// layoutName returns the name of the layout in `extends "layout"`.
+func layoutName(n *Node) string {
+	return strings.Trim(strings.TrimSpace(n.Text), `"'`)
+}
+
+// collectBlocks add the blocks in n of t to blocks. The blocks which are
+// already added are kept, because the descendant templates override the
+// ancestors.
+func collectBlocks(t *Template, n *Node, blocks map[string]*block) {
+	for _, c := range n.Children {
+		if c.Name == "block" {
+			name := strings.TrimSpace(c.Text)
+			if _, ok := blocks[name]; !ok {
+				blocks[name] = &block{node: c, t: t}
+			}
+		}
+		collectBlocks(t, c, blocks)
+	}
+}
+
+// extend render the layout with the blocks of t. Nodes of t outside of the
+// blocks are not rendered, except "content_for" which is rendered before the
+// layout.
+func (t *Template) extend(v *vm.VM, out io.Writer, n *Node) error {
+	name := layoutName(n)
+	if name == "" {
+		return errors.New("layout is not specified")
+	}
+	tt, err := t.lookupInner(v.Context(), name)
+	if err != nil {
+		return err
+	}
+	ctx := v.Context()
+	st := &layoutState{blocks: map[string]*block{}}
+	if parent, ok := ctx.Value(layoutKey{}).(*layoutState); ok {
+		for key, b := range parent.blocks {
+			st.blocks[key] = b
+		}
+		st.stack = parent.stack
+	}
+	for _, s := range st.stack {
+		if s == tt.name {
+			return fmt.Errorf("extends cycle: %s", strings.Join(append(st.stack, tt.name), " -> "))
+		}
+	}
+	st.stack = append(st.stack[:len(st.stack):len(st.stack)], tt.name)
+	collectBlocks(t, t.root, st.blocks)
+
+	v.SetContext(context.WithValue(ctx, layoutKey{}, st))
+	defer v.SetContext(ctx)
+	if err := t.printContents(v); err != nil {
+		return err
+	}
+	return tt.print(v, out)
+}
+
+// printBlock render the block overridden by the template which extends the
+// layout, or the children of n. The overriding block is rendered with the
+// template which defines it, so the mixins of the template can be called.
+func printBlock(t *Template, out io.Writer, v *vm.VM, n *Node, indent int) error {
+	b := n
+	if st, ok := v.Context().Value(layoutKey{}).(*layoutState); ok {
+		if o, ok := st.blocks[strings.TrimSpace(n.Text)]; ok {
+			b, t = o.node, o.t
+		}
+	}
+	return printFragment(out, v, n, func(out io.Writer) error {
+		for _, c := range b.Children {
+			if err := printNode(t, out, v, c, indent); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
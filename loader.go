@@ -0,0 +1,107 @@
+package slim
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Loader is the interface to load the source of the templates. The names
+// are slash-separated paths like "partials/header.slim".
+type Loader interface {
+	Open(name string) (io.ReadCloser, error)
+}
+
+type osLoader struct {
+	dir string
+}
+
+// OSLoader returns the loader which reads the files in dir. The names which
+// are not clean and relative like "../secret" or "/etc/passwd" are rejected,
+// so the templates can't read the files outside of dir.
+func OSLoader(dir string) Loader {
+	return &osLoader{dir: dir}
+}
+
+func (l *osLoader) Open(name string) (io.ReadCloser, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Open(filepath.Join(l.dir, filepath.FromSlash(name)))
+}
+
+type fsLoader struct {
+	fsys fs.FS
+}
+
+// FSLoader returns the loader which reads the files in fsys like embed.FS.
+func FSLoader(fsys fs.FS) Loader {
+	return &fsLoader{fsys: fsys}
+}
+
+func (l *fsLoader) Open(name string) (io.ReadCloser, error) {
+	return l.fsys.Open(name)
+}
+
+// MapLoader is the loader which serves the templates in the map of the name
+// and the source.
+type MapLoader map[string]string
+
+// Open returns the source of the template named name.
+func (m MapLoader) Open(name string) (io.ReadCloser, error) {
+	s, ok := m[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return io.NopCloser(strings.NewReader(s)), nil
+}
+
+// ParseLoader parse the template named name with l. The templates rendered
+// by render(), include() and extends are loaded with l, relative to the
+// directory of the template.
+func ParseLoader(l Loader, name string) (*Template, error) {
+	rc, err := l.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return parseLoader(l, name, rc, nil)
+}
+
+func parseLoader(l Loader, name string, in io.Reader, tags map[string]bool) (*Template, error) {
+	t, err := parse(in, tags)
+	if err != nil {
+		return nil, err
+	}
+	t.name = name
+	t.dir = path.Dir(name)
+	t.loader = l
+	return t, nil
+}
+
+// SetLoader set the loader of the templates rendered by render(), include()
+// and extends. The names are resolved relative to the root of the loader.
+func (t *Template) SetLoader(l Loader) {
+	t.loader = l
+	t.dir = "."
+}
+
+// resolve returns the name of the template relative to t.
+func (t *Template) resolve(name string) string {
+	if t.loader != nil {
+		if strings.HasPrefix(name, "/") {
+			name = path.Clean(name[1:])
+		} else {
+			name = path.Join(t.dir, name)
+		}
+	} else if !filepath.IsAbs(name) {
+		name = filepath.Join(t.dir, name)
+	}
+	if path.Ext(name) == "" {
+		name += ".slim"
+	}
+	return name
+}
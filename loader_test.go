@@ -0,0 +1,65 @@
+package slim
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLoader(t *testing.T) {
+	files := MapLoader{
+		"pages/index.slim":   "extends \"../layouts/base\"\nblock content\n  == include \"header\" title: title\n  == include \"/shared/footer\"\n",
+		"pages/header.slim":  "h1 = title",
+		"layouts/base.slim":  "body\n  block content\n",
+		"shared/footer.slim": "p footer",
+	}
+	loaders := map[string]Loader{
+		"map": files,
+		"fs":  FSLoader(os.DirFS("testdata/loader")),
+		"os":  OSLoader("testdata/loader"),
+	}
+	for name, l := range loaders {
+		tmpl, err := ParseLoader(l, "pages/index.slim")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var buf bytes.Buffer
+		err = tmpl.Execute(&buf, Values{"title": "hello"})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		expect := "<body>\n  <div><h1>hello</h1>\n</div>\n  <div><p>footer</p>\n</div>\n</body>\n"
+		if got := buf.String(); expect != got {
+			t.Fatalf("%s: expected %q but %q", name, expect, got)
+		}
+	}
+
+	tmpl, err := Parse(strings.NewReader(`== include "missing"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SetLoader(files)
+	err = tmpl.Execute(&bytes.Buffer{}, nil)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected not exist but %v", err)
+	}
+
+	l := OSLoader("testdata/loader")
+	for _, name := range []string{"../../loader.go", "/etc/passwd", "pages/../../../loader.go"} {
+		if _, err := l.Open(name); !errors.Is(err, fs.ErrInvalid) {
+			t.Fatalf("%s: expected invalid but %v", name, err)
+		}
+	}
+	tmpl, err = Parse(strings.NewReader(`== include "../../loader.go"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SetLoader(l)
+	err = tmpl.Execute(&bytes.Buffer{}, nil)
+	if !errors.Is(err, fs.ErrInvalid) {
+		t.Fatalf("expected invalid but %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package slim
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Localizer returns the helpers for the locale like t() which translates
+// the messages.
+type Localizer func(locale string) Funcs
+
+// ExecuteLocales render t with value for each locale, and returns the map of
+// the locale and the output. The parsed nodes and the compiled expressions
+// are shared, and the locales are rendered in parallel. In the rendering,
+// the variable "locale" is the locale, and the helpers of l override the
+// function map of t.
+func (t *Template) ExecuteLocales(ctx context.Context, value interface{}, locales []string, l Localizer) (map[string]string, error) {
+	if t.snapshot {
+		value = Snapshot(value)
+	}
+	outputs := make([]string, len(locales))
+	errs := make([]error, len(locales))
+	var wg sync.WaitGroup
+	for i, locale := range locales {
+		wg.Add(1)
+		go func(i int, locale string) {
+			defer wg.Done()
+			var buf bytes.Buffer
+			errs[i] = t.executeLocale(ctx, &buf, value, locale, l)
+			outputs[i] = buf.String()
+		}(i, locale)
+	}
+	wg.Wait()
+
+	result := make(map[string]string, len(locales))
+	for i, locale := range locales {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("%s: %w", locale, errs[i])
+		}
+		result[locale] = outputs[i]
+	}
+	return result, nil
+}
+
+func (t *Template) executeLocale(ctx context.Context, buf *bytes.Buffer, value interface{}, locale string, l Localizer) error {
+	v := t.vm.Clone()
+	v.SetContext(t.withSettings(ctx))
+	t.setHelpers(v, buf, value)
+	setValues(v, t.fm, value)
+	if l != nil {
+		for key, f := range l(locale) {
+			v.Set(key, f)
+		}
+	}
+	v.Set("locale", locale)
+
+	var err error
+	withLabels(v, labelTemplate, t.name, func() {
+		err = t.print(v, buf)
+	})
+	return err
+}
+
+// RenderLocales render the template named name with value for each locale.
+// See Template.ExecuteLocales.
+func (s *TemplateSet) RenderLocales(ctx context.Context, name string, value interface{}, locales []string, l Localizer) (map[string]string, error) {
+	t, err := s.load(name)
+	if err != nil {
+		return nil, err
+	}
+	return t.ExecuteLocales(ctx, value, locales, l)
+}
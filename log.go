@@ -0,0 +1,116 @@
+package slim
+
+import (
+	"sync"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// Warning is a warning reported to Logger.
+type Warning struct {
+	// Template is the name of the template.
+	Template string
+	// Line is the line number in the template.
+	Line int
+	// Name is the name of the helper.
+	Name    string
+	Message string
+}
+
+// Logger is the interface for receiving warnings of the templates.
+// It may be called by multiple goroutines in parallel.
+type Logger interface {
+	Warn(w *Warning)
+}
+
+// LoggerFunc is an adapter to allow the use of ordinary functions as Logger.
+type LoggerFunc func(w *Warning)
+
+// Warn calls f(w).
+func (f LoggerFunc) Warn(w *Warning) {
+	f(w)
+}
+
+// SetLogger set the logger for the template. Templates rendered by render()
+// share the logger of the parent.
+func (t *Template) SetLogger(l Logger) {
+	t.logger = l
+}
+
+var deprecated = struct {
+	sync.RWMutex
+	messages map[string]string
+}{messages: make(map[string]string)}
+
+// RegisterDeprecatedFunc is same as RegisterGlobalFunc but calling the
+// function in templates is warned with the message.
+func RegisterDeprecatedFunc(name string, f interface{}, message string) {
+	RegisterGlobalFunc(name, f)
+	deprecated.Lock()
+	defer deprecated.Unlock()
+	deprecated.messages[name] = message
+}
+
+// calleeName returns the name of the function called by expr. Functions in
+// namespaces are returned with dotted name.
+func calleeName(expr vm.Expr) string {
+	switch t := expr.(type) {
+	case *vm.CallExpr:
+		return t.Name
+	case *vm.MethodCallExpr:
+		if id, ok := t.LHS.(*vm.IdentExpr); ok {
+			return id.Name + "." + t.Name
+		}
+	}
+	return ""
+}
+
+// warnCalls warn the calls of the deprecated helpers and the helpers which
+// shadow the builtins in expr. Each call is warned to the logger only once
+// per template, and recorded to the result of the rendering with v.
+func (t *Template) warnCalls(v *vm.VM, n *Node, expr vm.Expr) {
+	logger := t.top().logger
+	if logger == nil && resultOf(v.Context()) == nil {
+		return
+	}
+	vm.Walk(expr, func(e vm.Expr) bool {
+		name := calleeName(e)
+		if name == "" {
+			return true
+		}
+		var message string
+		if _, ok := t.fm[name]; ok {
+			if _, ok := vm.Default.Lookup(name); ok {
+				message = "helper shadows the builtin: " + name
+			}
+		} else {
+			deprecated.RLock()
+			m, ok := deprecated.messages[name]
+			deprecated.RUnlock()
+			if ok {
+				message = "helper is deprecated: " + name
+				if m != "" {
+					message += ": " + m
+				}
+			}
+		}
+		if message == "" {
+			return true
+		}
+		w := &Warning{
+			Template: t.name,
+			Line:     n.Line,
+			Name:     name,
+			Message:  message,
+		}
+		recordWarning(v.Context(), w)
+		type warnKey struct {
+			line int
+			name string
+		}
+		if _, loaded := t.warned.LoadOrStore(warnKey{n.Line, name}, true); !loaded && logger != nil {
+			logger.Warn(w)
+		}
+		return true
+	})
+}
@@ -0,0 +1,77 @@
+package slim
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// Markdown is the interface for converting markdown to HTML.
+type Markdown interface {
+	Convert(src []byte, w io.Writer) error
+}
+
+// MarkdownFunc is an adapter to allow the use of ordinary functions as
+// Markdown.
+type MarkdownFunc func(src []byte, w io.Writer) error
+
+// Convert calls f(src, w).
+func (f MarkdownFunc) Convert(src []byte, w io.Writer) error {
+	return f(src, w)
+}
+
+// SetMarkdown set the converter used by markdown filter. Templates rendered
+// by render() share the converter of the parent.
+func (t *Template) SetMarkdown(m Markdown) {
+	t.markdown = m
+}
+
+// markdownRenderer evaluate #{} in the block at first, then convert it as
+// markdown.
+func (t *Template) markdownRenderer(out io.Writer, n *Node, v *vm.VM) error {
+	markdown := t.top().markdown
+	if markdown == nil {
+		return errors.New("markdown converter is not set")
+	}
+	text, err := rubyInline(v, n.Text)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(dedent(text)), &buf); err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, strings.TrimSpace(buf.String())+"\n")
+	return err
+}
+
+// dedent remove the common indentation of the lines, and the empty lines at
+// the beginning.
+func dedent(s string) string {
+	lines := strings.Split(strings.TrimRightFunc(s, unicode.IsSpace), "\n")
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	indent := -1
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		i := len(l) - len(strings.TrimLeft(l, " \t"))
+		if indent < 0 || i < indent {
+			indent = i
+		}
+	}
+	for i, l := range lines {
+		if len(l) >= indent {
+			lines[i] = l[indent:]
+		} else {
+			lines[i] = strings.TrimLeft(l, " \t")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,106 @@
+package slim
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// testMarkdown is a tiny converter which supports only headings and
+// paragraphs.
+type testMarkdown struct{}
+
+func (testMarkdown) Convert(src []byte, w io.Writer) error {
+	for _, p := range strings.Split(string(src), "\n\n") {
+		if strings.HasPrefix(p, "# ") {
+			fmt.Fprintf(w, "<h1>%s</h1>\n", p[2:])
+		} else {
+			fmt.Fprintf(w, "<p>%s</p>\n", p)
+		}
+	}
+	return nil
+}
+
+func TestMarkdown(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  markdown:
+    # Hello #{name}
+
+    Welcome to #{to_upper(name)}
+  p end
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.FuncMap(Funcs{
+		"to_upper": ToUpper,
+	})
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"name": "golang",
+	})
+	if err == nil {
+		t.Fatal("should be fail without converter")
+	}
+
+	tmpl.SetMarkdown(testMarkdown{})
+	buf.Reset()
+	err = tmpl.Execute(&buf, Values{
+		"name": "golang",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <h1>Hello golang</h1>\n<p>Welcome to GOLANG</p>\n  <p>end</p>\n</div>\n"
+	got := buf.String()
+	if expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+
+	buf.Reset()
+	err = tmpl.Execute(&buf, Values{
+		"name": "<go>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "<div>\n  <h1>Hello &lt;go&gt;</h1>\n<p>Welcome to &lt;GO&gt;</p>\n  <p>end</p>\n</div>\n"
+	got = buf.String()
+	if expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+}
+
+func TestDedent(t *testing.T) {
+	got := dedent("\n    a\n\n      b\n    c\n  ")
+	expect := "a\n\n  b\nc"
+	if expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+}
+
+func TestMarkdownInPartial(t *testing.T) {
+	tmpl, err := ParseFile("testdata/test_markdown.slim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SetMarkdown(MarkdownFunc(func(src []byte, w io.Writer) error {
+		_, err := fmt.Fprintf(w, "<h1>%s</h1>", bytes.TrimPrefix(src, []byte("# ")))
+		return err
+	}))
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"title": "partial",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n<h1>partial</h1>\n</div>\n"
+	got := buf.String()
+	if expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+}
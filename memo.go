@@ -0,0 +1,97 @@
+package slim
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// DefaultMemoTTL is the TTL of the memo which templates use by default.
+const DefaultMemoTTL = time.Minute
+
+// Memo is a cache of values evaluated by "- memo key = expr". Unlike caching
+// fragments of HTML, it stores values, so they can be used in any place of
+// the templates sharing the memo.
+type Memo struct {
+	// TTL is the duration to keep values. Zero means forever.
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]memoEntry
+}
+
+type memoEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// NewMemo create the memo which keeps values for ttl.
+func NewMemo(ttl time.Duration) *Memo {
+	return &Memo{
+		TTL:     ttl,
+		entries: make(map[string]memoEntry),
+	}
+}
+
+// Get returns the value stored with key if it is not expired.
+func (m *Memo) Get(key string) (interface{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		delete(m.entries, key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+// Set store the value with key.
+func (m *Memo) Set(key string, value interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := memoEntry{value: value}
+	if m.TTL > 0 {
+		e.expires = time.Now().Add(m.TTL)
+	}
+	m.entries[key] = e
+}
+
+// Delete remove the value stored with key.
+func (m *Memo) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+}
+
+// Clear remove all values.
+func (m *Memo) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = make(map[string]memoEntry)
+}
+
+// SetMemo set the memo used by memo directive. Templates rendered by
+// render() share the memo of the parent.
+func (t *Template) SetMemo(m *Memo) {
+	t.memo = m
+}
+
+func (t *Template) memoDirective(v *vm.VM, d *vm.DirectiveExpr) error {
+	memo := t.top().memo
+	if r, ok := memo.Get(d.LHS); ok {
+		recordMemoHit(v.Context())
+		v.Set(d.LHS, r)
+		return nil
+	}
+	r, err := v.Eval(d.RHS)
+	if err != nil {
+		return err
+	}
+	memo.Set(d.LHS, r)
+	v.Set(d.LHS, r)
+	return nil
+}
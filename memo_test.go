@@ -0,0 +1,71 @@
+package slim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemo(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+- memo nav = menus()
+ul
+  - for x in nav
+    li = x
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	tmpl.FuncMap(Funcs{
+		"menus": func(args ...Value) (Value, error) {
+			count++
+			return []string{"home", "about"}, nil
+		},
+	})
+	expect := "<ul>\n  <li>home</li>\n  <li>about</li>\n</ul>\n"
+	for i := 0; i < 3; i++ {
+		var buf bytes.Buffer
+		err = tmpl.Execute(&buf, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); expect != got {
+			t.Fatalf("expected %v but %v", expect, got)
+		}
+	}
+	if count != 1 {
+		t.Fatalf("expected %v but %v", 1, count)
+	}
+
+	tmpl.SetMemo(NewMemo(time.Millisecond))
+	var buf bytes.Buffer
+	for i := 0; i < 2; i++ {
+		err = tmpl.Execute(&buf, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	if count != 3 {
+		t.Fatalf("expected %v but %v", 3, count)
+	}
+}
+
+func TestMemoDelete(t *testing.T) {
+	m := NewMemo(0)
+	m.Set("foo", 1)
+	if v, ok := m.Get("foo"); !ok || v != 1 {
+		t.Fatalf("expected %v but %v", 1, v)
+	}
+	m.Delete("foo")
+	if _, ok := m.Get("foo"); ok {
+		t.Fatal("should be deleted")
+	}
+	m.Set("foo", 1)
+	m.Clear()
+	if _, ok := m.Get("foo"); ok {
+		t.Fatal("should be cleared")
+	}
+}
@@ -0,0 +1,87 @@
+package slim
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+)
+
+// MissingPolicy is the policy for the templates which are not found by
+// render().
+type MissingPolicy int
+
+const (
+	// MissingError fails the rendering. It is the default.
+	MissingError MissingPolicy = iota
+	// MissingWarn renders nothing, and the warning is reported to Logger.
+	MissingWarn
+	// MissingFallback calls MissingTemplate to render the fallback content.
+	MissingFallback
+)
+
+// MissingTemplate is the handler which writes the fallback content of the
+// template named name to out.
+type MissingTemplate func(out io.Writer, name string) error
+
+// SetMissingPolicy set the policy for the templates which are not found by
+// render().
+func (t *Template) SetMissingPolicy(p MissingPolicy) {
+	t.missing = p
+}
+
+// SetMissingTemplate set the handler of the templates which are not found by
+// render(), and the policy to MissingFallback.
+func (t *Template) SetMissingTemplate(h MissingTemplate) {
+	t.missing = MissingFallback
+	t.missingTemplate = h
+}
+
+// renderMissing handle err of render() for the template named name with the
+// policy of t.
+func (t *Template) renderMissing(ctx context.Context, out io.Writer, name string, err error) error {
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	switch t.missing {
+	case MissingWarn:
+		w := &Warning{
+			Template: t.name,
+			Name:     name,
+			Message:  "template is not found: " + name,
+		}
+		recordWarning(ctx, w)
+		if logger := t.top().logger; logger != nil {
+			logger.Warn(w)
+		}
+		return nil
+	case MissingFallback:
+		if t.missingTemplate != nil {
+			return t.missingTemplate(out, name)
+		}
+	}
+	return err
+}
+
+// SetMissingPolicy set the policy for the templates which are not found by
+// render() in the set.
+func (s *TemplateSet) SetMissingPolicy(p MissingPolicy) {
+	s.mu.Lock()
+	s.missing = p
+	s.mu.Unlock()
+	s.cache.each(func(t *Template) {
+		t.missing = p
+	})
+}
+
+// SetMissingTemplate set the handler of the templates which are not found by
+// render() in the set, and the policy to MissingFallback.
+func (s *TemplateSet) SetMissingTemplate(h MissingTemplate) {
+	s.mu.Lock()
+	s.missing = MissingFallback
+	s.missingTemplate = h
+	s.mu.Unlock()
+	s.cache.each(func(t *Template) {
+		t.SetMissingTemplate(h)
+	})
+}
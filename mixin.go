@@ -0,0 +1,151 @@
+package slim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// mixin is the definition of "mixin name(params...)".
+type mixin struct {
+	params []string
+	node   *Node
+}
+
+var (
+	mixinPattern = regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*)\s*(?:\(([^)]*)\))?$`)
+	paramPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// maxMixinDepth is the limit of nested mixin calls.
+const maxMixinDepth = 32
+
+type mixinKey struct{}
+
+// parseMixins collect the definitions of mixins in n.
+func parseMixins(n *Node, mixins map[string]*mixin) error {
+	for _, c := range n.Children {
+		if c.Name == "mixin" {
+			m := mixinPattern.FindStringSubmatch(strings.TrimSpace(c.Text))
+			if m == nil {
+				return fmt.Errorf("line %d: invalid mixin: %s", c.Line, c.Text)
+			}
+			if _, ok := mixins[m[1]]; ok {
+				return fmt.Errorf("line %d: mixin %s is already defined", c.Line, m[1])
+			}
+			def := &mixin{node: c}
+			if strings.TrimSpace(m[2]) != "" {
+				for _, p := range strings.Split(m[2], ",") {
+					p = strings.TrimSpace(p)
+					if !paramPattern.MatchString(p) {
+						return fmt.Errorf("line %d: invalid parameter of mixin %s: %q", c.Line, m[1], p)
+					}
+					def.params = append(def.params, p)
+				}
+			}
+			mixins[m[1]] = def
+		}
+		if err := parseMixins(c, mixins); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hoistMixins move the nodes following the mixin out of it. The parser put
+// the nodes which are dedented to the top level into the previous node, but
+// they are not the body of the mixin.
+func hoistMixins(n *Node) {
+	var children []*Node
+	for _, c := range n.Children {
+		hoistMixins(c)
+		children = append(children, c)
+		if c.Name != "mixin" {
+			continue
+		}
+		for i, cc := range c.Children {
+			if cc.Indent <= c.Indent {
+				children = append(children, c.Children[i:]...)
+				c.Children = c.Children[:i]
+				break
+			}
+		}
+	}
+	n.Children = children
+}
+
+// printMixin render the body of the mixin called with "+name(args...)". The
+// arguments are bound to the parameters, and the values which the names had
+// are restored after the body.
+func printMixin(t *Template, out io.Writer, v *vm.VM, n *Node, indent int) error {
+	expr, err := v.Compile(n.Text)
+	if err != nil {
+		return err
+	}
+	var name string
+	var args []vm.Expr
+	switch e := expr.(type) {
+	case *vm.CallExpr:
+		name, args = e.Name, e.Exprs
+	case *vm.IdentExpr:
+		name = e.Name
+	default:
+		return errors.New("invalid mixin call: " + n.Text)
+	}
+	m, ok := t.mixins[name]
+	if !ok {
+		return errors.New("unknown mixin: " + name)
+	}
+	if len(args) != len(m.params) {
+		return fmt.Errorf("mixin %s takes %d arguments but %d given", name, len(m.params), len(args))
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i], err = v.Eval(arg)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx := v.Context()
+	depth, _ := ctx.Value(mixinKey{}).(int)
+	if depth >= maxMixinDepth {
+		return errors.New("mixin nested too deeply: " + name)
+	}
+	v.SetContext(context.WithValue(ctx, mixinKey{}, depth+1))
+	defer v.SetContext(ctx)
+
+	type saved struct {
+		value interface{}
+		ok    bool
+	}
+	olds := make([]saved, len(m.params))
+	a := v.Audit()
+	for i, p := range m.params {
+		olds[i].value, olds[i].ok = v.Get(p)
+		v.Set(p, values[i])
+		if a != nil {
+			a.Alias(p, args[i], false)
+		}
+	}
+	defer func() {
+		for i, p := range m.params {
+			if olds[i].ok {
+				v.Set(p, olds[i].value)
+			} else {
+				v.Unset(p)
+			}
+		}
+	}()
+	for _, c := range m.node.Children {
+		if err := printNode(t, out, v, c, indent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package slim
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Iterator is the interface for the streaming source of the items. "for x in
+// it" calls Next until it returns false, so the items are not materialized
+// in the slice.
+type Iterator interface {
+	Next() (interface{}, bool)
+}
+
+// Collection is the interface for the custom collections. "for x in c"
+// iterates the items from At(0) to At(Len()-1).
+type Collection interface {
+	Len() int
+	At(i int) interface{}
+}
+
+// OrderedMap is a map which keeps the insertion order of the keys. "for k, v
+// in m" iterates the entries in the order. It is not safe for concurrent
+// writes.
+type OrderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// NewOrderedMap create the empty ordered map.
+func NewOrderedMap() *OrderedMap {
+	return &OrderedMap{values: make(map[string]interface{})}
+}
+
+// Set store the value with key. The order of the key is kept if it is
+// already stored.
+func (m *OrderedMap) Set(key string, value interface{}) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// Get returns the value stored with key. It returns nil if not found.
+func (m *OrderedMap) Get(key string) interface{} {
+	return m.values[key]
+}
+
+// Has returns true if the key is stored.
+func (m *OrderedMap) Has(key string) bool {
+	_, ok := m.values[key]
+	return ok
+}
+
+// Delete remove the value stored with key.
+func (m *OrderedMap) Delete(key string) {
+	if _, ok := m.values[key]; !ok {
+		return
+	}
+	delete(m.values, key)
+	for i, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:i:i], m.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// Keys returns the keys in the insertion order.
+func (m *OrderedMap) Keys() []string {
+	return m.keys
+}
+
+// Len returns the number of entries.
+func (m *OrderedMap) Len() int {
+	return len(m.keys)
+}
+
+// sortedKeys returns the keys of the map rv sorted, so iterating maps is
+// deterministic. Numbers are compared by the value and others are compared
+// as string.
+func sortedKeys(rv reflect.Value) []reflect.Value {
+	keys := rv.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch a.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return a.Uint() < b.Uint()
+		case reflect.Float32, reflect.Float64:
+			return a.Float() < b.Float()
+		case reflect.String:
+			return a.String() < b.String()
+		}
+		return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+	})
+	return keys
+}
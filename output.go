@@ -0,0 +1,280 @@
+package slim
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// OutputWriter is the output of the rendering with the contracts of the
+// escaping. The renderer writes the markup with WriteRaw, and the values of
+// the expressions with the others, so the writer decides how the values are
+// escaped. If the writer passed to Execute implements OutputWriter, it is
+// used instead of the default one returned by NewOutputWriter.
+type OutputWriter interface {
+	// WriteRaw write s as is. s is the markup or the trusted text.
+	WriteRaw(s string) error
+	// WriteEscapedText write value in the text of the element named elem
+	// like "p" or "script".
+	WriteEscapedText(elem string, value interface{}) error
+	// WriteEscapedAttr write value in the attribute named name except the
+	// URL attributes.
+	WriteEscapedAttr(name string, value interface{}) error
+	// WriteEscapedURL write value in the URL attribute like href. prefix is
+	// the part of the URL before value.
+	WriteEscapedURL(prefix string, value interface{}) error
+}
+
+type htmlWriter struct {
+	w io.Writer
+}
+
+// NewOutputWriter returns the OutputWriter which writes to w with the
+// escaping of HTML by the context. The alternative writers can delegate to
+// it to keep the escaping rules.
+func NewOutputWriter(w io.Writer) OutputWriter {
+	return &htmlWriter{w: w}
+}
+
+func (hw *htmlWriter) Write(p []byte) (int, error) {
+	return hw.w.Write(p)
+}
+
+func (hw *htmlWriter) WriteRaw(s string) error {
+	_, err := io.WriteString(hw.w, s)
+	return err
+}
+
+func (hw *htmlWriter) WriteEscapedText(elem string, value interface{}) error {
+	return hw.WriteRaw(escapeNodeValue(&Node{Name: elem}, value))
+}
+
+func (hw *htmlWriter) WriteEscapedAttr(name string, value interface{}) error {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasPrefix(name, "on"):
+		return hw.WriteRaw(html.EscapeString(escapeJS(value)))
+	case name == "style":
+		return hw.WriteRaw(html.EscapeString(escapeCSS(value)))
+	}
+	return hw.WriteRaw(escapeValue(value))
+}
+
+func (hw *htmlWriter) WriteEscapedURL(prefix string, value interface{}) error {
+	return hw.WriteRaw(escapeURL(prefix, value))
+}
+
+// outputWriter returns out as OutputWriter.
+func outputWriter(out io.Writer) OutputWriter {
+	if ow, ok := out.(OutputWriter); ok {
+		return ow
+	}
+	return &htmlWriter{w: out}
+}
+
+// writeEscapedAttr write value in the attribute named name. prefix is the
+// part of the value before it.
+func writeEscapedAttr(ow OutputWriter, name, prefix string, value interface{}) error {
+	if urlAttrs[strings.ToLower(name)] {
+		return ow.WriteEscapedURL(prefix, value)
+	}
+	return ow.WriteEscapedAttr(name, value)
+}
+
+// eachInline call lit with the texts in s, and val with the values of #{}
+// between them.
+func eachInline(v *vm.VM, s string, lit func(s string) error, val func(value interface{}) error) error {
+	last := 0
+	for _, m := range rubyInlinePattern.FindAllStringIndex(s, -1) {
+		if err := lit(s[last:m[0]]); err != nil {
+			return err
+		}
+		expr, err := v.Compile(s[m[0]+2 : m[1]-1])
+		if err != nil {
+			return err
+		}
+		iv, err := v.Eval(expr)
+		if err != nil {
+			return err
+		}
+		if iv, err = printable(v, iv); err != nil {
+			return err
+		}
+		if err := val(iv); err != nil {
+			return err
+		}
+		last = m[1]
+	}
+	return lit(s[last:])
+}
+
+// writeInline write the text of n with the values of #{} escaped by ow.
+func writeInline(ow OutputWriter, v *vm.VM, n *Node) error {
+	return eachInline(v, n.Text, ow.WriteRaw, func(value interface{}) error {
+		return ow.WriteEscapedText(n.Name, value)
+	})
+}
+
+// printValue write the value of "= expr" in n.
+func (t *Template) printValue(out io.Writer, n *Node, tag *Tag, value interface{}) error {
+	return markDynamic(out, n.Line, func() error {
+		if t.hooks == nil || t.hooks.OnText == nil {
+			return writeValue(outputWriter(out), n, value)
+		}
+		var sb strings.Builder
+		if err := writeValue(NewOutputWriter(&sb), n, value); err != nil {
+			return err
+		}
+		text, err := t.hookText(tag, sb.String())
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(out, text)
+		return err
+	})
+}
+
+// printText write the text of n. The values of #{} are escaped by the
+// writer.
+func (t *Template) printText(out io.Writer, v *vm.VM, n *Node, tag *Tag) error {
+	if isCompact(v) && !rawTextElements[elemOf(v, n.Name)] {
+		tn := *n
+		tn.Text = collapseSpace(n.Text)
+		n = &tn
+	}
+	write := func() error {
+		if t.hooks == nil || t.hooks.OnText == nil {
+			return writeInline(outputWriter(out), v, n)
+		}
+		text, err := textInline(v, n)
+		if err == nil {
+			text, err = t.hookText(tag, text)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(out, text)
+		return err
+	}
+	if !hasInline(n.Text) {
+		return write()
+	}
+	return markDynamic(out, n.Line, write)
+}
+
+// collapseSpace replace the runs of the whitespaces in s with the single
+// space for the compact mode. #{} in s is kept as is.
+func collapseSpace(s string) string {
+	var sb strings.Builder
+	last := 0
+	collapse := func(s string) {
+		space := false
+		for _, r := range s {
+			if unicode.IsSpace(r) {
+				space = true
+				continue
+			}
+			if space {
+				sb.WriteByte(' ')
+				space = false
+			}
+			sb.WriteRune(r)
+		}
+		if space {
+			sb.WriteByte(' ')
+		}
+	}
+	for _, m := range rubyInlinePattern.FindAllStringIndex(s, -1) {
+		collapse(s[last:m[0]])
+		sb.WriteString(s[m[0]:m[1]])
+		last = m[1]
+	}
+	collapse(s[last:])
+	return sb.String()
+}
+
+// blockText returns the text of the block like "|". The lines indented
+// under the first line are kept verbatim but the common indentation is
+// removed.
+func blockText(s string) string {
+	i := strings.IndexByte(s, '\n')
+	if i < 0 {
+		return s
+	}
+	first, rest := s[:i], s[i+1:]
+	if strings.TrimSpace(first) == "" {
+		return dedent(rest)
+	}
+	blank := rest[:len(rest)-len(strings.TrimLeft(rest, "\n"))]
+	return first + "\n" + blank + dedent(rest)
+}
+
+// indentLines indent the lines of s except the first line and the empty
+// lines for the nesting in the pretty mode, so they are aligned with the
+// first line.
+func indentLines(v *vm.VM, s string, indent int) string {
+	if isCompact(v) || indent == 0 || !strings.Contains(s, "\n") {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	prefix := strings.Repeat(" ", indent*2)
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = prefix + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// printTextBlock write the text block of "|" or "'". "'" appends the
+// whitespace after the text. The values of #{} in script and style are
+// escaped as javascript and CSS like the text of them.
+func (t *Template) printTextBlock(out io.Writer, v *vm.VM, n *Node, indent int) error {
+	tn := *n
+	tn.Name = elemOf(v, n.Name)
+	tn.Text = indentLines(v, blockText(n.Text), indent)
+	writeIndent(out, v, indent)
+	if err := t.printText(out, v, &tn, nil); err != nil {
+		return err
+	}
+	if n.Name == "'" {
+		out.Write(cSpace)
+	}
+	writeNewLine(out, v)
+	return nil
+}
+
+// printHTMLLine write the line of HTML in n, and the children indented under
+// it. The values of #{} in the line are escaped.
+func (t *Template) printHTMLLine(out io.Writer, v *vm.VM, n *Node, indent int) error {
+	writeIndent(out, v, indent)
+	if err := t.printText(out, v, n, nil); err != nil {
+		return err
+	}
+	writeNewLine(out, v)
+	for _, c := range n.Children {
+		if err := printNode(t, out, v, c, indent+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeValue write value of "= expr" in n.
+func writeValue(ow OutputWriter, n *Node, value interface{}) error {
+	if isJSONLDScript(n) {
+		s, err := jsonLD(value)
+		if err != nil {
+			return err
+		}
+		return ow.WriteRaw(s)
+	}
+	if n.Raw {
+		return ow.WriteRaw(fmt.Sprint(value))
+	}
+	return ow.WriteEscapedText(n.Name, value)
+}
@@ -0,0 +1,67 @@
+package slim
+
+import (
+	"context"
+	"io"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// OutputMode is the mode of the whitespaces between the elements.
+type OutputMode int
+
+const (
+	// Pretty writes the elements on the lines indented by the nesting in
+	// the template. It is the default.
+	Pretty OutputMode = iota
+	// Compact writes the elements without the indents and the newlines
+	// between them. The runs of the whitespaces in the texts are collapsed
+	// except in pre, textarea, script and style.
+	Compact
+)
+
+type outputModeKey struct{}
+
+// WithOutputMode returns the context which overrides the output mode of the
+// templates rendered with it, like ExecuteContext.
+func WithOutputMode(ctx context.Context, m OutputMode) context.Context {
+	return context.WithValue(ctx, outputModeKey{}, m)
+}
+
+// SetOutputMode set the output mode. WithOutputMode overrides it for each
+// rendering.
+func (t *Template) SetOutputMode(m OutputMode) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.mode = m
+}
+
+// isCompact returns true if the output mode is Compact.
+func isCompact(v *vm.VM) bool {
+	m, _ := v.Context().Value(outputModeKey{}).(OutputMode)
+	return m == Compact
+}
+
+// writeIndent write the indent for the nesting in the pretty mode.
+func writeIndent(out io.Writer, v *vm.VM, indent int) {
+	if !isCompact(v) {
+		bytesRepeat(out, cSpace, indent*2)
+	}
+}
+
+// writeNewLine write the newline in the pretty mode.
+func writeNewLine(out io.Writer, v *vm.VM) {
+	if !isCompact(v) {
+		out.Write(cNewLine)
+	}
+}
+
+// SetOutputMode set the output mode of the templates in the set.
+func (s *TemplateSet) SetOutputMode(m OutputMode) {
+	s.mu.Lock()
+	s.mode = m
+	s.mu.Unlock()
+	s.cache.each(func(t *Template) {
+		t.SetOutputMode(m)
+	})
+}
@@ -0,0 +1,110 @@
+package slim
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// Profile is the bundle of the options for the environment like the
+// development or the production.
+type Profile struct {
+	// Name is the name of the profile.
+	Name string
+	// Strict makes the missing fields and keys errors. Otherwise they are
+	// rendered as empty like SetNullObject(true).
+	Strict bool
+	// Reload enables the development mode of the cache, so the changed
+	// templates are parsed again.
+	Reload bool
+	// CacheSize is the number of the templates kept in the cache. Zero means
+	// unlimited.
+	CacheSize int
+	// DebugComments emits the comments at the beginning and the end of each
+	// template, like <!-- begin users/index.slim -->.
+	DebugComments bool
+	// TestIDs injects the data-testid attributes to the elements.
+	TestIDs bool
+	// Compact writes the output without the indents and the newlines
+	// between the elements.
+	Compact bool
+}
+
+var (
+	// Development is the profile for the development.
+	Development = Profile{Name: "development", Strict: true, Reload: true, DebugComments: true, TestIDs: true}
+	// Production is the profile for the production.
+	Production = Profile{Name: "production"}
+	// Test is the profile for the tests.
+	Test = Profile{Name: "test", Strict: true, TestIDs: true}
+)
+
+// SetProfile apply the options of p to the set and the templates in it.
+func (s *TemplateSet) SetProfile(p Profile) {
+	s.vm.SetNullObject(!p.Strict)
+	s.cache.SetDev(p.Reload)
+	s.cache.SetMax(p.CacheSize)
+	mode := Pretty
+	if p.Compact {
+		mode = Compact
+	}
+	s.mu.Lock()
+	s.debug = p.DebugComments
+	s.testid = p.TestIDs
+	s.mode = mode
+	s.mu.Unlock()
+	s.cache.each(func(t *Template) {
+		t.mu.Lock()
+		t.debug = p.DebugComments
+		t.testid = p.TestIDs
+		t.mode = mode
+		t.mu.Unlock()
+	})
+}
+
+// SetDebugComments set whether the comments are emitted at the beginning and
+// the end of the template and the partials.
+func (t *Template) SetDebugComments(on bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.debug = on
+}
+
+// settings is the snapshot of the options of the template taken at the
+// beginning of the rendering, so SetProfile in the middle of the rendering
+// doesn't affect it.
+type settings struct {
+	debug  bool
+	testid bool
+}
+
+type settingsKey struct{}
+
+// withSettings returns the context which has the snapshot of the options of
+// t, and the output mode of t if ctx doesn't override it.
+func (t *Template) withSettings(ctx context.Context) context.Context {
+	t.mu.Lock()
+	s := settings{debug: t.debug, testid: t.testid}
+	mode := t.mode
+	t.mu.Unlock()
+	ctx = context.WithValue(ctx, settingsKey{}, s)
+	if _, ok := ctx.Value(outputModeKey{}).(OutputMode); ok || mode == Pretty {
+		return ctx
+	}
+	return WithOutputMode(ctx, mode)
+}
+
+// settingsOf returns the snapshot of the options for the rendering with v.
+func settingsOf(v *vm.VM) settings {
+	s, _ := v.Context().Value(settingsKey{}).(settings)
+	return s
+}
+
+// debugComment write the comment for the debugging if it is enabled.
+func (t *Template) debugComment(out io.Writer, v *vm.VM, what string) {
+	if settingsOf(v).debug && t.name != "" {
+		fmt.Fprintf(out, "<!-- %s %s -->\n", what, t.name)
+	}
+}
@@ -0,0 +1,69 @@
+package slim
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// REPL is an interactive evaluator of the expressions. It is useful to debug
+// why the expression in the template returns the unexpected value.
+type REPL struct {
+	// Prompt is printed before reading each line.
+	Prompt string
+
+	vm *vm.VM
+}
+
+// NewREPL create the REPL which evaluates the expressions against value and
+// the functions. value is bound in the same way as Execute.
+func NewREPL(value interface{}, fm Funcs) *REPL {
+	v := vm.New()
+	setValues(v, fm, value)
+	return &REPL{Prompt: "> ", vm: v}
+}
+
+// Eval evaluate the line. The result is kept as "_" for the next line.
+func (r *REPL) Eval(line string) (interface{}, error) {
+	expr, err := r.vm.Compile(line)
+	if err != nil {
+		return nil, err
+	}
+	switch expr.(type) {
+	case *vm.ForExpr, *vm.DeadlineExpr, *vm.DirectiveExpr, *vm.ElseExpr, *vm.BreakExpr, *vm.ContinueExpr:
+		return nil, fmt.Errorf("not an expression: %s", strings.TrimSpace(line))
+	}
+	result, err := r.vm.Eval(expr)
+	if err != nil {
+		return nil, err
+	}
+	r.vm.Set("_", result)
+	return result, nil
+}
+
+// Run read lines from in and write the results to out until EOF. The errors
+// of the evaluation are written to out and don't stop the loop.
+func (r *REPL) Run(in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, r.Prompt)
+		if !scanner.Scan() {
+			break
+		}
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		result, err := r.Eval(line)
+		if err != nil {
+			fmt.Fprintln(out, "error:", err)
+			continue
+		}
+		fmt.Fprintf(out, "%#v (%T)\n", result, result)
+	}
+	fmt.Fprintln(out)
+	return scanner.Err()
+}
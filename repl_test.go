@@ -0,0 +1,40 @@
+package slim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestREPL(t *testing.T) {
+	r := NewREPL(Values{
+		"user": map[string]interface{}{"name": "golang", "tags": []string{"a", "b"}},
+	}, Funcs{
+		"to_upper": ToUpper,
+	})
+	r.Prompt = ""
+	in := strings.NewReader(`
+user.name
+to_upper(_)
+user.tags[-1]
+user.unknown(
+`)
+	var out bytes.Buffer
+	if err := r.Run(in, &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	expect := []string{
+		`"golang" (string)`,
+		`"GOLANG" (string)`,
+		`"b" (string)`,
+	}
+	for i, e := range expect {
+		if lines[i] != e {
+			t.Fatalf("expected %v but %v", e, lines[i])
+		}
+	}
+	if !strings.HasPrefix(lines[3], "error:") {
+		t.Fatalf("expected error but %v", lines[3])
+	}
+}
@@ -0,0 +1,113 @@
+package slim
+
+import (
+	"fmt"
+	"io"
+)
+
+// OpKind is the kind of the operation of OutputWriter.
+type OpKind int
+
+const (
+	// OpRaw is WriteRaw.
+	OpRaw OpKind = iota
+	// OpText is WriteEscapedText.
+	OpText
+	// OpAttr is WriteEscapedAttr.
+	OpAttr
+	// OpURL is WriteEscapedURL.
+	OpURL
+)
+
+// Op is the operation of OutputWriter recorded by Recorder.
+type Op struct {
+	Kind OpKind
+	// Name is the element of OpText, the attribute of OpAttr, or the prefix
+	// of OpURL.
+	Name string
+	// Raw is the string of OpRaw.
+	Raw string
+	// Value is the value of the others.
+	Value interface{}
+}
+
+// Recorder is the OutputWriter which records the operations of the
+// rendering. The recorded operations can be replayed by Replay without
+// evaluating the template again, so the cost of the evaluation and the cost
+// of the writing can be measured separately, and the output caches can store
+// the operations instead of the bytes. The adjacent raw strings are merged.
+type Recorder struct {
+	ops []Op
+}
+
+// Write record p as the raw string.
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.WriteRaw(string(p))
+	return len(p), nil
+}
+
+// WriteRaw record OpRaw.
+func (r *Recorder) WriteRaw(s string) error {
+	if s == "" {
+		return nil
+	}
+	if n := len(r.ops); n > 0 && r.ops[n-1].Kind == OpRaw {
+		r.ops[n-1].Raw += s
+		return nil
+	}
+	r.ops = append(r.ops, Op{Kind: OpRaw, Raw: s})
+	return nil
+}
+
+// WriteEscapedText record OpText.
+func (r *Recorder) WriteEscapedText(elem string, value interface{}) error {
+	r.ops = append(r.ops, Op{Kind: OpText, Name: elem, Value: value})
+	return nil
+}
+
+// WriteEscapedAttr record OpAttr.
+func (r *Recorder) WriteEscapedAttr(name string, value interface{}) error {
+	r.ops = append(r.ops, Op{Kind: OpAttr, Name: name, Value: value})
+	return nil
+}
+
+// WriteEscapedURL record OpURL.
+func (r *Recorder) WriteEscapedURL(prefix string, value interface{}) error {
+	r.ops = append(r.ops, Op{Kind: OpURL, Name: prefix, Value: value})
+	return nil
+}
+
+// Ops returns the recorded operations.
+func (r *Recorder) Ops() []Op {
+	return r.ops
+}
+
+// Reset remove the recorded operations.
+func (r *Recorder) Reset() {
+	r.ops = r.ops[:0]
+}
+
+// Replay write the operations to out. If out is not OutputWriter, the values
+// are escaped by the default writer.
+func Replay(out io.Writer, ops []Op) error {
+	ow := outputWriter(out)
+	for _, op := range ops {
+		var err error
+		switch op.Kind {
+		case OpRaw:
+			err = ow.WriteRaw(op.Raw)
+		case OpText:
+			err = ow.WriteEscapedText(op.Name, op.Value)
+		case OpAttr:
+			err = ow.WriteEscapedAttr(op.Name, op.Value)
+		case OpURL:
+			err = ow.WriteEscapedURL(op.Name, op.Value)
+		default:
+			err = fmt.Errorf("unknown operation: %d", op.Kind)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package slim
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// RenderResult is the metadata of the rendering returned by ExecuteResult,
+// so the callers can log it and decide the caching without the tracer and
+// the logger.
+type RenderResult struct {
+	// Bytes is the number of the bytes written to out. It is zero if out is
+	// OutputWriter, because the escaping is done by it.
+	Bytes int64
+	// Duration is the time of the rendering.
+	Duration time.Duration
+	// Partials is the names of the templates rendered by render(), include()
+	// and extends in the order.
+	Partials []string
+	// MemoHits is the number of the values of "- memo" reused from the memo.
+	MemoHits int
+	// Accessed is the paths of the data accessed like "user.email".
+	Accessed []string
+	// Warnings is the warnings of the rendering. They are reported to the
+	// logger too, but only once per template.
+	Warnings []*Warning
+	// Hints is the hints of "- cache" recorded in the rendering.
+	Hints *CacheHints
+
+	mu sync.Mutex
+}
+
+type resultKey struct{}
+
+// resultOf returns the result of the rendering with ctx, or nil.
+func resultOf(ctx context.Context) *RenderResult {
+	r, _ := ctx.Value(resultKey{}).(*RenderResult)
+	return r
+}
+
+// recordPartial record the partial named name to the result of ctx.
+func recordPartial(ctx context.Context, name string) {
+	if r := resultOf(ctx); r != nil {
+		r.mu.Lock()
+		r.Partials = append(r.Partials, name)
+		r.mu.Unlock()
+	}
+}
+
+// recordMemoHit count the hit of the memo to the result of ctx.
+func recordMemoHit(ctx context.Context) {
+	if r := resultOf(ctx); r != nil {
+		r.mu.Lock()
+		r.MemoHits++
+		r.mu.Unlock()
+	}
+}
+
+// recordWarning record w to the result of ctx.
+func recordWarning(ctx context.Context, w *Warning) {
+	if r := resultOf(ctx); r != nil {
+		r.mu.Lock()
+		r.Warnings = append(r.Warnings, w)
+		r.mu.Unlock()
+	}
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// ExecuteResult is same as ExecuteContext but returns the metadata of the
+// rendering. The result is returned even if the rendering fails.
+func (t *Template) ExecuteResult(ctx context.Context, out io.Writer, value interface{}) (*RenderResult, error) {
+	r := &RenderResult{}
+	if h, ok := ctx.Value(cacheHintsKey{}).(*CacheHints); ok {
+		r.Hints = h
+	} else {
+		ctx, r.Hints = WithCacheHints(ctx)
+	}
+	ctx = context.WithValue(ctx, resultKey{}, r)
+	var cw *countWriter
+	if _, ok := out.(OutputWriter); !ok {
+		cw = &countWriter{w: out}
+		out = cw
+	}
+	a := vm.NewAudit()
+	start := time.Now()
+	err := t.executeContext(ctx, out, value, a)
+	r.Duration = time.Since(start)
+	if cw != nil {
+		r.Bytes = cw.n
+	}
+	r.Accessed = a.Paths()
+	return r, err
+}
+
+// RenderResult is same as RenderContext but returns the metadata of the
+// rendering.
+func (s *TemplateSet) RenderResult(ctx context.Context, out io.Writer, name string, value interface{}) (*RenderResult, error) {
+	t, err := s.load(name)
+	if err != nil {
+		return nil, err
+	}
+	return t.ExecuteResult(ctx, out, value)
+}
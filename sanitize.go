@@ -0,0 +1,153 @@
+package slim
+
+import (
+	"html"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// Sanitizer is the interface for the policy to sanitize untrusted HTML.
+type Sanitizer interface {
+	Sanitize(s string) string
+}
+
+// SanitizerFunc is an adapter to allow the use of ordinary functions as
+// Sanitizer.
+type SanitizerFunc func(s string) string
+
+// Sanitize calls f(s).
+func (f SanitizerFunc) Sanitize(s string) string {
+	return f(s)
+}
+
+// Policy is a Sanitizer which allows only the tags and attributes listed.
+// Other tags are removed and texts are escaped.
+type Policy struct {
+	// Tags is a map of allowed tag names to allowed attribute names.
+	Tags map[string][]string
+	// URLAttrs is a list of attribute names which contain URL. The value must
+	// be a relative URL or have the scheme listed in URLSchemes.
+	URLAttrs []string
+	// URLSchemes is a list of allowed schemes of URL.
+	URLSchemes []string
+}
+
+// DefaultPolicy is the policy used by default. It allows basic formatting
+// tags and links which is common for user comments.
+var DefaultPolicy = &Policy{
+	Tags: map[string][]string{
+		"a":          {"href", "title"},
+		"b":          nil,
+		"blockquote": nil,
+		"br":         nil,
+		"code":       nil,
+		"em":         nil,
+		"i":          nil,
+		"li":         nil,
+		"ol":         nil,
+		"p":          nil,
+		"pre":        nil,
+		"strong":     nil,
+		"ul":         nil,
+	},
+	URLAttrs:   []string{"href", "src"},
+	URLSchemes: []string{"http", "https", "mailto"},
+}
+
+var (
+	sanitizeTagPattern  = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9]*)([^<>]*)>`)
+	sanitizeAttrPattern = regexp.MustCompile(`([a-zA-Z_:][-a-zA-Z0-9_:.]*)(?:\s*=\s*("[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?`)
+	urlSchemePattern    = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.-]*):`)
+)
+
+// Sanitize returns s which contains only allowed tags and attributes.
+func (p *Policy) Sanitize(s string) string {
+	var sb strings.Builder
+	last := 0
+	for _, m := range sanitizeTagPattern.FindAllStringSubmatchIndex(s, -1) {
+		sb.WriteString(escapeText(s[last:m[0]]))
+		last = m[1]
+
+		name := strings.ToLower(s[m[4]:m[5]])
+		attrs, ok := p.Tags[name]
+		if !ok {
+			continue
+		}
+		if m[3] > m[2] {
+			sb.WriteString("</" + name + ">")
+			continue
+		}
+		sb.WriteString("<" + name)
+		for _, am := range sanitizeAttrPattern.FindAllStringSubmatch(s[m[6]:m[7]], -1) {
+			aname := strings.ToLower(am[1])
+			if !contains(attrs, aname) {
+				continue
+			}
+			avalue := html.UnescapeString(strings.Trim(am[2], `"'`))
+			if contains(p.URLAttrs, aname) && !p.allowedURL(avalue) {
+				continue
+			}
+			sb.WriteString(" " + aname + `="` + html.EscapeString(avalue) + `"`)
+		}
+		sb.WriteString(">")
+	}
+	sb.WriteString(escapeText(s[last:]))
+	return sb.String()
+}
+
+// allowedURL returns true if s is relative or has the allowed scheme. The
+// ASCII whitespaces and the control characters are removed before matching,
+// because the browsers ignore them in the scheme like "java\tscript:".
+func (p *Policy) allowedURL(s string) bool {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+	m := urlSchemePattern.FindStringSubmatch(s)
+	if m == nil {
+		return true
+	}
+	return contains(p.URLSchemes, strings.ToLower(m[1]))
+}
+
+// escapeText escape the text. The entities already escaped are kept as is.
+func escapeText(s string) string {
+	return html.EscapeString(html.UnescapeString(s))
+}
+
+func contains(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SetSanitizer set the policy used by sanitize filter and sanitize(s).
+// Templates rendered by render() share the policy of the parent.
+func (t *Template) SetSanitizer(s Sanitizer) {
+	t.sanitizer = s
+}
+
+func (t *Template) sanitize(s string) string {
+	sanitizer := t.top().sanitizer
+	if sanitizer == nil {
+		return DefaultPolicy.Sanitize(s)
+	}
+	return sanitizer.Sanitize(s)
+}
+
+func (t *Template) sanitizeRenderer(out io.Writer, n *Node, v *vm.VM) error {
+	text, err := rubyInline(v, n.Text)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, strings.TrimSpace(t.sanitize(text))+"\n")
+	return err
+}
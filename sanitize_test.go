@@ -0,0 +1,73 @@
+package slim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	tests := []struct {
+		in     string
+		expect string
+	}{
+		{`hello <b>world</b>`, `hello <b>world</b>`},
+		{`<script>alert(1)</script>`, `alert(1)`},
+		{`<p onclick="alert(1)">x</p>`, `<p>x</p>`},
+		{`<a href="javascript:alert(1)" title=hi>x</a>`, `<a title="hi">x</a>`},
+		{`<a href="java&#9;script:alert(1)">x</a>`, `<a>x</a>`},
+		{"<a href=\"java\tscript:alert(1)\">x</a>", `<a>x</a>`},
+		{`<a href=" &#10;javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{`<a href='https://example.com/?a=1&amp;b=2'>x</a>`, `<a href="https://example.com/?a=1&amp;b=2">x</a>`},
+		{`1 < 2 &amp; 3 > 2`, `1 &lt; 2 &amp; 3 &gt; 2`},
+	}
+	for _, tt := range tests {
+		got := DefaultPolicy.Sanitize(tt.in)
+		if tt.expect != got {
+			t.Fatalf("expected %v but %v when in %s", tt.expect, got, tt.in)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  sanitize:
+    <p>#{comment}</p>
+  sanitize:
+    <p>#{raw}</p>
+  == sanitize(comment)
+  = sanitize(comment)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"comment": `<b>hi</b><img src=x onerror=alert(1)>`,
+		"raw":     HTML(`<b>hi</b><img src=x onerror=alert(1)>`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <p>&lt;b&gt;hi&lt;/b&gt;&lt;img src=x onerror=alert(1)&gt;</p>\n  <p><b>hi</b></p>\n  <div><b>hi</b></div>\n  <div><b>hi</b></div>\n</div>\n"
+	got := buf.String()
+	if expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+
+	tmpl.SetSanitizer(SanitizerFunc(strings.ToUpper))
+	buf.Reset()
+	err = tmpl.Execute(&buf, Values{
+		"comment": `<b>hi</b>`,
+		"raw":     HTML(`<i>x</i>`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "<div>\n  <P>&LT;B&GT;HI&LT;/B&GT;</P>\n  <P><I>X</I></P>\n  <div><B>HI</B></div>\n  <div><B>HI</B></div>\n</div>\n"
+	got = buf.String()
+	if expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+}
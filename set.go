@@ -0,0 +1,273 @@
+package slim
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// TemplateSet is the collection of the templates addressable by the name
+// like "users/index". The templates in the set share the function map, the
+// renderers, the directives, the memo and the configuration of the VM, and
+// render the others in the set by render(), include() and extends.
+type TemplateSet struct {
+	cache      *Cache
+	raw        *rawLoader
+	mu         sync.RWMutex
+	fm         Funcs
+	vm         *vm.VM
+	renderer   map[string]Renderer
+	directives map[string]Directive
+	memo       *Memo
+	debug      bool
+	buffered   bool
+
+	flushThreshold  int
+	hooks           *Hooks
+	testid          bool
+	missing         MissingPolicy
+	missingTemplate MissingTemplate
+	mode            OutputMode
+}
+
+// NewTemplateSet create the set which loads the templates with l. The
+// templates are parsed at the first use, and cached in the set. l can be nil
+// if all templates are added by AddRaw.
+func NewTemplateSet(l Loader) *TemplateSet {
+	raw := &rawLoader{sources: map[string]string{}, base: l}
+	s := &TemplateSet{
+		cache:      NewCache(raw, 0),
+		raw:        raw,
+		vm:         vm.New(),
+		renderer:   map[string]Renderer{},
+		directives: map[string]Directive{},
+		memo:       NewMemo(DefaultMemoTTL),
+	}
+	s.cache.adopt = s.adopt
+	return s
+}
+
+// ParseFS parse the templates in fsys which match the patterns like
+// "views/*.slim", and returns the set of them. The expressions in the
+// templates are compiled, so the syntax errors are reported here.
+func ParseFS(fsys fs.FS, patterns ...string) (*TemplateSet, error) {
+	s := NewTemplateSet(FSLoader(fsys))
+	for _, pattern := range patterns {
+		names, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("pattern matches no files: %#q", pattern)
+		}
+		for _, name := range names {
+			t, err := s.load(name)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if err := t.compile(t.root); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return s, nil
+}
+
+// load returns the template named name in the set. If it is not parsed yet,
+// it is loaded with the loader of the set.
+func (s *TemplateSet) load(name string) (*Template, error) {
+	return s.cache.Get(name)
+}
+
+// adopt apply the configuration of the set to t.
+func (s *TemplateSet) adopt(t *Template) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t.vm = s.vm
+	t.fm = s.fm
+	t.memo = s.memo
+	t.debug = s.debug
+	t.buffered = s.buffered
+	t.flushThreshold = s.flushThreshold
+	t.hooks = s.hooks
+	t.testid = s.testid
+	t.missing = s.missing
+	t.missingTemplate = s.missingTemplate
+	t.mode = s.mode
+	for key, r := range s.renderer {
+		t.renderer[key] = r
+	}
+	for key, d := range s.directives {
+		t.directives[key] = d
+	}
+}
+
+// AddRaw add the template named name with the source, like the snippets
+// generated dynamically or stored in the database. It can be rendered, and
+// included by the other templates in the set. It overrides the template of
+// the loader which has the same name.
+func (s *TemplateSet) AddRaw(name, source string) error {
+	name = cleanName(name)
+	s.raw.mu.Lock()
+	old, exists := s.raw.sources[name]
+	s.raw.sources[name] = source
+	s.raw.mu.Unlock()
+	s.cache.Invalidate(name)
+
+	t, err := s.cache.Get(name)
+	if err == nil {
+		err = t.compile(t.root)
+	}
+	if err != nil {
+		s.raw.mu.Lock()
+		if exists {
+			s.raw.sources[name] = old
+		} else {
+			delete(s.raw.sources, name)
+		}
+		s.raw.mu.Unlock()
+		s.cache.Invalidate(name)
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// rawLoader serves the sources added by AddRaw, and the templates of base.
+type rawLoader struct {
+	mu      sync.RWMutex
+	sources map[string]string
+	base    Loader
+}
+
+func (l *rawLoader) Open(name string) (io.ReadCloser, error) {
+	l.mu.RLock()
+	src, ok := l.sources[name]
+	l.mu.RUnlock()
+	if ok {
+		return io.NopCloser(strings.NewReader(src)), nil
+	}
+	if l.base == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return l.base.Open(name)
+}
+
+// Render render the template named name like "users/index" with value.
+func (s *TemplateSet) Render(out io.Writer, name string, value interface{}) error {
+	return s.RenderContext(context.Background(), out, name, value)
+}
+
+// RenderContext is same as Render but the rendering is cancelled when ctx is
+// done.
+func (s *TemplateSet) RenderContext(ctx context.Context, out io.Writer, name string, value interface{}) error {
+	t, err := s.load(name)
+	if err != nil {
+		return err
+	}
+	return t.ExecuteContext(ctx, out, value)
+}
+
+// FuncMap set the function map of the templates in the set.
+func (s *TemplateSet) FuncMap(m Funcs) {
+	s.mu.Lock()
+	s.fm = m
+	s.mu.Unlock()
+	s.cache.each(func(t *Template) {
+		t.fm = m
+	})
+}
+
+// RegisterRenderer register custom render named with the name to the
+// templates in the set.
+func (s *TemplateSet) RegisterRenderer(name string, r Renderer) {
+	s.mu.Lock()
+	s.renderer[name] = r
+	s.mu.Unlock()
+	s.cache.each(func(t *Template) {
+		t.renderer[name] = r
+	})
+}
+
+// RegisterDirective register custom directive named with the name to the
+// templates in the set.
+func (s *TemplateSet) RegisterDirective(name string, d Directive) {
+	s.mu.Lock()
+	s.directives[name] = d
+	s.mu.Unlock()
+	s.cache.each(func(t *Template) {
+		t.directives[name] = d
+	})
+}
+
+// VM returns the VM shared by the templates in the set. Use it to configure
+// the templates like Restrict and SetLimits.
+func (s *TemplateSet) VM() *vm.VM {
+	return s.vm
+}
+
+// Lookup returns the template named name. ".slim" can be omitted. It returns
+// nil if the template is not parsed yet.
+func (s *TemplateSet) Lookup(name string) *Template {
+	return s.cache.peek(name)
+}
+
+// Names returns the names of the parsed templates in the sorted order.
+func (s *TemplateSet) Names() []string {
+	return s.cache.names()
+}
+
+// Cache returns the cache of the templates in the set. Use it to enable the
+// development mode, or to invalidate the templates.
+func (s *TemplateSet) Cache() *Cache {
+	return s.cache
+}
+
+// compile compile the expressions in n.
+func (t *Template) compile(n *Node) error {
+	if n.Name == "/" || n.Name == "/!" {
+		// the comments are not evaluated.
+		return nil
+	}
+	srcs := []string{n.Text}
+	for _, a := range n.Attr {
+		if a.Name == "*" || isExprAttr(a.Value) {
+			if _, err := t.vm.Compile(attrExpr(a)); err != nil {
+				return fmt.Errorf("line %d: %w", n.Line, err)
+			}
+			continue
+		}
+		srcs = append(srcs, a.Value)
+	}
+	for _, src := range srcs {
+		for _, m := range rubyInlinePattern.FindAllString(src, -1) {
+			if _, err := t.vm.Compile(m[2 : len(m)-1]); err != nil {
+				return fmt.Errorf("line %d: %w", n.Line, err)
+			}
+		}
+	}
+	if n.Expr != "" || n.Name == "+" {
+		var err error
+		if n.Name == "+" {
+			_, err = t.vm.Compile(n.Text)
+		} else {
+			_, err = compileNode(t.vm, n)
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+	}
+	for _, c := range n.Children {
+		if err := t.compile(c); err != nil {
+			return err
+		}
+	}
+	if n.Else != nil {
+		return t.compile(n.Else)
+	}
+	return nil
+}
@@ -0,0 +1,524 @@
+package slim
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestParseFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"views/index.slim":        {Data: []byte("extends \"layouts/base\"\nblock content\n  == include \"header\" title: title\n")},
+		"views/header.slim":       {Data: []byte("h1 = title")},
+		"views/layouts/base.slim": {Data: []byte("body\n  block content\n")},
+	}
+	set, err := ParseFS(fsys, "views/*.slim", "views/layouts/*.slim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"views/header.slim", "views/index.slim", "views/layouts/base.slim"}
+	if got := set.Names(); !reflect.DeepEqual(expect, got) {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+	tmpl := set.Lookup("views/index")
+	if tmpl == nil {
+		t.Fatal("expected template but nil")
+	}
+	if tt, err := tmpl.lookupInner(context.Background(), "layouts/base"); err != nil || tt != set.Lookup("views/layouts/base.slim") {
+		t.Fatalf("expected the template in the set but %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, Values{"title": "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "<body>\n  <div><h1>hello</h1>\n</div>\n</body>\n" {
+		t.Fatalf("unexpected output %q", got)
+	}
+
+	fsys["views/broken.slim"] = &fstest.MapFile{Data: []byte("p = (1 +")}
+	_, err = ParseFS(fsys, "views/*.slim")
+	if err == nil || !strings.Contains(err.Error(), "views/broken.slim") {
+		t.Fatalf("expected syntax error but %v", err)
+	}
+	_, err = ParseFS(fsys, "missing/*.slim")
+	if err == nil {
+		t.Fatal("expected error but not")
+	}
+}
+
+func TestTemplateSet(t *testing.T) {
+	set := NewTemplateSet(MapLoader{
+		"users/index.slim": "ul\n  - for u in users\n    == include \"row\" user: u\n",
+		"users/row.slim":   "li = shout(user.name) + user.missing",
+	})
+	set.FuncMap(Funcs{
+		"shout": ToUpper,
+	})
+	set.VM().SetNullObject(true)
+	var buf bytes.Buffer
+	err := set.Render(&buf, "users/index", Values{
+		"users": []map[string]interface{}{
+			{"name": "foo"},
+			{"name": "bar"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<ul>\n  <div><li>FOO</li>\n</div>\n  <div><li>BAR</li>\n</div>\n</ul>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+	expectNames := []string{"users/index.slim", "users/row.slim"}
+	if got := set.Names(); !reflect.DeepEqual(expectNames, got) {
+		t.Fatalf("expected %v but %v", expectNames, got)
+	}
+	if err := set.Render(&buf, "users/missing", nil); err == nil {
+		t.Fatal("expected error but not")
+	}
+}
+
+func TestAddRaw(t *testing.T) {
+	set := NewTemplateSet(MapLoader{
+		"index.slim": "div\n  == include \"snippets/banner\" text: text\n",
+	})
+	if err := set.AddRaw("snippets/banner", "p.banner = text"); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := set.Render(&buf, "index", Values{"text": "sale"}); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <div><p class=\"banner\">sale</p>\n</div>\n</div>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+
+	if err := set.AddRaw("snippets/banner", "p = (1 +"); err == nil {
+		t.Fatal("expected syntax error but not")
+	}
+	buf.Reset()
+	if err := set.Render(&buf, "index", Values{"text": "sale"}); err != nil || buf.String() != expect {
+		t.Fatalf("expected the previous snippet but %q, %v", buf.String(), err)
+	}
+
+	if err := set.AddRaw("snippets/a", `== include "b"`); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.AddRaw("snippets/b", `== include "a"`); err != nil {
+		t.Fatal(err)
+	}
+	err := set.Render(&buf, "snippets/a", nil)
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Fatalf("expected cycle error but %v", err)
+	}
+}
+
+func TestSetTags(t *testing.T) {
+	set := NewTemplateSet(MapLoader{
+		"index.slim": "div\n  - ifdef debug\n    p debug\n  p main\n  - ifndef debug\n  p prod\n  - endif\n",
+		"bad.slim":   "div\n  - ifdef debug\n  p\n",
+	})
+	var buf bytes.Buffer
+	if err := set.Render(&buf, "index", nil); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <p>main</p>\n  <p>prod</p>\n</div>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+
+	set.SetTags("debug")
+	buf.Reset()
+	if err := set.Render(&buf, "index", nil); err != nil {
+		t.Fatal(err)
+	}
+	expect = "<div>\n  <p>debug</p>\n  <p>main</p>\n</div>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+
+	err := set.Render(&buf, "bad", nil)
+	if err == nil || !strings.Contains(err.Error(), "ifdef is not closed") {
+		t.Fatalf("expected unclosed error but %v", err)
+	}
+}
+
+func TestSetProfile(t *testing.T) {
+	set := NewTemplateSet(MapLoader{
+		"index.slim": "p = user.name",
+	})
+	value := Values{"user": map[string]interface{}{}}
+
+	set.SetProfile(Development)
+	var buf bytes.Buffer
+	if err := set.Render(&buf, "index", value); err == nil {
+		t.Fatal("expected error for missing key in development")
+	}
+
+	set.SetProfile(Production)
+	buf.Reset()
+	if err := set.Render(&buf, "index", value); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<p></p>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+
+	set.SetProfile(Profile{DebugComments: true})
+	buf.Reset()
+	if err := set.Render(&buf, "index", Values{"user": map[string]interface{}{"name": "bob"}}); err != nil {
+		t.Fatal(err)
+	}
+	expect = "<!-- begin index.slim -->\n<p>bob</p>\n<!-- end index.slim -->\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+}
+
+func TestSetProfileConcurrent(t *testing.T) {
+	set := NewTemplateSet(MapLoader{
+		"index.slim": "div\n  p = name\n  p\n    | a   b\n",
+	})
+	value := Values{"name": "bob"}
+	profiles := []Profile{{}, {DebugComments: true, TestIDs: true, Compact: true}}
+	expects := map[string]bool{}
+	for _, p := range profiles {
+		set.SetProfile(p)
+		var buf bytes.Buffer
+		if err := set.Render(&buf, "index", value); err != nil {
+			t.Fatal(err)
+		}
+		expects[buf.String()] = true
+	}
+	if len(expects) != len(profiles) {
+		t.Fatalf("expected different outputs: %v", expects)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; ; j++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			set.SetProfile(profiles[j%2])
+		}
+	}()
+	for j := 0; j < 200; j++ {
+		var buf bytes.Buffer
+		if err := set.Render(&buf, "index", value); err != nil {
+			t.Fatal(err)
+		}
+		if !expects[buf.String()] {
+			t.Fatalf("unexpected output: %q", buf.String())
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestMissingPolicy(t *testing.T) {
+	set := NewTemplateSet(MapLoader{
+		"index.slim": "div\n  - render(\"tenant/banner\")\n  p main\n",
+	})
+	var buf bytes.Buffer
+	if err := set.Render(&buf, "index", nil); err == nil {
+		t.Fatal("expected error for missing template")
+	}
+
+	set.SetMissingPolicy(MissingWarn)
+	var warnings []string
+	set.Lookup("index").SetLogger(LoggerFunc(func(w *Warning) {
+		warnings = append(warnings, w.Message)
+	}))
+	buf.Reset()
+	if err := set.Render(&buf, "index", nil); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <p>main</p>\n</div>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "tenant/banner") {
+		t.Fatalf("expected warning but %v", warnings)
+	}
+
+	set.SetMissingTemplate(func(out io.Writer, name string) error {
+		_, err := io.WriteString(out, "<!-- fallback "+name+" -->\n")
+		return err
+	})
+	buf.Reset()
+	if err := set.Render(&buf, "index", nil); err != nil {
+		t.Fatal(err)
+	}
+	expect = "<div>\n<!-- fallback tenant/banner -->\n  <p>main</p>\n</div>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+}
+
+func TestSetTestIDs(t *testing.T) {
+	set := NewTemplateSet(MapLoader{
+		"users/index.slim": "div\n  ul\n    - for x in items\n      li = x\n  p data-testid=\"note\" note\n  p end\n",
+	})
+	set.SetTestIDs(true)
+	var buf bytes.Buffer
+	if err := set.Render(&buf, "users/index", Values{"items": []int{1}}); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div data-testid=\"users/index/div\">\n" +
+		"  <ul data-testid=\"users/index/div/ul\">\n" +
+		"    <li data-testid=\"users/index/div/ul/li\">1</li>\n" +
+		"  </ul>\n" +
+		"  <p data-testid=\"note\">note</p>\n" +
+		"  <p data-testid=\"users/index/div/p-2\">end</p>\n" +
+		"</div>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+}
+
+func TestRenderLocales(t *testing.T) {
+	set := NewTemplateSet(MapLoader{
+		"index.slim": "div\n  p = t(\"hello\")\n  p = locale\n  p = name\n",
+	})
+	messages := map[string]map[string]string{
+		"en": {"hello": "Hello"},
+		"ja": {"hello": "こんにちは"},
+	}
+	l := func(locale string) Funcs {
+		return Funcs{
+			"t": func(args ...Value) (Value, error) {
+				return messages[locale][fmt.Sprint(args[0])], nil
+			},
+		}
+	}
+	outputs, err := set.RenderLocales(context.Background(), "index", Values{"name": "bob"}, []string{"en", "ja"}, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]string{
+		"en": "<div>\n  <p>Hello</p>\n  <p>en</p>\n  <p>bob</p>\n</div>\n",
+		"ja": "<div>\n  <p>こんにちは</p>\n  <p>ja</p>\n  <p>bob</p>\n</div>\n",
+	}
+	if !reflect.DeepEqual(outputs, expect) {
+		t.Fatalf("expected %q but %q", expect, outputs)
+	}
+}
+
+func TestAddTree(t *testing.T) {
+	tree, err := ParseTree(strings.NewReader("div\n  - ifdef debug\n    p debug\n  == include(\"part\")\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewTemplateSet(MapLoader{"part.slim": "p part\n"})
+	if err := s.AddTree("index", tree); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := s.Render(&buf, "index", nil); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <div><p>part</p>\n</div>\n</div>\n"
+	if buf.String() != expect {
+		t.Fatalf("expected %q but %q", expect, buf.String())
+	}
+
+	s.SetTags("debug")
+	buf.Reset()
+	if err := s.Render(&buf, "index", nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "<p>debug</p>") {
+		t.Fatalf("unexpected output: %q", buf.String())
+	}
+
+	tree, err = ParseTree(strings.NewReader("p = (\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddTree("broken", tree); err == nil {
+		t.Fatal("should be fail")
+	}
+}
+
+func TestRenderFragments(t *testing.T) {
+	s := NewTemplateSet(MapLoader{
+		"rows.slim": "div\n  - json count = total\n  block rows_html\n    - for x in items\n      tr = x\n  p footer\n",
+	})
+	got, err := s.RenderFragments(context.Background(), "rows", Values{"items": []string{"a", "<b>"}, "total": 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]interface{}{
+		"count":     12,
+		"rows_html": "  <tr>a</tr>\n  <tr>&lt;b&gt;</tr>\n",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expect) {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+
+	var buf bytes.Buffer
+	if err := s.Render(&buf, "rows", Values{"items": []string{"a"}, "total": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "<div>\n  <tr>a</tr>\n  <p>footer</p>\n</div>\n"; buf.String() != want {
+		t.Fatalf("expected %q but %q", want, buf.String())
+	}
+}
+
+func TestRenderGeneration(t *testing.T) {
+	s := NewTemplateSet(nil)
+	for name, src := range map[string]string{
+		"index":  "div\n  - render(\"header\")\n  - swap()\n  - render(\"footer\")\n  - render(\"header\")\n",
+		"header": "p old header\n",
+		"footer": "p old footer\n",
+	} {
+		if err := s.AddRaw(name, src); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.FuncMap(Funcs{
+		"swap": func(args ...Value) (Value, error) {
+			for _, name := range []string{"header", "footer"} {
+				if err := s.AddRaw(name, "p new "+name+"\n"); err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		},
+	})
+	gen := s.Cache().Generation()
+	var buf bytes.Buffer
+	if err := s.Render(&buf, "index", nil); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n<p>old header</p>\n<p>old footer</p>\n<p>old header</p>\n</div>\n"
+	if buf.String() != expect {
+		t.Fatalf("expected %q but %q", expect, buf.String())
+	}
+	if s.Cache().Generation() <= gen {
+		t.Fatal("generation should be increased")
+	}
+
+	buf.Reset()
+	s.FuncMap(nil)
+	if err := s.AddRaw("index", "div\n  - render(\"header\")\n  - render(\"footer\")\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Render(&buf, "index", nil); err != nil {
+		t.Fatal(err)
+	}
+	expect = "<div>\n<p>new header</p>\n<p>new footer</p>\n</div>\n"
+	if buf.String() != expect {
+		t.Fatalf("expected %q but %q", expect, buf.String())
+	}
+}
+
+func TestRenderResult(t *testing.T) {
+	s := NewTemplateSet(nil)
+	for name, src := range map[string]string{
+		"index": "div\n  - memo title = user.name\n  - cache ttl = \"1m\"\n  p = title\n  - render(\"card\")\n",
+		"card":  "@deprecated \"use card2\"\np card\n",
+	} {
+		if err := s.AddRaw(name, src); err != nil {
+			t.Fatal(err)
+		}
+	}
+	value := Values{"user": map[string]interface{}{"name": "mattn"}}
+	var buf bytes.Buffer
+	r, err := s.RenderResult(context.Background(), &buf, "index", value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Bytes != int64(buf.Len()) || r.Bytes == 0 {
+		t.Fatalf("expected %d bytes but %d", buf.Len(), r.Bytes)
+	}
+	if !reflect.DeepEqual(r.Partials, []string{"card.slim"}) {
+		t.Fatalf("unexpected partials: %v", r.Partials)
+	}
+	if !strings.Contains(strings.Join(r.Accessed, " "), "user.name") {
+		t.Fatalf("unexpected accessed: %v", r.Accessed)
+	}
+	if len(r.Warnings) != 1 || r.Warnings[0].Message != "template is deprecated: card.slim: use card2" {
+		t.Fatalf("unexpected warnings: %v", r.Warnings)
+	}
+	if ttl, ok := r.Hints.TTL(); !ok || ttl != time.Minute {
+		t.Fatalf("unexpected ttl: %v", ttl)
+	}
+	if r.MemoHits != 0 {
+		t.Fatalf("expected no hits but %d", r.MemoHits)
+	}
+
+	r, err = s.RenderResult(context.Background(), io.Discard, "index", value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.MemoHits != 1 || len(r.Warnings) != 1 {
+		t.Fatalf("unexpected result: %d hits, %v", r.MemoHits, r.Warnings)
+	}
+}
+
+func TestContentFor(t *testing.T) {
+	set := NewTemplateSet(nil)
+	sources := map[string]string{
+		"layout": "html\n  head\n    - yield :head\n  body\n    block content\n    - yield :scripts\n",
+		"page":   "extends \"layout\"\n- content_for :head\n  title = title\nblock content\n  p = title\n  - render \"script\"\n",
+		"script": "- content_for :scripts\n  script src=\"a.js\"\n",
+	}
+	for name, src := range sources {
+		if err := set.AddRaw(name, src); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := set.Render(&buf, "page", Values{"title": "<Hi>"}); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<html>\n  <head>\n<title>&lt;Hi&gt;</title>\n  </head>\n  <body>\n    <p>&lt;Hi&gt;</p>\n<script src=\"a.js\">\n</script>\n  </body>\n</html>\n"
+	if got := buf.String(); got != expect {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+
+	tmpl, err := Parse(strings.NewReader("- content_for :head\n  title = title\np after\nhtml\n  head\n    - yield :head\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := tmpl.Execute(&buf, Values{"title": "Hi"}); err != nil {
+		t.Fatal(err)
+	}
+	expect = "<p>after</p>\n<html>\n  <head>\n<title>Hi</title>\n  </head>\n</html>\n"
+	if got := buf.String(); got != expect {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+
+	// the partials are rendered into the content too.
+	if err := set.AddRaw("meta", "meta charset=\"utf-8\"\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.AddRaw("partial", "- content_for :head\n  - render \"meta\"\np body\nhead == yield(:head)\n"); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := set.Render(&buf, "partial", nil); err != nil {
+		t.Fatal(err)
+	}
+	expect = "<p>body</p>\n<head><meta charset=\"utf-8\"/>\n</head>\n"
+	if got := buf.String(); got != expect {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+}
@@ -3,16 +3,19 @@ package slim
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"html"
 	"io"
 	"os"
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"runtime/pprof"
 	"strings"
+	"sync"
+	"time"
 	"unicode"
 
 	"github.com/mattn/go-slim/vm"
@@ -34,14 +37,12 @@ const (
 )
 
 var (
-	cSpace                   = []byte(" ")
-	cNewLine                 = []byte("\n")
-	cLessThanSlash           = []byte("</")
-	cGreaterThanNewLine      = []byte(">\n")
-	cSlashGreaterThanNewLine = []byte("/>\n")
-	cDoubleQuote             = []byte("\"")
-	cGreaterThan             = []byte(">")
-	cLessThan                = []byte("<")
+	cSpace            = []byte(" ")
+	cNewLine          = []byte("\n")
+	cLessThanSlash    = []byte("</")
+	cSlashGreaterThan = []byte("/>")
+	cGreaterThan      = []byte(">")
+	cLessThan         = []byte("<")
 )
 
 var emptyElements = []string{
@@ -92,7 +93,11 @@ type Node struct {
 	Expr     string
 	Children []*Node
 	Raw      bool
+	Leading  bool
+	Trailing bool
 	Indent   int
+	Else     *Node
+	Line     int
 }
 
 // NewChild create child node.
@@ -106,6 +111,12 @@ type stack struct {
 	node *Node
 }
 
+// isTextBlock returns true if the lines indented under n are the text of n,
+// like the filters, the text blocks of "|" and "'", and the comments.
+func isTextBlock(n *Node) bool {
+	return strings.HasSuffix(n.Name, ":") || n.Name == "|" || n.Name == "'" || n.Name == "/" || n.Name == "/!"
+}
+
 func isEmptyElement(n string) bool {
 	for _, s := range emptyElements {
 		if s == n {
@@ -117,25 +128,27 @@ func isEmptyElement(n string) bool {
 
 var rubyInlinePattern = regexp.MustCompile(`#{[^}]*}`)
 
+// rubyInline evaluate #{} in s, and escape the values as HTML except the
+// values typed HTML. It is used for the bodies of the filters like markdown
+// and the attributes of the components.
 func rubyInline(v *vm.VM, s string) (string, error) {
-	var fail error
-	text := rubyInlinePattern.ReplaceAllStringFunc(s, func(s string) string {
-		expr, err := v.Compile(s[2 : len(s)-1])
-		if err != nil {
-			fail = err
-			return ""
-		}
-		iv, err := v.Eval(expr)
-		if err != nil {
-			fail = err
-			return ""
-		}
-		return fmt.Sprint(iv)
+	return interpolate(v, s, func(_ string, value interface{}) string {
+		return escapeValue(value)
 	})
-	if fail != nil {
-		return "", fail
-	}
-	return text, nil
+}
+
+// interpolate replace #{} in s with the values formatted by f. f is called
+// with the text before #{} too.
+func interpolate(v *vm.VM, s string, f func(prefix string, value interface{}) string) (string, error) {
+	var sb strings.Builder
+	err := eachInline(v, s, func(s string) error {
+		sb.WriteString(s)
+		return nil
+	}, func(value interface{}) error {
+		sb.WriteString(f(sb.String(), value))
+		return nil
+	})
+	return sb.String(), err
 }
 
 // byteRepeat same as bytes.Repeat but Write to the io.Writer
@@ -146,6 +159,9 @@ func bytesRepeat(out io.Writer, b []byte, count int) {
 }
 
 func printNode(t *Template, out io.Writer, v *vm.VM, n *Node, indent int) error {
+	if err := v.Context().Err(); err != nil {
+		return err
+	}
 	if n.Name == "" && n.Expr == "" {
 		for _, c := range n.Children {
 			if err := printNode(t, out, v, c, indent); err != nil {
@@ -154,25 +170,44 @@ func printNode(t *Template, out io.Writer, v *vm.VM, n *Node, indent int) error
 		}
 	} else if n.Name == "/" {
 		return nil
+	} else if n.Name == "block" {
+		return printBlock(t, out, v, n, indent)
+	} else if n.Name == "mixin" {
+		return nil
+	} else if n.Name == "+" {
+		return printMixin(t, out, v, n, indent)
+	} else if n.Name == "<" {
+		return t.printHTMLLine(out, v, n, indent)
+	} else if n.Name == "|" || n.Name == "'" {
+		return t.printTextBlock(out, v, n, indent)
 	} else if n.Name == "/!" {
-		bytesRepeat(out, cSpace, indent*2)
+		writeIndent(out, v, indent)
 		out.Write([]byte("<!-- "))
-		out.Write([]byte(n.Text))
-		out.Write([]byte(" -->\n"))
+		out.Write([]byte(blockText(n.Text)))
+		out.Write([]byte(" -->"))
+		writeNewLine(out, v)
+	} else if n.Name == "/[" {
+		return printConditional(t, out, v, n, indent)
+	} else if n.Name == "doctype" {
+		return printDoctype(out, v, n, indent)
+	} else if c, ok := lookupComponent(n.Name); ok {
+		return printComponent(t, out, v, n, c)
 	} else {
-		// FIXME
-		doctype := n.Name == "doctype"
-		if doctype {
-			bytesRepeat(out, cSpace, indent*2)
-			out.Write([]byte("<!"))
-			out.Write([]byte(n.Name))
-			out.Write([]byte(" html"))
-		} else if n.Name != "" {
-			bytesRepeat(out, cSpace, indent*2)
+		if n.Name != "" {
+			writeIndent(out, v, indent)
+			if n.Leading {
+				out.Write(cSpace)
+			}
 			if strings.HasSuffix(n.Name, ":") {
 				name := n.Name[:len(n.Name)-1]
-				if en, ok := t.renderer[name]; ok {
-					return en(out, n, v)
+				en, ok := t.renderer[name]
+				if !ok {
+					en, ok = lookupFilter(name)
+				}
+				if ok {
+					return markDynamic(out, n.Line, func() error {
+						return en(out, n, v)
+					})
 				}
 				out.Write(cLessThan)
 				out.Write([]byte(name))
@@ -181,33 +216,20 @@ func printNode(t *Template, out io.Writer, v *vm.VM, n *Node, indent int) error
 				out.Write([]byte(n.Name))
 			}
 		}
-		if n.ID != "" {
-			out.Write([]byte(" id=\""))
-			out.Write([]byte(n.ID))
-			out.Write(cDoubleQuote)
-		}
-		if len(n.Class) > 0 {
-			out.Write([]byte(" class=\""))
-			for i, c := range n.Class {
-				if i > 0 {
-					out.Write(cSpace)
-				}
-				out.Write([]byte(c))
+		var tag *Tag
+		var unwind error
+		if (t.hooks != nil || settingsOf(v).testid) && n.Name != "" {
+			var err error
+			if tag, err = t.openTag(out, v, n); err != nil {
+				return err
 			}
-			out.Write(cDoubleQuote)
-		}
-		if len(n.Attr) > 0 && !doctype {
-			for _, a := range n.Attr {
-				if a.Value == "" {
-					out.Write(cSpace)
-					out.Write([]byte(a.Name))
-				} else {
-					value, err := rubyInline(v, a.Value)
-					if err != nil {
-						return err
-					}
-					fmt.Fprintf(out, " %s=%q", a.Name, value)
-				}
+		} else {
+			attrs, dynamic, err := evalAttrs(v, n)
+			if err != nil {
+				return err
+			}
+			if err := writeAttrs(out, n.Line, attrs, dynamic); err != nil {
+				return err
 			}
 		}
 		if !isEmptyElement(n.Name) {
@@ -216,104 +238,115 @@ func printNode(t *Template, out io.Writer, v *vm.VM, n *Node, indent int) error
 			}
 			cr := true
 			if n.Expr != "" {
-				expr, err := v.Compile(n.Expr)
+				expr, err := compileNode(v, n)
 				if err != nil {
 					return err
 				}
-				fe, ok := expr.(*vm.ForExpr)
-				if ok {
-					rhs, err := v.Eval(fe.RHS)
+				t.warnCalls(v, n, expr)
+				switch fe := expr.(type) {
+				case *vm.ForExpr:
+					if err := printFor(t, out, v, n, fe, indent); err != nil {
+						return err
+					}
+				case *vm.DeadlineExpr:
+					if err := printDeadline(t, out, v, n, fe, indent); err != nil {
+						return err
+					}
+				case *vm.DirectiveExpr:
+					d, ok := t.directives[fe.Name]
+					if !ok {
+						return errors.New("unknown directive: " + fe.Name)
+					}
+					if err := d(v, fe); err != nil {
+						return err
+					}
+				case *vm.FlushExpr:
+					printFlush(out)
+				case *vm.AssertExpr:
+					if err := printAssert(t, v, n, fe); err != nil {
+						return err
+					}
+				case *vm.ElseExpr:
+					return errors.New("unexpected else: " + n.Expr)
+				case *vm.BreakExpr:
+					ok, err := cond(v, fe.Cond)
 					if err != nil {
 						return err
 					}
-					ra := reflect.ValueOf(rhs)
-					typ := ra.Type().Kind()
-					switch typ {
-					case reflect.Array, reflect.Slice, reflect.Chan:
-					default:
-						return errors.New("can't iterate: " + n.Expr)
-					}
-					if n.Name != "" {
-						out.Write(cNewLine)
-					}
-					if typ == reflect.Chan {
-						i := 0
-						for {
-							rr, ok := ra.Recv()
-							if !ok {
-								break
-							}
-							x := rr.Interface()
-							i++
-							if fe.LHS2 != "" {
-								v.Set(fe.LHS1, i)
-								v.Set(fe.LHS2, x)
-							} else {
-								v.Set(fe.LHS1, x)
-							}
-							for _, c := range n.Children {
-								if err := printNode(t, out, v, c, indent); err != nil {
-									return err
-								}
-							}
-						}
-					} else {
-						l := ra.Len()
-						for i := 0; i < l; i++ {
-							x := ra.Index(i).Interface()
-							if fe.LHS2 != "" {
-								v.Set(fe.LHS1, i)
-								v.Set(fe.LHS2, x)
-							} else {
-								v.Set(fe.LHS1, x)
-							}
-							for _, c := range n.Children {
-								if err := printNode(t, out, v, c, indent); err != nil {
-									return err
-								}
-							}
+					if ok {
+						return errBreak
+					}
+				case *vm.ContinueExpr:
+					ok, err := cond(v, fe.Cond)
+					if err != nil {
+						return err
+					}
+					if ok {
+						return errContinue
+					}
+				default:
+					if isContentFor(expr) {
+						if err := printContentFor(t, v, n, expr); err != nil {
+							return err
 						}
+						break
 					}
-				} else {
+					start := time.Now()
 					r, err := v.Eval(expr)
+					t.trace(TraceExpr, n.Line, n.Expr, start, err)
 					if err != nil {
 						return err
 					}
 					if r != nil {
-						text := fmt.Sprint(r)
-						if !n.Raw {
-							text = html.EscapeString(text)
+						// the value in script is encoded as JSON, and checked
+						// like the other values.
+						if n.Name == "script" {
+							err = v.CheckPrint(r)
+						} else {
+							r, err = printable(v, r)
+						}
+						if err != nil {
+							return err
+						}
+						if err := t.printValue(out, n, tag, r); err != nil {
+							return err
 						}
-						out.Write([]byte(text))
 					}
 					cr = false
 				}
-				text, err := rubyInline(v, n.Text)
-				if err != nil {
+				if err := t.printText(out, v, n, tag); err != nil {
 					return err
 				}
-				out.Write([]byte(text))
 			} else if len(n.Children) > 0 {
-				out.Write(cNewLine)
-				for _, c := range n.Children {
-					if err := printNode(t, out, v, c, indent+1); err != nil {
+				writeNewLine(out, v)
+				err := withElem(v, n.Name, func() error {
+					for _, c := range n.Children {
+						if err := printNode(t, out, v, c, indent+1); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+				if err != nil {
+					if err != errBreak && err != errContinue {
 						return err
 					}
+					// break and continue leave the element after closing
+					// it.
+					unwind = err
 				}
-				text, err := rubyInline(v, n.Text)
-				if err != nil {
-					return err
+				if unwind == nil {
+					if err := t.printText(out, v, n, tag); err != nil {
+						return err
+					}
 				}
-				out.Write([]byte(text))
 			} else if n.Text != "" {
-				text, err := rubyInline(v, n.Text)
-				if err != nil {
+				if err := t.printText(out, v, n, tag); err != nil {
 					return err
 				}
-				out.Write([]byte(text))
 				cr = false
 			} else if cr {
-				out.Write(cNewLine)
+				writeNewLine(out, v)
 			}
 			if n.Name != "" {
 				name := n.Name
@@ -321,29 +354,381 @@ func printNode(t *Template, out io.Writer, v *vm.VM, n *Node, indent int) error
 					name = n.Name[:len(n.Name)-1]
 				}
 
+				if err := t.closeTag(tag); err != nil {
+					return err
+				}
 				if cr {
-					bytesRepeat(out, cSpace, indent*2)
+					writeIndent(out, v, indent)
 				}
 				out.Write(cLessThanSlash)
 				out.Write([]byte(name))
-				out.Write(cGreaterThanNewLine)
+				out.Write(cGreaterThan)
+				if n.Trailing {
+					out.Write(cSpace)
+				}
+				writeNewLine(out, v)
+			}
+			if unwind != nil {
+				return unwind
 			}
-		} else if doctype {
-			out.Write(cGreaterThanNewLine)
 		} else {
-			out.Write(cSlashGreaterThanNewLine)
+			if err := t.closeTag(tag); err != nil {
+				return err
+			}
+			if isXHTML(v) {
+				out.Write(cSpace)
+			}
+			out.Write(cSlashGreaterThan)
+			if n.Trailing {
+				out.Write(cSpace)
+			}
+			writeNewLine(out, v)
 		}
 	}
 	return nil
 }
 
+// isJSONLDScript returns true if n is script tag of application/ld+json.
+func isJSONLDScript(n *Node) bool {
+	if n.Name != "script" {
+		return false
+	}
+	for _, a := range n.Attr {
+		if a.Name == "type" && a.Value == "application/ld+json" {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	errBreak    = errors.New("break outside of loop")
+	errContinue = errors.New("continue outside of loop")
+)
+
+// cond evaluate the condition of break and continue. nil is always true.
+func cond(v *vm.VM, expr vm.Expr) (bool, error) {
+	if expr == nil {
+		return true, nil
+	}
+	r, err := v.Eval(expr)
+	if err != nil {
+		return false, err
+	}
+	return Truthy(r), nil
+}
+
+// Truthy returns false for nil, false, zero numbers, and empty strings or
+// collections, like Ruby and Jinja. Otherwise true. The conditions of the
+// templates are evaluated with it, so the helpers can reuse the same rule.
+// See vm.Truthy.
+func Truthy(x interface{}) bool {
+	return vm.Truthy(x)
+}
+
+// isNilValue returns true if x is nil, or the nil pointer, interface, map,
+// slice or channel.
+func isNilValue(x interface{}) bool {
+	if x == nil {
+		return true
+	}
+	rv := reflect.ValueOf(x)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Chan:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// printFor render children of n for each items of the collection. If the
+// collection is empty, the else block is rendered instead. break and
+// continue in the children close the elements around them before leaving.
+func printFor(t *Template, out io.Writer, v *vm.VM, n *Node, fe *vm.ForExpr, indent int) (err error) {
+	count := 0
+	defer func() {
+		if err == errBreak {
+			err = nil
+		}
+		if err == nil && count == 0 {
+			err = printElse(t, out, v, n, indent)
+		}
+	}()
+	start := time.Now()
+	rhs, err := v.Eval(fe.RHS)
+	t.trace(TraceExpr, n.Line, n.Expr, start, err)
+	if err != nil {
+		return err
+	}
+	if isNilValue(rhs) {
+		// nil is empty, including the typed nil like (*OrderedMap)(nil).
+		return nil
+	}
+	each := func(key, value interface{}) error {
+		count++
+		if err := v.IterateLoop(count); err != nil {
+			return err
+		}
+		if a := v.Audit(); a != nil {
+			a.Alias(fe.LHS1, fe.RHS, true)
+			if fe.LHS2 != "" {
+				a.Alias(fe.LHS2, fe.RHS, true)
+			}
+		}
+		if fe.LHS2 != "" {
+			v.Set(fe.LHS1, key)
+			v.Set(fe.LHS2, value)
+		} else {
+			v.Set(fe.LHS1, value)
+		}
+		for _, c := range n.Children {
+			if err := printNode(t, out, v, c, indent); err != nil {
+				if err == errContinue {
+					return nil
+				}
+				return err
+			}
+		}
+		return nil
+	}
+	if om, ok := rhs.(*OrderedMap); ok {
+		if n.Name != "" {
+			writeNewLine(out, v)
+		}
+		for _, key := range om.Keys() {
+			// like Go, the single variable is the key.
+			var value interface{} = key
+			if fe.LHS2 != "" {
+				value = om.Get(key)
+			}
+			if err := each(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if it, ok := rhs.(Iterator); ok {
+		if n.Name != "" {
+			writeNewLine(out, v)
+		}
+		for i := 0; ; i++ {
+			x, ok := it.Next()
+			if !ok {
+				break
+			}
+			if err := each(i, x); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if c, ok := rhs.(Collection); ok {
+		if n.Name != "" {
+			writeNewLine(out, v)
+		}
+		l := c.Len()
+		for i := 0; i < l; i++ {
+			if err := each(i, c.At(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if _, ok := rhs.(vm.NullValue); ok {
+		return nil
+	}
+	ra := reflect.ValueOf(rhs)
+	typ := ra.Type().Kind()
+	switch typ {
+	case reflect.Array, reflect.Slice, reflect.Chan, reflect.Map:
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return errors.New("can't iterate: " + n.Expr)
+	}
+	if n.Name != "" {
+		writeNewLine(out, v)
+	}
+	switch typ {
+	case reflect.Chan:
+		// receive with ctx, so the rendering is cancelled while
+		// waiting the items. The index starts from 1 as ever.
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: ra},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(v.Context().Done())},
+		}
+		for i := 1; ; i++ {
+			chosen, rr, ok := reflect.Select(cases)
+			if chosen == 1 {
+				return v.Context().Err()
+			}
+			if !ok {
+				break
+			}
+			if err := each(i, rr.Interface()); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, rk := range sortedKeys(ra) {
+			key := rk.Interface()
+			value := key
+			if fe.LHS2 != "" {
+				value = ra.MapIndex(rk).Interface()
+			}
+			if err := each(key, value); err != nil {
+				return err
+			}
+		}
+	case reflect.Array, reflect.Slice:
+		l := ra.Len()
+		for i := 0; i < l; i++ {
+			if err := each(i, ra.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+	default:
+		// iterate 0 to n-1 like "for i in 5".
+		l := int(ra.Convert(reflect.TypeOf(0)).Int())
+		for i := 0; i < l; i++ {
+			if err := each(i, i); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// printDeadline render children of n with the context which is cancelled
+// after the timeout. If the timeout is exceeded, the output is discarded and
+// the else block is rendered instead.
+func printDeadline(t *Template, out io.Writer, v *vm.VM, n *Node, de *vm.DeadlineExpr, indent int) error {
+	d, err := v.Eval(de.Timeout)
+	if err != nil {
+		return err
+	}
+	timeout, ok := d.(time.Duration)
+	if !ok {
+		timeout, err = time.ParseDuration(fmt.Sprint(d))
+		if err != nil {
+			return errors.New("invalid deadline: " + n.Expr)
+		}
+	}
+	parent := v.Context()
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	var buf bytes.Buffer
+	v.SetContext(ctx)
+	err = withWriter(v, &buf, func() error {
+		for _, c := range n.Children {
+			if err := printNode(t, &buf, v, c, indent); err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	v.SetContext(parent)
+	if err == nil {
+		return markDynamic(out, n.Line, func() error {
+			_, err := out.Write(buf.Bytes())
+			return err
+		})
+	}
+	if ctx.Err() != context.DeadlineExceeded || parent.Err() != nil {
+		return err
+	}
+	return printElse(t, out, v, n, indent)
+}
+
+// printElse render the else block of n if it exists.
+func printElse(t *Template, out io.Writer, v *vm.VM, n *Node, indent int) error {
+	if n.Else == nil {
+		return nil
+	}
+	for _, c := range n.Else.Children {
+		if err := printNode(t, out, v, c, indent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileNode compile the expression of n. The control lines like "- break"
+// are compiled as the statements.
+func compileNode(v *vm.VM, n *Node) (vm.Expr, error) {
+	if n.Name == "" {
+		return v.CompileStmt(n.Expr)
+	}
+	return v.Compile(n.Expr)
+}
+
+// linkElse move "- else" nodes into Else of the previous sibling.
+func linkElse(n *Node) {
+	children := n.Children[:0]
+	for _, c := range n.Children {
+		linkElse(c)
+		if len(children) > 0 && c.Name == "" && strings.TrimSpace(c.Expr) == "else" {
+			prev := children[len(children)-1]
+			if prev.Else == nil && prev.Name == "" && prev.Expr != "" {
+				prev.Else = c
+				continue
+			}
+		}
+		children = append(children, c)
+	}
+	n.Children = children
+}
+
 // Template is the representation of a parsed template.
+//
+// Once FuncMap and RegisterRenderer are called, a Template can be executed by
+// multiple goroutines in parallel.
 type Template struct {
-	root     *Node
-	renderer map[string]Renderer
-	inner    map[string]*Template
-	fm       Funcs
-	dir      string
+	root       *Node
+	renderer   map[string]Renderer
+	mu         sync.Mutex
+	inner      map[string]*Template
+	fm         Funcs
+	dir        string
+	vm         *vm.VM
+	sanitizer  Sanitizer
+	markdown   Markdown
+	directives map[string]Directive
+	memo       *Memo
+	name       string
+	tracer     Tracer
+	logger     Logger
+	warned     sync.Map
+	mixins     map[string]*mixin
+	loader     Loader
+	cache      *Cache
+	snapshot   bool
+	debug      bool
+	buffered   bool
+
+	flushThreshold  int
+	hooks           *Hooks
+	testid          bool
+	testIDs         map[*Node]string
+	testIDOnce      sync.Once
+	annotations     map[string]string
+	missing         MissingPolicy
+	missingTemplate MissingTemplate
+	mode            OutputMode
+	parent          *Template
+}
+
+// top returns the template which is rendered at first. Templates rendered by
+// render() read the memo, tracer, logger, markdown and sanitizer from it at
+// rendering, so the settings changed after the first parse are applied.
+func (t *Template) top() *Template {
+	for t.parent != nil {
+		t = t.parent
+	}
+	return t
 }
 
 // ParseFile parse content of fname.
@@ -365,8 +750,36 @@ var defaultRenderers = map[string]Renderer{
 	"css":        cssRenderer,
 }
 
+// Directive is a type for indicating custom directive like
+// "- name lhs = rhs". It typically bind the value to lhs.
+type Directive func(v *vm.VM, d *vm.DirectiveExpr) error
+
 // Parse parse content with reading from reader.
 func Parse(in io.Reader) (*Template, error) {
+	return parse(in, nil)
+}
+
+// parse parse content with the tags for "- ifdef".
+func parse(in io.Reader, tags map[string]bool) (*Template, error) {
+	tree, err := ParseTree(in)
+	if err != nil {
+		return nil, err
+	}
+	t, err := newTemplate(tree, tags)
+	if err != nil {
+		return nil, err
+	}
+	if ff, ok := in.(*os.File); ok {
+		t.dir, _ = filepath.Abs(filepath.Dir(ff.Name()))
+		t.name = ff.Name()
+	}
+	return t, nil
+}
+
+// ParseTree parse content with reading from reader, and returns the tree.
+// The tree can be added to the set by AddTree without parsing the source,
+// like the code generated by "slimc embed".
+func ParseTree(in io.Reader) (*Tree, error) {
 	if in == nil {
 		return nil, errors.New("invalid input")
 	}
@@ -375,9 +788,45 @@ func Parse(in io.Reader) (*Template, error) {
 	node := root
 	stk := []stack{}
 	last := -1
-	for scanner.Scan() {
-		l := scanner.Text()
+	blank := 0
+	line := 0
+	annotations := map[string]string{}
+	front := true
+	// nested is the rest of the line after "li:" like "a href=x", which is
+	// parsed as the child of the element in the line.
+	nested := ""
+	for nested != "" || scanner.Scan() {
+		l := nested
+		if nested != "" {
+			nested = ""
+		} else {
+			line++
+			l = scanner.Text()
+			if front {
+				if name, value, ok := parseAnnotation(l); ok {
+					annotations[name] = value
+					continue
+				}
+				front = strings.TrimSpace(l) == ""
+			}
+			if strings.TrimSpace(l) == "" {
+				// blank lines are kept only in the text of filters
+				blank++
+				continue
+			}
+		}
+		lf := strings.Repeat("\n", blank+1)
+		blank = 0
 		rs := []rune(l)
+		// nest returns true if name ends with ":" and the element follows it.
+		nest := func(name string, n int) bool {
+			rest := strings.TrimSpace(string(rs[n:]))
+			if len(name) < 2 || !strings.HasSuffix(name, ":") || rest == "" {
+				return false
+			}
+			nested = strings.Repeat(" ", node.Indent+1) + rest
+			return true
+		}
 		st := sNeutral
 		tag := ""
 		id := ""
@@ -398,8 +847,8 @@ func Parse(in io.Reader) (*Template, error) {
 
 				if n > last {
 					last = n
-					if strings.HasSuffix(node.Name, ":") {
-						node.Text += "\n" + strings.Repeat(" ", n) + tag
+					if isTextBlock(node) {
+						node.Text += lf + strings.Repeat(" ", n) + tag
 						st = sText
 						break break_st
 					}
@@ -407,8 +856,8 @@ func Parse(in io.Reader) (*Template, error) {
 					stk = append(stk, stack{n: n, node: node})
 				} else if n == last {
 					last = n
-					if strings.HasSuffix(node.Name, ":") {
-						node.Text += "\n" + strings.Repeat(" ", n) + tag
+					if isTextBlock(node) && node.Indent < n {
+						node.Text += lf + strings.Repeat(" ", n) + tag
 						st = sText
 						break break_st
 					}
@@ -428,34 +877,58 @@ func Parse(in io.Reader) (*Template, error) {
 					stk[len(stk)-1].node = node
 				} else if n < last {
 					last = n
-					found := (*Node)(nil)
-					for i := 0; i < len(stk); i++ {
-						if i > 0 && stk[i].n >= n {
-							found = stk[i-1].node
-							stk = stk[:i]
-							break
-						}
+					// the parent is the nearest node which is less
+					// indented than the line, or the root.
+					i := len(stk)
+					for i > 0 && stk[i-1].n >= n {
+						i--
+					}
+					parent := root
+					if i > 0 {
+						parent = stk[i-1].node
 					}
-					if found == nil && strings.HasSuffix(node.Name, ":") {
-						node.Text += "\n" + strings.Repeat(" ", n) + tag
+					if parent == node && isTextBlock(node) {
+						node.Text += lf + strings.Repeat(" ", n) + tag
 						st = sText
 						break break_st
 					}
-					node = found
-					if node == nil {
-						node = root.NewChild()
-						stk = stk[:1]
-					} else {
-						node = node.NewChild()
-						stk = append(stk, stack{n: n, node: node})
-					}
+					node = parent.NewChild()
+					stk = append(stk[:i], stack{n: n, node: node})
 				}
+				node.Line = line
+				node.Indent = n
 				switch r {
 				case '=':
 					node.Name = "div"
 					st = sExpr
 					break break_st
-				case '|':
+				case '|', '\'':
+					node.Name = tag
+					st = sText
+					break break_st
+				case '<':
+					// the line of HTML is written as is.
+					node.Name = "<"
+					node.Text = string(rs[n:])
+					n = len(rs)
+					break break_st
+				case '/':
+					node.Name = "/"
+					rest := string(rs[n+1:])
+					if strings.HasPrefix(rest, "!") {
+						node.Name = "/!"
+						n++
+					} else if i := strings.Index(rest, "]"); strings.HasPrefix(rest, "[") && i > 0 {
+						node.Name = "/["
+						node.Text = strings.TrimSpace(rest[1:i])
+						n += len([]rune(rest[:i])) + 1
+						st = sComment
+						break break_st
+					}
+					st = sText
+					break break_st
+				case '+':
+					node.Name = "+"
 					st = sText
 					break break_st
 				case '-':
@@ -479,7 +952,13 @@ func Parse(in io.Reader) (*Template, error) {
 				node.Name = tag
 			case sTag:
 				if eol {
-					tag += string(r)
+					if !whitespace(node, tag, r) {
+						tag += string(r)
+					}
+					node.Name = tag
+					break
+				}
+				if whitespace(node, tag, r) {
 					node.Name = tag
 					break
 				}
@@ -511,7 +990,10 @@ func Parse(in io.Reader) (*Template, error) {
 						st = sText
 						break break_st
 					}
-					if unicode.IsSpace(r) {
+					if unicode.IsSpace(r) && nest(tag, n) {
+						node.Name = tag[:len(tag)-1]
+						n = len(rs)
+					} else if unicode.IsSpace(r) {
 						node.Name = tag
 						st = sAttrKey
 					} else {
@@ -523,15 +1005,29 @@ func Parse(in io.Reader) (*Template, error) {
 					if isUnquotedAttributeValue(r) { // FIXME
 						id += string(r)
 						node.ID = id
+					} else if whitespace(node, node.Name, r) {
+						node.ID = id
 					}
 					break
 				}
+				if whitespace(node, node.Name, r) {
+					node.ID = id
+					tag = node.Name
+					st = sTag
+					break
+				}
 				switch r {
 				case '.':
 					node.ID = id
 					st = sClass
 				default:
-					if !isUnquotedAttributeValue(r) { // FIXME
+					if unicode.IsSpace(r) && nest(id, n) {
+						node.ID = id[:len(id)-1]
+						n = len(rs)
+					} else if unicode.IsSpace(r) {
+						node.ID = id
+						st = sAttrKey
+					} else if !isUnquotedAttributeValue(r) { // FIXME
 						node.ID = id
 						st = sEq
 					} else {
@@ -543,7 +1039,18 @@ func Parse(in io.Reader) (*Template, error) {
 					if isUnquotedAttributeValue(r) { // FIXME
 						class += string(r)
 						node.Class = append(node.Class, class)
+					} else if whitespace(node, node.Name, r) && class != "" {
+						node.Class = append(node.Class, class)
+					}
+					break
+				}
+				if whitespace(node, node.Name, r) {
+					if class != "" {
+						node.Class = append(node.Class, class)
+						class = ""
 					}
+					tag = node.Name
+					st = sTag
 					break
 				}
 				switch r {
@@ -553,11 +1060,18 @@ func Parse(in io.Reader) (*Template, error) {
 						class = ""
 					}
 				default:
-					if !isUnquotedAttributeValue(r) { // FIXME
+					if unicode.IsSpace(r) && nest(class, n) {
+						node.Class = append(node.Class, class[:len(class)-1])
+						n = len(rs)
+					} else if !isUnquotedAttributeValue(r) { // FIXME
 						if class != "" {
 							node.Class = append(node.Class, class)
 						}
-						st = sEq
+						if unicode.IsSpace(r) {
+							st = sAttrKey
+						} else {
+							st = sEq
+						}
 					} else {
 						class += string(r)
 					}
@@ -565,7 +1079,9 @@ func Parse(in io.Reader) (*Template, error) {
 			case sAttrKey:
 				if eol {
 					aname += string(r)
-					if avalue != "" {
+					if isSplat(strings.TrimSpace(aname)) {
+						node.Attr = append(node.Attr, Attr{Name: "*", Value: strings.TrimSpace(aname)[1:]})
+					} else if avalue != "" {
 						node.Attr = append(node.Attr, Attr{Name: strings.TrimSpace(aname), Value: ""})
 					} else {
 						node.Text = strings.TrimSpace(aname)
@@ -580,6 +1096,11 @@ func Parse(in io.Reader) (*Template, error) {
 						st = sAttrValue
 					}
 				default:
+					if unicode.IsSpace(r) && isSplat(strings.TrimSpace(aname)) {
+						node.Attr = append(node.Attr, Attr{Name: "*", Value: strings.TrimSpace(aname)[1:]})
+						aname = ""
+						break
+					}
 					aname += string(r)
 				}
 			case sAttrValue:
@@ -594,6 +1115,12 @@ func Parse(in io.Reader) (*Template, error) {
 					break
 				}
 				if avalue != "" && unicode.IsSpace(r) {
+					if avalue[0] == '(' && strings.Count(avalue, "(") > strings.Count(avalue, ")") ||
+						avalue[0] == '{' && strings.Count(avalue, "{") > strings.Count(avalue, "}") ||
+						avalue[0] == '[' && strings.Count(avalue, "[") > strings.Count(avalue, "]") {
+						avalue += string(r)
+						break
+					}
 					if avalue[0] == '"' {
 						if avalue[len(avalue)-1] == '"' {
 							avalue = avalue[1 : len(avalue)-1]
@@ -610,14 +1137,20 @@ func Parse(in io.Reader) (*Template, error) {
 					avalue += string(r)
 				}
 			case sEq:
-				if r != '=' && !unicode.IsSpace(r) {
+				if r == '\'' {
+					node.Trailing = true
+				} else if !whitespace(node, node.Name, r) && r != '=' && !unicode.IsSpace(r) {
 					node.Expr += string(r)
 				}
 				st = sExpr
 			case sExpr:
-				if node.Expr == "" && r == '=' {
+				switch {
+				case node.Expr == "" && r == '=':
 					node.Raw = true
-				} else {
+				case node.Expr == "" && node.Name != "" && r == '\'':
+					node.Trailing = true
+				case node.Expr == "" && whitespace(node, node.Name, r):
+				default:
 					node.Expr += string(r)
 				}
 			case sText:
@@ -630,22 +1163,60 @@ func Parse(in io.Reader) (*Template, error) {
 	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
+	return &Tree{Root: root, Annotations: annotations}, nil
+}
+
+// newTemplate create the template of tree with the tags for "- ifdef". tree
+// is not changed.
+func newTemplate(tree *Tree, tags map[string]bool) (*Template, error) {
+	root := copyNode(tree.Root)
+	if err := applyTags(root, tags); err != nil {
+		return nil, err
+	}
+	linkElse(root)
+	hoistMixins(root)
+	mixins := map[string]*mixin{}
+	if err := parseMixins(root, mixins); err != nil {
+		return nil, err
+	}
 	newrenderer := make(map[string]Renderer)
 	for n, k := range defaultRenderers {
 		newrenderer[n] = k
 	}
+	annotations := make(map[string]string, len(tree.Annotations))
+	for k, v := range tree.Annotations {
+		annotations[k] = v
+	}
 
 	dir, _ := os.Getwd()
-	if ff, ok := in.(*os.File); ok {
-		dir, _ = filepath.Abs(filepath.Dir(ff.Name()))
+	name := ""
+	t := &Template{
+		root:       root,
+		renderer:   newrenderer,
+		inner:      map[string]*Template{},
+		fm:         nil,
+		dir:        dir,
+		vm:         vm.New(),
+		directives: map[string]Directive{},
+		memo:       NewMemo(DefaultMemoTTL),
+		name:       name,
+		mixins:     mixins,
+
+		annotations: annotations,
 	}
-	return &Template{
-		root:     root,
-		renderer: newrenderer,
-		inner:    map[string]*Template{},
-		fm:       nil,
-		dir:      dir,
-	}, nil
+	t.renderer["sanitize"] = t.sanitizeRenderer
+	t.renderer["gotemplate"] = t.gotemplateRenderer
+	t.renderer["markdown"] = t.markdownRenderer
+	t.directives["memo"] = t.memoDirective
+	t.directives["cache"] = cacheDirective
+	t.directives["json"] = jsonDirective
+	return t, nil
+}
+
+// Name returns the name of the template. It is the file name if the
+// template is parsed from the file.
+func (t *Template) Name() string {
+	return t.name
 }
 
 // FuncMap set the template's function map.
@@ -653,6 +1224,78 @@ func (t *Template) FuncMap(m Funcs) {
 	t.fm = m
 }
 
+// RegisterDirective register custom directive named with the name.
+func (t *Template) RegisterDirective(name string, d Directive) {
+	t.directives[name] = d
+}
+
+// Restrict enable the sandboxed mode for the templates supplied by users.
+// See vm.VM.Restrict.
+func (t *Template) Restrict() {
+	t.vm.Restrict()
+}
+
+// Allow allow calling methods on the type of value in the sandboxed mode.
+// See vm.VM.Allow.
+func (t *Template) Allow(value interface{}, methods ...string) {
+	t.vm.Allow(value, methods...)
+}
+
+// RestrictData enable the whitelist-only data mode for rendering untrusted
+// templates against the rich objects. See vm.VM.RestrictData.
+func (t *Template) RestrictData() {
+	t.vm.RestrictData()
+}
+
+// Expose expose the types of values in the whitelist-only data mode. The
+// structs which embed Exported are exposed without this.
+func (t *Template) Expose(values ...interface{}) {
+	t.vm.Expose(values...)
+}
+
+// Exported is the marker to expose the struct in the whitelist-only data
+// mode. See vm.Exported.
+type Exported = vm.Exported
+
+// SetBackend set the backend of the expression language. The statements
+// like "- for x in expr" are kept, and the expressions in them are compiled
+// by the backend. See vm.Backend.
+func (t *Template) SetBackend(b vm.Backend) {
+	t.vm.SetBackend(b)
+}
+
+// SetNullObject set the null-object mode. In the mode, failed access like
+// missing members results vm.Null which is rendered as empty, and no items
+// are iterated over it. See vm.VM.SetNullObject.
+func (t *Template) SetNullObject(on bool) {
+	t.vm.SetNullObject(on)
+}
+
+// SetFieldTags set the struct tags to look up the fields, like
+// `json:"user_name"`. The default is "slim" and "json". See
+// vm.VM.SetFieldTags.
+func (t *Template) SetFieldTags(tags ...string) {
+	t.vm.SetFieldTags(tags...)
+}
+
+// SetGetterFallback set whether the member which is not the field or the key
+// is referenced with the getter method like GetName(). It is disabled by
+// default. See vm.VM.SetGetterFallback.
+func (t *Template) SetGetterFallback(on bool) {
+	t.vm.SetGetterFallback(on)
+}
+
+// SetRedactor set the hook called on every access to the members of the
+// structs and the maps, to redact the values centrally. See vm.Redactor.
+func (t *Template) SetRedactor(r vm.Redactor) {
+	t.vm.SetRedactor(r)
+}
+
+// SetLimits set the budget of each execution of the template.
+func (t *Template) SetLimits(l vm.Limits) {
+	t.vm.SetLimits(l)
+}
+
 // RegisterRenderer register custom render named with the name.
 func (t *Template) RegisterRenderer(name string, r Renderer) {
 	t.renderer[name] = r
@@ -661,17 +1304,48 @@ func (t *Template) RegisterRenderer(name string, r Renderer) {
 // Execute applies a parsed template to the specified value object,
 // and writes the output to out.
 func (t *Template) execute(v *vm.VM, out io.Writer, value interface{}) error {
-	if t.fm != nil {
-		for key, val := range t.fm {
-			v.Set(key, val)
-		}
+	setValues(v, t.fm, value)
+	ctx := v.Context()
+	v.SetContext(withData(ctx, value))
+	defer v.SetContext(ctx)
+	return t.print(v, out)
+}
+
+// print render the nodes of t, or the layout if t extends it.
+func (t *Template) print(v *vm.VM, out io.Writer) error {
+	t.debugComment(out, v, "begin")
+	var err error
+	if n := extendsNode(t.root); n != nil {
+		err = t.extend(v, out, n)
+	} else {
+		err = printNode(t, out, v, t.root, 0)
+	}
+	if err != nil {
+		return err
+	}
+	t.debugComment(out, v, "end")
+	return nil
+}
+
+// setValues set the functions and the fields of value into v.
+func setValues(v *vm.VM, fm Funcs, value interface{}) {
+	for key, val := range fm {
+		v.Set(key, val)
 	}
 	if value != nil {
 		rv := reflect.ValueOf(value)
 		rt := rv.Type()
 		if rt.Kind() == reflect.Map {
 			for _, rk := range rv.MapKeys() {
-				v.Set(rk.String(), rv.MapIndex(rk).Interface())
+				// the keys of map[interface{}]interface{} are the names
+				// only if they are the strings.
+				key := rk
+				if key.Kind() == reflect.Interface {
+					key = key.Elem()
+				}
+				if key.Kind() == reflect.String {
+					v.Set(key.String(), rv.MapIndex(rk).Interface())
+				}
 			}
 		} else if rt.Kind() == reflect.Struct {
 			for i := 0; i < rt.NumField(); i++ {
@@ -679,56 +1353,312 @@ func (t *Template) execute(v *vm.VM, out io.Writer, value interface{}) error {
 			}
 		}
 	}
-	return printNode(t, out, v, t.root, 0)
 }
 
 // Execute applies a parsed template to the specified value object,
 // and writes the output to out.
 func (t *Template) Execute(out io.Writer, value interface{}) error {
-	v := vm.New()
+	return t.ExecuteContext(context.Background(), out, value)
+}
+
+// ExecuteContext is same as Execute but the rendering is cancelled when ctx
+// is done. The ctx is passed to the functions which take context.Context as
+// first argument.
+func (t *Template) ExecuteContext(ctx context.Context, out io.Writer, value interface{}) error {
+	return t.executeContext(ctx, out, value, nil)
+}
+
+func (t *Template) executeContext(ctx context.Context, out io.Writer, value interface{}, a *vm.Audit) error {
+	if t.snapshot {
+		value = Snapshot(value)
+	}
+	out, done := t.buffer(out)
+	out = t.flusher(out)
+	if t.cache != nil {
+		ctx = t.cache.withView(ctx)
+	}
+	ctx = withContents(ctx)
+	v := t.vm.Clone()
+	v.SetContext(t.withSettings(ctx))
+	if a != nil {
+		v.SetAudit(a)
+	}
+	t.setHelpers(v, out, value)
+
+	var err error
+	withLabels(v, labelTemplate, t.name, func() {
+		err = t.execute(v, out, value)
+	})
+	return done(err)
+}
 
+// writerKey is the key of the writer of the block which is rendered into
+// the buffer with v.
+type writerKey struct {
+	v *vm.VM
+}
+
+// withWriter call f which render the block into w, so render() in the block
+// writes to w too.
+func withWriter(v *vm.VM, w io.Writer, f func() error) error {
+	ctx := v.Context()
+	v.SetContext(context.WithValue(ctx, writerKey{v}, w))
+	defer v.SetContext(ctx)
+	return f()
+}
+
+// writerOf returns the writer of the block which is rendered with v, or out
+// if it is not in the block.
+func writerOf(v *vm.VM, out io.Writer) io.Writer {
+	if w, ok := v.Context().Value(writerKey{v}).(io.Writer); ok {
+		return w
+	}
+	return out
+}
+
+// elemKey is the key of the name of the element like script which the text
+// blocks are rendered in with v.
+type elemKey struct {
+	v *vm.VM
+}
+
+// rawTextElements are the elements which the texts in them are escaped or
+// kept in the different way from the others.
+var rawTextElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"pre":      true,
+	"textarea": true,
+}
+
+// withElem call f which render the children of the element named name. The
+// text blocks in script and style are escaped as javascript and CSS, and
+// the whitespaces in the text blocks in pre and textarea are kept in the
+// compact mode.
+func withElem(v *vm.VM, name string, f func() error) error {
+	if !rawTextElements[name] {
+		return f()
+	}
+	ctx := v.Context()
+	v.SetContext(context.WithValue(ctx, elemKey{v}, name))
+	defer v.SetContext(ctx)
+	return f()
+}
+
+// elemOf returns the name of the element like script which the text blocks
+// are rendered in with v, or name if it is not in them.
+func elemOf(v *vm.VM, name string) string {
+	if elem, ok := v.Context().Value(elemKey{v}).(string); ok {
+		return elem
+	}
+	return name
+}
+
+// setHelpers set the helpers which depend on the execution.
+func (t *Template) setHelpers(v *vm.VM, out io.Writer, value interface{}) {
 	v.Set("render", func(name string) error {
-		if !filepath.IsAbs(name) {
-			name = filepath.Join(t.dir, name)
+		start := time.Now()
+		out := writerOf(v, out)
+		tt, err := t.lookupInner(v.Context(), name)
+		if err == nil {
+			withLabels(v, labelFragment, name, func() {
+				err = tt.execute(v, out, value)
+			})
+		} else {
+			err = t.renderMissing(v.Context(), out, name, err)
 		}
-		if tt, ok := t.inner[name]; ok {
-			tt.dir = filepath.Dir(name)
-			return tt.execute(v, out, value)
+		t.trace(TracePartial, 0, name, start, err)
+		return err
+	})
+	v.Set("yield", func(name string) HTML {
+		return yield(v.Context(), name)
+	})
+	v.Set("sanitize", func(s interface{}) HTML {
+		return HTML(t.sanitize(fmt.Sprint(s)))
+	})
+	v.Set("json_ld", func(args ...Value) (Value, error) {
+		for _, arg := range args {
+			if err := v.CheckPrint(arg); err != nil {
+				return nil, err
+			}
 		}
-		tt, err := ParseFile(name)
-		if err != nil {
-			return err
+		return JSONLD(args...)
+	})
+	v.Set("include", func(name string, locals ...map[string]interface{}) (string, error) {
+		return t.include(v, name, locals...)
+	})
+}
+
+// maxIncludeDepth is the limit of nested includes.
+const maxIncludeDepth = 32
+
+type includeKey struct{}
+
+// include render the template named name with the isolated scope which has
+// only the locals and the helpers, and returns the output.
+func (t *Template) include(v *vm.VM, name string, locals ...map[string]interface{}) (string, error) {
+	start := time.Now()
+	tt, err := t.lookupInner(v.Context(), name)
+	if err != nil {
+		return "", err
+	}
+	ctx := v.Context()
+	stack, _ := ctx.Value(includeKey{}).([]string)
+	for _, s := range stack {
+		if s == tt.name {
+			return "", fmt.Errorf("include cycle: %s", strings.Join(append(stack, tt.name), " -> "))
+		}
+	}
+	if len(stack) >= maxIncludeDepth {
+		return "", errors.New("include nested too deeply: " + name)
+	}
+	ctx = context.WithValue(ctx, includeKey{}, append(stack[:len(stack):len(stack)], tt.name))
+
+	values := Values{}
+	for _, m := range locals {
+		for key, val := range m {
+			values[key] = val
 		}
-		t.inner[name] = tt
-		tt.dir = filepath.Dir(name)
-		return tt.execute(v, out, value)
+	}
+	// the clone of the parent has the configuration like sandbox, but not
+	// the values of the parent.
+	nv := t.vm.Clone()
+	nv.SetContext(ctx)
+	nv.SetAudit(v.Audit())
+	var buf bytes.Buffer
+	tt.setHelpers(nv, &buf, values)
+	withLabels(nv, labelFragment, name, func() {
+		err = tt.execute(nv, &buf, values)
+	})
+	t.trace(TracePartial, 0, name, start, err)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+const (
+	labelTemplate = "slim.template"
+	labelFragment = "slim.fragment"
+)
+
+// withLabels call f with the pprof label so CPU profiles can attribute the
+// time to the template.
+func withLabels(v *vm.VM, key, value string, f func()) {
+	if value == "" {
+		f()
+		return
+	}
+	parent := v.Context()
+	pprof.Do(parent, pprof.Labels(key, value), func(ctx context.Context) {
+		v.SetContext(ctx)
+		f()
 	})
+	v.SetContext(parent)
+}
 
-	return t.execute(v, out, value)
+// lookupInner returns the template named name which is relative to the
+// directory of t, and warns if it is deprecated. The rendering with ctx sees
+// the same templates of the cache.
+func (t *Template) lookupInner(ctx context.Context, name string) (*Template, error) {
+	tt, err := t.lookupTemplate(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	recordPartial(ctx, tt.name)
+	t.warnDeprecated(ctx, tt)
+	return tt, nil
 }
 
-func javascriptRenderer(out io.Writer, n *Node, v *vm.VM) error {
-	re := regexp.MustCompile(`{{[a-zA-Z$_]+[a-zA-Z0-9$_]*}}`)
+// lookupTemplate returns the template named name. The template is loaded
+// with the loader of t if it is set. Parsed templates are cached, in the
+// cache which t is loaded from if any.
+func (t *Template) lookupTemplate(ctx context.Context, name string) (*Template, error) {
+	name = t.resolve(name)
+	if t.cache != nil {
+		return t.cache.lookup(ctx, name)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tt, ok := t.inner[name]; ok {
+		return tt, nil
+	}
+	var tt *Template
 	var err error
-	s := re.ReplaceAllStringFunc(n.Text, func(s string) string {
-		if err == nil {
+	if t.loader != nil {
+		tt, err = ParseLoader(t.loader, name)
+	} else {
+		tt, err = ParseFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tt.fm = t.fm
+	tt.renderer = t.renderer
+	tt.directives = t.directives
+	tt.parent = t
+	tt.debug = t.debug
+	tt.missing = t.missing
+	tt.missingTemplate = t.missingTemplate
+	tt.hooks = t.hooks
+	tt.testid = t.testid
+	t.inner[name] = tt
+	return tt, nil
+}
+
+var filterInlinePattern = regexp.MustCompile(`#{[^}]*}|{{[a-zA-Z$_]+[a-zA-Z0-9$_]*}}`)
+
+// filterInline evaluate #{} in the body of the filter which is rendered as
+// the element named elem, and escape the values with the context of it like
+// the texts of the element. In javascript filter, #{expr} and {{name}} are
+// replaced with the values encoded as JSON, so they are the literals of
+// javascript, and never close the tag.
+func filterInline(v *vm.VM, s string, elem string) (string, error) {
+	var fail error
+	text := filterInlinePattern.ReplaceAllStringFunc(s, func(s string) string {
+		if fail != nil {
+			return ""
+		}
+		if strings.HasPrefix(s, "{{") {
+			if elem != "script" {
+				return s
+			}
 			vv, ok := v.Get(s[2 : len(s)-2])
 			if !ok {
-				err = fmt.Errorf("invalid variable name: %v", s)
+				fail = fmt.Errorf("invalid variable name: %v", s)
 				return ""
 			}
-			var buf bytes.Buffer
-			err = json.NewEncoder(&buf).Encode(vv)
-			if err != nil {
+			if fail = v.CheckPrint(vv); fail != nil {
 				return ""
 			}
+			var buf bytes.Buffer
+			fail = json.NewEncoder(&buf).Encode(vv)
 			return strings.TrimSpace(buf.String())
 		}
-		return ""
+		expr, err := v.Compile(s[2 : len(s)-1])
+		if err != nil {
+			fail = err
+			return ""
+		}
+		iv, err := v.Eval(expr)
+		if err != nil {
+			fail = err
+			return ""
+		}
+		if fail = v.CheckPrint(iv); fail != nil {
+			return ""
+		}
+		return escapeElemValue(elem, iv)
 	})
-	if err != nil {
-		return err
+	if fail != nil {
+		return "", fail
 	}
+	return text, nil
+}
+
+// filterIndent returns the newline and the indentation for the closing tag.
+// The body is emitted verbatim, so it keeps the indentation of the source.
+func filterIndent(s string) string {
 	indent := 0
 	for _, r := range s {
 		if !unicode.IsSpace(r) {
@@ -739,26 +1669,45 @@ func javascriptRenderer(out io.Writer, n *Node, v *vm.VM) error {
 	if indent > 2 {
 		indent -= 2
 	}
-	_, err = fmt.Fprintf(out, "<script>%s%s</script>\n", s, s[:indent])
+	return s[:indent]
+}
+
+func javascriptRenderer(out io.Writer, n *Node, v *vm.VM) error {
+	s, err := filterInline(v, n.Text, "script")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "<script>%s%s</script>\n", s, filterIndent(n.Text))
 	return err
 }
 
 func cssRenderer(out io.Writer, n *Node, v *vm.VM) error {
-	s := n.Text
-	indent := 0
-	for _, r := range s {
-		if !unicode.IsSpace(r) {
-			break
-		}
-		indent++
-	}
-	if indent > 2 {
-		indent -= 2
+	s, err := filterInline(v, n.Text, "style")
+	if err != nil {
+		return err
 	}
-	_, err := fmt.Fprintf(out, "<style type=\"text/css\">%s%s</style>\n", s, s[:indent])
+	_, err = fmt.Fprintf(out, "<style type=\"text/css\">%s%s</style>\n", s, filterIndent(n.Text))
 	return err
 }
 
+// whitespace set the whitespace marker r to n named name. ">" adds the
+// trailing whitespace after the element, and "<" adds the leading one. It
+// returns false if r is not the marker.
+func whitespace(n *Node, name string, r rune) bool {
+	if name == "" || name[0] == '<' {
+		return false
+	}
+	switch r {
+	case '>':
+		n.Trailing = true
+	case '<':
+		n.Leading = true
+	default:
+		return false
+	}
+	return true
+}
+
 // ..in addition to the requirements given above for attribute values, must not
 //   contain any literal ASCII whitespace, any U+0022 QUOTATION MARK characters ("),
 //   U+0027 APOSTROPHE characters ('), U+003D EQUALS SIGN characters (=),
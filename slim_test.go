@@ -2,14 +2,21 @@ package slim
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime/pprof"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/mattn/go-slim/vm"
 )
@@ -170,10 +177,12 @@ func TestBuiltins(t *testing.T) {
 		t.Fatal(err)
 	}
 	tmpl.FuncMap(Funcs{
-		"trim":     Trim,
-		"to_upper": ToUpper,
-		"to_lower": ToLower,
-		"repeat":   Repeat,
+		"trim":        Trim,
+		"to_upper":    ToUpper,
+		"to_lower":    ToLower,
+		"repeat":      Repeat,
+		"starts_with": StartsWith,
+		"ends_with":   EndsWith,
 	})
 	var buf bytes.Buffer
 	err = tmpl.Execute(&buf, Values{
@@ -206,6 +215,206 @@ func TestBuiltinsError(t *testing.T) {
 	if err == nil {
 		t.Fatal("should be fail")
 	}
+	_, err = StartsWith("foo")
+	if err == nil {
+		t.Fatal("should be fail")
+	}
+	_, err = EndsWith("foo")
+	if err == nil {
+		t.Fatal("should be fail")
+	}
+}
+
+func TestTruthy(t *testing.T) {
+	var nilMap map[string]int
+	om := NewOrderedMap()
+	tests := []struct {
+		value  interface{}
+		expect bool
+	}{
+		{nil, false},
+		{false, false},
+		{true, true},
+		{0, false},
+		{int64(1), true},
+		{0.0, false},
+		{"", false},
+		{HTML(""), false},
+		{"0", true},
+		{[]int{}, false},
+		{[]int{0}, true},
+		{nilMap, false},
+		{map[string]int{"a": 0}, true},
+		{om, false},
+		{(*int)(nil), false},
+		{vm.Null, false},
+		{struct{}{}, true},
+		{time.Time{}, true},
+		{&bytes.Buffer{}, false},
+		{bytes.NewBufferString("a"), true},
+	}
+	tmpl, err := Parse(strings.NewReader("p = x ? \"true\" : \"false\"\np = (x && \"true\") || \"false\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if got := Truthy(tt.value); got != tt.expect {
+			t.Fatalf("expected %v but %v: %#v", tt.expect, got, tt.value)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, Values{"x": tt.value}); err != nil {
+			t.Fatal(err)
+		}
+		expect := fmt.Sprintf("<p>%v</p>\n<p>%v</p>\n", tt.expect, tt.expect)
+		if got := buf.String(); got != expect {
+			t.Fatalf("expected %q but %q: %#v", expect, got, tt.value)
+		}
+	}
+}
+
+func TestInterfaceMapValues(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader("div\n  p = user.Name\n  p = user.tags[0]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, map[interface{}]interface{}{
+		"user": map[interface{}]interface{}{"name": "mattn", "tags": []interface{}{"go"}},
+		1:      "ignored",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <p>mattn</p>\n  <p>go</p>\n</div>\n"
+	if got := buf.String(); got != expect {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+}
+
+type printableStringer struct {
+	name string
+}
+
+func (p *printableStringer) String() string {
+	return "<" + p.name + ">"
+}
+
+func TestPrintableValues(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`div
+  p = at
+  p #{at} #{none} #{user}
+  p = err
+  p = user
+  p title=(at) data-user=(user) = missing
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	values := Values{
+		"at":      at,
+		"none":    nil,
+		"user":    &printableStringer{"mattn"},
+		"err":     errors.New("failed"),
+		"missing": (*printableStringer)(nil),
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, values); err != nil {
+		t.Fatal(err)
+	}
+	expect := `<div>
+  <p>2024-01-02T03:04:05Z</p>
+  <p>2024-01-02T03:04:05Z  &lt;mattn&gt;</p>
+  <p>failed</p>
+  <p>&lt;mattn&gt;</p>
+  <p title="2024-01-02T03:04:05Z" data-user="&lt;mattn&gt;"></p>
+</div>
+`
+	if got := buf.String(); got != expect {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+
+	tmpl.SetTimeLayout("2006/01/02")
+	buf.Reset()
+	if err := tmpl.Execute(&buf, values); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "<p>2024/01/02</p>") {
+		t.Fatalf("expected the layout is used but %q", buf.String())
+	}
+}
+
+type printableSecret string
+
+func (s printableSecret) String() string {
+	return "pw=" + string(s)
+}
+
+func TestPrintableRestrict(t *testing.T) {
+	values := Values{"secret": printableSecret("hunter2")}
+	for _, restrict := range []func(*Template){(*Template).Restrict, (*Template).RestrictData} {
+		tmpl, err := Parse(strings.NewReader(`p = secret`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		restrict(tmpl)
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, values); err == nil || strings.Contains(buf.String(), "hunter2") {
+			t.Fatalf("expected error but %v: %q", err, buf.String())
+		}
+	}
+
+	tmpl, err := Parse(strings.NewReader(`p = secret`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.Allow(printableSecret(""), "String")
+	tmpl.Expose(printableSecret(""))
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, values); err != nil {
+		t.Fatal(err)
+	}
+	if expect := "<p>pw=hunter2</p>\n"; buf.String() != expect {
+		t.Fatalf("expected %q but %q", expect, buf.String())
+	}
+}
+
+func TestValuePrinter(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader("div\n  p = price\n  p title=(price) #{at} #{name} #{raw(\"<b>\")}\n  p = fail\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SetValuePrinter(func(value interface{}) (string, error) {
+		switch v := value.(type) {
+		case float64:
+			return fmt.Sprintf("%.2f €", v), nil
+		case time.Time:
+			return v.Format("02.01.2006"), nil
+		case error:
+			return "", v
+		}
+		return fmt.Sprint(value), nil
+	})
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"price": 1.5,
+		"at":    time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		"name":  "<mattn>",
+		"fail":  nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <p>1.50 €</p>\n  <p title=\"1.50 €\">02.01.2024 &lt;mattn&gt; <b></p>\n  <p></p>\n</div>\n"
+	if got := buf.String(); got != expect {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+
+	buf.Reset()
+	err = tmpl.Execute(&buf, Values{"price": 1.0, "at": nil, "name": nil, "fail": errors.New("failed")})
+	if err == nil || !strings.Contains(err.Error(), "failed") {
+		t.Fatalf("expected the error of the printer but %v", err)
+	}
 }
 
 func TestOp(t *testing.T) {
@@ -215,7 +424,9 @@ func TestOp(t *testing.T) {
 	}
 	var buf bytes.Buffer
 	err = tmpl.Execute(&buf, Values{
-		"name": "golang",
+		"name":  "golang",
+		"items": []int{1, 2, 3},
+		"langs": map[string]int{"go": 1},
 	})
 	if err != nil {
 		t.Fatal(err)
@@ -521,3 +732,2011 @@ func TestIsAttributeValue(t *testing.T) {
 		}
 	}
 }
+
+func TestDeadline(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+ul
+  - deadline 5ms
+    li = slow()
+  - else
+    li fallback
+  - deadline 1s
+    li = name
+  - else
+    li fallback
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.FuncMap(Funcs{
+		"slow": func(args ...Value) (Value, error) {
+			time.Sleep(20 * time.Millisecond)
+			return "slow", nil
+		},
+	})
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"name": "golang",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	expect := "<ul>\n  <li>fallback</li>\n  <li>golang</li>\n</ul>\n"
+	if expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+}
+
+func TestDeadlineRender(t *testing.T) {
+	tmpl, err := ParseLoader(MapLoader{
+		"index.slim": `
+div
+  - deadline 5ms
+    - render("partial.slim")
+    p = slow()
+  - else
+    p fallback
+`,
+		"partial.slim": "span partial\n",
+	}, "index.slim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.FuncMap(Funcs{
+		"slow": func(args ...Value) (Value, error) {
+			time.Sleep(20 * time.Millisecond)
+			return "slow", nil
+		},
+	})
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <p>fallback</p>\n</div>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+}
+
+func TestKeywordNames(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  p = m.flush
+  p = deadline
+  - for x in m.break
+    p = x
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"m":        map[string]interface{}{"flush": "f", "break": []string{"b"}},
+		"deadline": "d",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <p>f</p>\n  <p>d</p>\n  <p>b</p>\n</div>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+}
+
+func TestUnexpectedElse(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+p hello
+- else
+  p world
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, nil)
+	if err == nil {
+		t.Fatal("should be fail")
+	}
+}
+
+func TestConcurrentExecute(t *testing.T) {
+	tmpl, err := ParseFile("testdata/test_render.slim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := readFile(t, "testdata/test_render.html")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var buf bytes.Buffer
+			err := tmpl.Execute(&buf, Values{
+				"foo": []int{1, 2, 3},
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if got := buf.String(); expect != got {
+				t.Errorf("expected %v but %v", expect, got)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestJSONLD(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+head
+  script type="application/ld+json" = product
+  == json_ld(product)
+  = json_ld(product)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.FuncMap(Funcs{
+		"json_ld": JSONLD,
+	})
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"product": map[string]string{
+			"@type": "Product",
+			"name":  "</script><script>alert(1)</script>",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ld := `{"@type":"Product","name":"\u003c/script\u003e\u003cscript\u003ealert(1)\u003c/script\u003e"}`
+	expect := "<head>\n  <script type=\"application/ld+json\">" + ld + "</script>\n" +
+		"  <div><script type=\"application/ld+json\">" + ld + "</script></div>\n" +
+		"  <div><script type=\"application/ld+json\">" + ld + "</script></div>\n</head>\n"
+	got := buf.String()
+	if expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+}
+
+func TestExecuteContext(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+ul
+  - deadline 5ms
+    li = slow()
+  - else
+    li fallback
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow := func(ctx context.Context) (string, error) {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Second):
+			return "slow", nil
+		}
+	}
+	var buf bytes.Buffer
+	start := time.Now()
+	err = tmpl.ExecuteContext(context.Background(), &buf, Values{
+		"slow": slow,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("helper should be cancelled")
+	}
+	got := buf.String()
+	expect := "<ul>\n  <li>fallback</li>\n</ul>\n"
+	if expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = tmpl.ExecuteContext(ctx, &buf, Values{
+		"slow": slow,
+	})
+	if err != context.Canceled {
+		t.Fatalf("expected %v but %v", context.Canceled, err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tmpl, err := ParseFile("testdata/test_each.slim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SetLimits(vm.Limits{MaxIterations: 2})
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"foo": []string{"foo", "bar", "baz"},
+	})
+	var le *vm.LimitError
+	if !errors.As(err, &le) {
+		t.Fatalf("expected LimitError but %v", err)
+	}
+	buf.Reset()
+	err = tmpl.Execute(&buf, Values{
+		"foo": []string{"foo", "bar"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoopLimits(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader("- for i in items\n  p = i\n- for i in 100000\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tmpl.Execute(io.Discard, Values{"items": []int{1, 2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl.SetLimits(vm.Limits{MaxLoopItems: 2})
+	err = tmpl.Execute(io.Discard, Values{"items": []int{1, 2, 3}})
+	var le *vm.LoopLimitError
+	if !errors.As(err, &le) || le.Limit != 2 {
+		t.Fatalf("expected LoopLimitError but %v", err)
+	}
+}
+
+func TestDirective(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+- double x = 21
+p = x
+- unknown y = 1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, nil)
+	if err == nil {
+		t.Fatal("should be fail")
+	}
+	tmpl.RegisterDirective("double", func(v *vm.VM, d *vm.DirectiveExpr) error {
+		r, err := v.Eval(d.RHS)
+		if err != nil {
+			return err
+		}
+		v.Set(d.LHS, r.(int64)*2)
+		return nil
+	})
+	tmpl.RegisterDirective("unknown", func(v *vm.VM, d *vm.DirectiveExpr) error {
+		return nil
+	})
+	buf.Reset()
+	err = tmpl.Execute(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<p>42</p>\n"
+	got := buf.String()
+	if expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+}
+
+func TestTracer(t *testing.T) {
+	tmpl, err := ParseFile("testdata/test_render.slim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []TraceEvent
+	var mu sync.Mutex
+	tmpl.SetTracer(TracerFunc(func(e *TraceEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, *e)
+	}))
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"foo": []int{1, 2, 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 6 {
+		t.Fatalf("expected %v but %v", 6, len(events))
+	}
+	if e := events[0]; e.Kind != TraceExpr || e.Line != 2 || !strings.HasSuffix(e.Template, "test_render_inner.slim") {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+	if e := events[4]; e.Kind != TracePartial || e.Source != "test_render_inner.slim" || e.Template != "testdata/test_render.slim" {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+}
+
+func TestTracerAfterRender(t *testing.T) {
+	tmpl, err := ParseFile("testdata/test_render.slim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"foo": []int{1, 2, 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the partial is cached already, but it should see the new tracer.
+	var events []TraceEvent
+	tmpl.SetTracer(TracerFunc(func(e *TraceEvent) {
+		events = append(events, *e)
+	}))
+	buf.Reset()
+	err = tmpl.Execute(&buf, Values{
+		"foo": []int{1, 2, 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 6 {
+		t.Fatalf("expected %v but %v", 6, len(events))
+	}
+	if e := events[0]; e.Kind != TraceExpr || !strings.HasSuffix(e.Template, "test_render_inner.slim") {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+}
+
+func TestSliceInLoop(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+ul
+  - for x in items[:2]
+    li = x
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"items": []string{"foo", "bar", "baz"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<ul>\n  <li>foo</li>\n  <li>bar</li>\n</ul>\n"
+	got := buf.String()
+	if expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+}
+
+func TestProfilerLabels(t *testing.T) {
+	tmpl, err := ParseFile("testdata/test_labels.slim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"label": func(ctx context.Context) string {
+			tmpl, _ := pprof.Label(ctx, "slim.template")
+			fragment, _ := pprof.Label(ctx, "slim.fragment")
+			return tmpl + "," + fragment
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<p>testdata/test_labels.slim,</p>\n<p>testdata/test_labels.slim,test_labels_inner.slim</p>\n"
+	got := buf.String()
+	if expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+}
+
+func TestRegisterGlobalFunc(t *testing.T) {
+	RegisterGlobalFunc("test_global", func(s string) string {
+		return "global " + s
+	})
+	tmpl, err := Parse(strings.NewReader(`
+p = test_global(name)
+p = to_upper(name)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"name": "golang",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<p>global golang</p>\n<p>GOLANG</p>\n"
+	got := buf.String()
+	if expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("should be panic")
+		}
+	}()
+	RegisterGlobalFunc("test_global", "not function")
+}
+
+func TestNamespacedHelpers(t *testing.T) {
+	RegisterGlobalFunc("test_img.tag", func(src string) string {
+		return "<img src=" + src + ">"
+	})
+	tmpl, err := Parse(strings.NewReader(`
+p = str.upcase(name)
+p == test_img.tag("a.png")
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.FuncMap(Funcs{
+		"str.upcase": ToUpper,
+	})
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"name": "golang",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<p>GOLANG</p>\n<p><img src=a.png></p>\n"
+	got := buf.String()
+	if expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+}
+
+func TestLoggerWarnings(t *testing.T) {
+	RegisterDeprecatedFunc("test_old", func() string { return "old" }, "use test_new")
+	tmpl, err := Parse(strings.NewReader(`
+p = trim(name)
+- for i in items
+  p = test_old()
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.FuncMap(Funcs{
+		"trim": Trim,
+	})
+	var warnings []*Warning
+	tmpl.SetLogger(LoggerFunc(func(w *Warning) {
+		warnings = append(warnings, w)
+	}))
+	for i := 0; i < 2; i++ {
+		var buf bytes.Buffer
+		err = tmpl.Execute(&buf, Values{
+			"name":  " golang ",
+			"items": []int{1, 2},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("expected 2 warnings but %d", len(warnings))
+	}
+	if w := warnings[0]; w.Name != "trim" || w.Line != 2 {
+		t.Fatalf("unexpected warning: %+v", w)
+	}
+	if w := warnings[1]; w.Name != "test_old" || w.Line != 4 || !strings.Contains(w.Message, "use test_new") {
+		t.Fatalf("unexpected warning: %+v", w)
+	}
+}
+
+func TestForMap(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  - for k, v in m
+    p = k + "=" + v
+  - for k, v in om
+    p = k + "=" + v
+  - for k in ints
+    p = k
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	om := NewOrderedMap()
+	om.Set("z", "1")
+	om.Set("a", "2")
+	om.Set("m", "3")
+	om.Delete("m")
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"m":    map[string]string{"b": "2", "c": "3", "a": "1"},
+		"om":   om,
+		"ints": map[int]bool{10: true, 2: true, 1: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <p>a=1</p>\n  <p>b=2</p>\n  <p>c=3</p>\n  <p>z=1</p>\n  <p>a=2</p>\n  <p>1</p>\n  <p>2</p>\n  <p>10</p>\n</div>\n"
+	got := buf.String()
+	if expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	RegisterFunc0("test_answer", func() int { return 42 })
+	RegisterFunc1("test_double", func(i int) int { return i * 2 })
+	RegisterFunc2("test_join", strings.Repeat)
+	RegisterFunc3("test_clamp", func(v, lo, hi float64) float64 {
+		if v < lo {
+			return lo
+		}
+		if v > hi {
+			return hi
+		}
+		return v
+	})
+	tmpl, err := Parse(strings.NewReader(`
+p = test_answer()
+p = test_double(21)
+p = test_join("a", 3)
+p = test_clamp(5, 0, 1.5)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<p>42</p>\n<p>42</p>\n<p>aaa</p>\n<p>1.5</p>\n"
+	got := buf.String()
+	if expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+
+	tmpl, err = Parse(strings.NewReader(`p = test_double("x")`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tmpl.Execute(&buf, nil); err == nil {
+		t.Fatal("expected error but nil")
+	}
+}
+
+func BenchmarkRegisterFunc(b *testing.B) {
+	RegisterFunc2("bench_add", func(a, b int) int { return a + b })
+	RegisterGlobalFunc("bench_add_reflect", func(a, b int64) int64 { return a + b })
+	for _, name := range []string{"bench_add", "bench_add_reflect"} {
+		b.Run(name, func(b *testing.B) {
+			v := vm.New()
+			expr, err := v.Compile(name + "(1, 2)")
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := v.Eval(expr); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+type testIterator struct {
+	items []string
+}
+
+func (it *testIterator) Next() (interface{}, bool) {
+	if len(it.items) == 0 {
+		return nil, false
+	}
+	x := it.items[0]
+	it.items = it.items[1:]
+	return x, true
+}
+
+func TestForChanAndIterator(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  - for i, x in ch
+    p = x + i
+  - for i, x in it
+    p = x + i
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan string, 2)
+	ch <- "a"
+	ch <- "b"
+	close(ch)
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"ch": ch,
+		"it": &testIterator{items: []string{"c", "d"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <p>a1</p>\n  <p>b2</p>\n  <p>c0</p>\n  <p>d1</p>\n</div>\n"
+	got := buf.String()
+	if expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = tmpl.ExecuteContext(ctx, &buf, Values{
+		"ch": make(chan string),
+		"it": &testIterator{},
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded but %v", err)
+	}
+}
+
+func TestBreakContinue(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  - for x in items
+    - continue if x.hidden
+    - break if x.last
+    p = x.name
+  - for x in items
+    - break
+    p = x.name
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"items": []map[string]interface{}{
+			{"name": "a", "hidden": false, "last": false},
+			{"name": "b", "hidden": true, "last": false},
+			{"name": "c", "hidden": false, "last": false},
+			{"name": "d", "hidden": false, "last": true},
+			{"name": "e", "hidden": false, "last": false},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <p>a</p>\n  <p>c</p>\n</div>\n"
+	got := buf.String()
+	if expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+
+	tmpl, err = Parse(strings.NewReader(`
+ul
+  - for x in items
+    li
+      span = x.name
+      - continue if x.hidden
+      - break if x.last
+      em after
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	err = tmpl.Execute(&buf, Values{
+		"items": []map[string]interface{}{
+			{"name": "a", "hidden": false, "last": false},
+			{"name": "b", "hidden": true, "last": false},
+			{"name": "c", "hidden": false, "last": true},
+			{"name": "d", "hidden": false, "last": false},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "<ul>\n  <li>\n    <span>a</span>\n    <em>after</em>\n  </li>\n  <li>\n    <span>b</span>\n  </li>\n  <li>\n    <span>c</span>\n  </li>\n</ul>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+
+	tmpl, err = Parse(strings.NewReader(`- break`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tmpl.Execute(&buf, nil); err == nil {
+		t.Fatal("expected error but nil")
+	}
+}
+
+func TestForElse(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+ul
+  - for x in items
+    li = x
+  - else
+    li no items
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty := "<ul>\n  <li>no items</li>\n</ul>\n"
+	tests := []struct {
+		items  interface{}
+		expect string
+	}{
+		{[]string{"a"}, "<ul>\n  <li>a</li>\n</ul>\n"},
+		{[]string(nil), empty},
+		{nil, empty},
+		{(*[]string)(nil), empty},
+		{(*OrderedMap)(nil), empty},
+		{map[string]int(nil), empty},
+		{(chan int)(nil), empty},
+		{testCollection(nil), empty},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		err = tmpl.Execute(&buf, Values{"items": tt.items})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); tt.expect != got {
+			t.Fatalf("expected %v but %v", tt.expect, got)
+		}
+	}
+}
+
+type testCollection []string
+
+func (c testCollection) Len() int { return len(c) }
+
+func (c testCollection) At(i int) interface{} { return "item " + c[i] }
+
+func TestForIntAndCollection(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  - for i in 3
+    p = i
+  - for i, x in c
+    p = x
+  - for i in n
+    p = i
+  - else
+    p empty
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"c": testCollection{"a", "b"},
+		"n": uint8(0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <p>0</p>\n  <p>1</p>\n  <p>2</p>\n  <p>item a</p>\n  <p>item b</p>\n  <p>empty</p>\n</div>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+}
+
+func TestFilterInterpolation(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  javascript:
+    if (ready) {
+      var name = #{name};
+      var q = #{q};
+
+      render({{items}});
+    }
+  css:
+    .box {
+      width: #{width}px;
+      color: #{color};
+    }
+  script
+    | var name = #{name};
+    - for i in items
+      | render(#{i}, #{q});
+  style
+    | .box { color: #{color}; }
+  p
+    | #{name}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"name":  "</script>",
+		"q":     `";alert(1);//`,
+		"items": []int{1, 2},
+		"width": 10,
+		"color": "red;} body { background: url(x)",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `<div>
+  <script>
+    if (ready) {
+      var name = "\u003c/script\u003e";
+      var q = "\";alert(1);//";
+
+      render([1,2]);
+    }
+  </script>
+  <style type="text/css">
+    .box {
+      width: 10px;
+      color: ZgotmplZ;
+    }
+  </style>
+  <script>
+    var name = "\u003c/script\u003e";
+    render(1, "\";alert(1);//");
+    render(2, "\";alert(1);//");
+  </script>
+  <style>
+    .box { color: ZgotmplZ; }
+  </style>
+  <p>
+    &lt;/script&gt;
+  </p>
+</div>
+`
+	got := buf.String()
+	if expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+}
+
+type testBackend struct{}
+
+func (testBackend) Compile(src string) (vm.Program, error) {
+	name := strings.TrimPrefix(src, "$")
+	if name == src {
+		return nil, errors.New("variable must start with $")
+	}
+	return testProgram(name), nil
+}
+
+type testProgram string
+
+func (p testProgram) Eval(ctx context.Context, env vm.Env) (interface{}, error) {
+	v, _ := env.Get(string(p))
+	return v, nil
+}
+
+func TestBackend(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  ul
+    - for x in $items
+      li = $x
+  p #{$name}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SetBackend(testBackend{})
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"items": []string{"a", "b"},
+		"name":  "golang",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <ul>\n    <li>a</li>\n    <li>b</li>\n  </ul>\n  <p>golang</p>\n</div>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+}
+
+func TestInclude(t *testing.T) {
+	tmpl, err := ParseFile("testdata/test_include.slim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.FuncMap(Funcs{
+		"to_upper": ToUpper,
+	})
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"page_title": "first",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <div><h1>FIRST</h1>\n</div>\n  <div><h1>SECOND</h1>\n</div>\n</div>\n"
+	got := buf.String()
+	if expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+
+	tests := []struct {
+		src    string
+		errstr string
+	}{
+		{`== include "partials/isolated"`, "page_title"},
+		{`== include "partials/cycle"`, "include cycle"},
+	}
+	for _, tt := range tests {
+		tmpl, err := Parse(strings.NewReader(tt.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.dir = "testdata"
+		err = tmpl.Execute(&buf, Values{
+			"page_title": "first",
+		})
+		if err == nil || !strings.Contains(err.Error(), tt.errstr) {
+			t.Fatalf("expected error %q but %v", tt.errstr, err)
+		}
+	}
+}
+
+func TestNullObject(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  p = user.address.city
+  p Hello #{user.profile.Nickname()}
+  ul
+    - for x in user.tags
+      li = x
+    - else
+      li no tags
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := Values{
+		"user": map[string]interface{}{},
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, value); err == nil {
+		t.Fatal("expected error but not")
+	}
+	tmpl.SetNullObject(true)
+	buf.Reset()
+	if err := tmpl.Execute(&buf, value); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <p></p>\n  <p>Hello </p>\n  <ul>\n    <li>no tags</li>\n  </ul>\n</div>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+}
+
+func TestExtends(t *testing.T) {
+	tmpl, err := ParseFile("testdata/test_extends.slim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"name":  "mattn",
+		"items": []int{1, 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := readFile(t, "testdata/test_extends.html")
+	got := buf.String()
+	if expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+
+	tmpl, err = ParseFile("testdata/layouts/cycle.slim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tmpl.Execute(&buf, nil)
+	if err == nil || !strings.Contains(err.Error(), "extends cycle") {
+		t.Fatalf("expected cycle error but %v", err)
+	}
+}
+
+func TestMixin(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+mixin card(title, body)
+  .card
+    h2 = title
+    p = body
+mixin hr
+  hr
+div
+  +card("Hi", text)
+  +hr
+  +card("Bye", title)
+  p = title
+  p = body ?? "none"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"text":  "hello",
+		"title": "page",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n" +
+		"  <div class=\"card\">\n    <h2>Hi</h2>\n    <p>hello</p>\n  </div>\n" +
+		"  <hr/>\n" +
+		"  <div class=\"card\">\n    <h2>Bye</h2>\n    <p>page</p>\n  </div>\n" +
+		"  <p>page</p>\n" +
+		"  <p>none</p>\n" +
+		"</div>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+
+	tests := []struct {
+		src    string
+		errstr string
+	}{
+		{"div\n  +card(1)", "unknown mixin"},
+		{"mixin card(x)\n  p = x\ndiv\n  +card(1, 2)", "takes 1 arguments"},
+		{"mixin loop(x)\n  +loop(x)\ndiv\n  +loop(1)", "nested too deeply"},
+	}
+	for _, tt := range tests {
+		tmpl, err := Parse(strings.NewReader(tt.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tmpl.Execute(&buf, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.errstr) {
+			t.Fatalf("expected error %q but %v", tt.errstr, err)
+		}
+	}
+
+	_, err = Parse(strings.NewReader("mixin card(1)\n  p"))
+	if err == nil {
+		t.Fatal("expected error but not")
+	}
+}
+
+type testAccount struct {
+	Exported
+	Name  string
+	Owner testOwner
+	Plain testPlain
+}
+
+type testPlain struct {
+	password string
+	Token    string
+}
+
+type testOwner struct {
+	Email string
+}
+
+func TestRestrictData(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`p = account.Owner.Email`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := Values{
+		"account": testAccount{Name: "mattn", Owner: testOwner{Email: "mattn@example.com"}},
+	}
+	tmpl.RestrictData()
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, value)
+	if err == nil || !strings.Contains(err.Error(), "not exposed") {
+		t.Fatalf("expected error but %v", err)
+	}
+	tmpl.Expose(testOwner{})
+	buf.Reset()
+	if err := tmpl.Execute(&buf, value); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<p>mattn@example.com</p>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+
+	tmpl, err = Parse(strings.NewReader(`p = account.Plain`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.RestrictData()
+	buf.Reset()
+	err = tmpl.Execute(&buf, Values{
+		"account": testAccount{Plain: testPlain{password: "hunter3", Token: "tok"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "not exposed") || strings.Contains(buf.String(), "hunter3") {
+		t.Fatalf("expected error but %v: %q", err, buf.String())
+	}
+
+	// the fields of the exposed struct are checked too.
+	tmpl, err = Parse(strings.NewReader(`p = account`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.RestrictData()
+	buf.Reset()
+	err = tmpl.Execute(&buf, Values{
+		"account": testAccount{Name: "mattn", Plain: testPlain{password: "hunter4"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "not exposed") || strings.Contains(buf.String(), "hunter4") {
+		t.Fatalf("expected error but %v: %q", err, buf.String())
+	}
+
+	// the values encoded as JSON are checked too.
+	for _, src := range []string{
+		"script = owner",
+		"button onclick=(owner) x",
+		"javascript:\n  var o = #{owner};",
+		"== json_ld(owner)",
+	} {
+		tmpl, err = Parse(strings.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.RestrictData()
+		buf.Reset()
+		err = tmpl.Execute(&buf, Values{
+			"owner": testOwner{Email: "mattn@example.com"},
+		})
+		if err == nil || !strings.Contains(err.Error(), "not exposed") || strings.Contains(buf.String(), "mattn@") {
+			t.Fatalf("%s: expected error but %v: %q", src, err, buf.String())
+		}
+	}
+}
+
+type testRoleKey struct{}
+
+func TestRedactor(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`p = user.email`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SetRedactor(func(ctx context.Context, m *vm.Member, value interface{}) (interface{}, error) {
+		if m.Name == "email" && ctx.Value(testRoleKey{}) == "support" {
+			return "m***@example.com", nil
+		}
+		return value, nil
+	})
+	value := Values{
+		"user": map[string]interface{}{"email": "mattn@example.com"},
+	}
+	for role, expect := range map[string]string{
+		"admin":   "<p>mattn@example.com</p>\n",
+		"support": "<p>m***@example.com</p>\n",
+	} {
+		var buf bytes.Buffer
+		ctx := context.WithValue(context.Background(), testRoleKey{}, role)
+		if err := tmpl.ExecuteContext(ctx, &buf, value); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); expect != got {
+			t.Fatalf("%s: expected %q but %q", role, expect, got)
+		}
+	}
+}
+
+func TestAssert(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  - assert items, "items are required"
+  - assert user.name
+  p ok
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{"items": []int{1}, "user": Values{"name": "mattn"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <p>ok</p>\n</div>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+
+	err = tmpl.Execute(&buf, Values{"items": []int{}, "user": Values{"name": "mattn"}})
+	if err == nil || !strings.Contains(err.Error(), "assertion failed: items are required") {
+		t.Fatalf("expected assertion error but %v", err)
+	}
+
+	var warnings []string
+	tmpl.SetLogger(LoggerFunc(func(w *Warning) {
+		warnings = append(warnings, w.Message)
+	}))
+	tmpl.SetNullObject(true)
+	buf.Reset()
+	if err := tmpl.Execute(&buf, Values{"items": []int{}, "user": Values{}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+	want := []string{"assertion failed: items are required", "assertion failed: assert user.name"}
+	if strings.Join(warnings, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("expected %v but %v", want, warnings)
+	}
+}
+
+func TestBuffered(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  p first
+  p = fail()
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.FuncMap(Funcs{
+		"fail": func(args ...Value) (Value, error) {
+			return nil, errors.New("failed")
+		},
+	})
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err == nil {
+		t.Fatal("expected error but not")
+	}
+	if !strings.Contains(buf.String(), "<p>first</p>") {
+		t.Fatalf("expected the output before the error but %q", buf.String())
+	}
+
+	tmpl.SetBuffered(true)
+	buf.Reset()
+	if err := tmpl.Execute(&buf, nil); err == nil {
+		t.Fatal("expected error but not")
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing is written but %q", buf.String())
+	}
+}
+
+func TestDeprecated(t *testing.T) {
+	tmpl, err := ParseFile("testdata/test_deprecated.slim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var warnings []string
+	tmpl.SetLogger(LoggerFunc(func(w *Warning) {
+		warnings = append(warnings, w.Message)
+	}))
+	for i := 0; i < 2; i++ {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, nil); err != nil {
+			t.Fatal(err)
+		}
+		expect := "<div>\n  <div><p>old card</p>\n</div>\n</div>\n"
+		if got := buf.String(); expect != got {
+			t.Fatalf("expected %q but %q", expect, got)
+		}
+	}
+	if len(warnings) != 1 || !strings.HasSuffix(warnings[0], "test_deprecated_inner.slim: use test_card.slim") {
+		t.Fatalf("expected one warning but %v", warnings)
+	}
+
+	inner, err := ParseFile("testdata/test_deprecated_inner.slim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message, ok := inner.Annotation("deprecated"); !ok || message != "use test_card.slim" {
+		t.Fatalf("unexpected annotation: %q", message)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  p Hello #{name}
+  p #{raw(name)}
+  p = name
+  p = raw(name)
+  p == name
+  a href="/?q=#{q}" link
+  p = safe
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"name": "<b>bob</b>",
+		"q":    `a&b"c`,
+		"safe": HTML("<i>safe</i>"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n" +
+		"  <p>Hello &lt;b&gt;bob&lt;/b&gt;</p>\n" +
+		"  <p><b>bob</b></p>\n" +
+		"  <p>&lt;b&gt;bob&lt;/b&gt;</p>\n" +
+		"  <p><b>bob</b></p>\n" +
+		"  <p><b>bob</b></p>\n" +
+		"  <a href=\"/?q=a%26b%22c\">link</a>\n" +
+		"  <p><i>safe</i></p>\n" +
+		"</div>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div#main.box
+  p Hello #{name}
+  img src="a.png"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var closed []string
+	tmpl.SetHooks(&Hooks{
+		OnOpenTag: func(tag *Tag) error {
+			tag.Set("data-line", fmt.Sprint(tag.Node.Line))
+			return nil
+		},
+		OnText: func(tag *Tag, text string) (string, error) {
+			return strings.ToUpper(text), nil
+		},
+		OnCloseTag: func(tag *Tag) error {
+			closed = append(closed, tag.Name)
+			return nil
+		},
+	})
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, Values{"name": "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div id=\"main\" class=\"box\" data-line=\"2\">\n" +
+		"  <p data-line=\"3\">HELLO BOB</p>\n" +
+		"  <img src=\"a.png\" data-line=\"4\"/>\n" +
+		"</div>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+	if got := strings.Join(closed, ","); got != "p,img,div" {
+		t.Fatalf("unexpected order of close: %v", got)
+	}
+}
+
+func TestContextualEscape(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  a href="#{url}" link
+  a href="/users/#{name}" user
+  img src="#{bad}"
+  button onclick="greet(#{name})" hi
+  script = data
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"url":  "https://example.com/a b",
+		"name": `"</script>`,
+		"bad":  "javascript:alert(1)",
+		"data": map[string]string{"x": "</script>"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n" +
+		"  <a href=\"https://example.com/a%20b\">link</a>\n" +
+		"  <a href=\"/users/%22%3C/script%3E\">user</a>\n" +
+		"  <img src=\"#ZgotmplZ\"/>\n" +
+		"  <button onclick=\"greet(&#34;\\&#34;\\u003c/script\\u003e&#34;)\">hi</button>\n" +
+		"  <script>{\"x\":\"\\u003c/script\\u003e\"}</script>\n" +
+		"</div>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+}
+
+func TestSafeTypes(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  a href="#{link}" onclick="#{handler}" style="color: #{color}" = text
+  a href="#{bad}" style="color: #{badColor}" = js
+  script = handler
+  style = sheet
+  p style=(font) font
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"link":     URL("javascript:void(0)"),
+		"handler":  JS("alert(1)"),
+		"color":    CSS("red"),
+		"text":     HTML("<b>ok</b>"),
+		"bad":      "javascript:void(0)",
+		"badColor": "red;}",
+		"js":       JS("<b>"),
+		"sheet":    CSS(`ul > li { content: "&" }`),
+		"font":     CSS(`font-family: "a&b"`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n" +
+		"  <a href=\"javascript:void(0)\" onclick=\"alert(1)\" style=\"color: red\"><b>ok</b></a>\n" +
+		"  <a href=\"#ZgotmplZ\" style=\"color: ZgotmplZ\">&lt;b&gt;</a>\n" +
+		"  <script>alert(1)</script>\n" +
+		"  <style>ul > li { content: \"&\" }</style>\n" +
+		"  <p style=\"font-family: &#34;a&amp;b&#34;\">font</p>\n" +
+		"</div>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %q but %q", expect, got)
+	}
+}
+
+func TestClassMerge(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  div.card class=(extra) class="#{state}" title=(title) Card
+  p.a class=(names) text
+  p class=(flags) flags
+  p#main id=(sub) class=(empty) plain
+  div.card.card class=card dup
+  a class=(active ? "on" : "") link
+  a class=["a", active && "b", missing && "c"] list
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"extra":   "wide tall",
+		"state":   "on",
+		"title":   `<"t">`,
+		"names":   []interface{}{"b", "", nil, []string{"c", "a"}},
+		"flags":   map[string]interface{}{"x": true, "y": false, "z": 1},
+		"sub":     "part",
+		"empty":   "",
+		"active":  true,
+		"missing": false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n" +
+		"  <div class=\"card wide tall on\" title=\"&lt;&#34;t&#34;&gt;\">Card</div>\n" +
+		"  <p class=\"a b c\">text</p>\n" +
+		"  <p class=\"x z\">flags</p>\n" +
+		"  <p id=\"main_part\">plain</p>\n" +
+		"  <div class=\"card\">dup</div>\n" +
+		"  <a class=\"on\">link</a>\n" +
+		"  <a class=\"a b\">list</a>\n" +
+		"</div>\n"
+	if buf.String() != expect {
+		t.Fatalf("expected %q but %q", expect, buf.String())
+	}
+}
+
+type recordWriter struct {
+	bytes.Buffer
+}
+
+func (w *recordWriter) WriteRaw(s string) error {
+	w.WriteString(s)
+	return nil
+}
+
+func (w *recordWriter) WriteEscapedText(elem string, value interface{}) error {
+	fmt.Fprintf(w, "[text %s %v]", elem, value)
+	return nil
+}
+
+func (w *recordWriter) WriteEscapedAttr(name string, value interface{}) error {
+	fmt.Fprintf(w, "[attr %s %v]", name, value)
+	return nil
+}
+
+func (w *recordWriter) WriteEscapedURL(prefix string, value interface{}) error {
+	fmt.Fprintf(w, "[url %q %v]", prefix, value)
+	return nil
+}
+
+func TestOutputWriter(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  p title=(title) = name
+  a href="/?q=#{q}" Hi #{name}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SetBuffered(true)
+	var w recordWriter
+	err = tmpl.Execute(&w, Values{"title": "<t>", "name": "<b>", "q": "&"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n" +
+		"  <p title=\"[attr title <t>]\">[text p <b>]</p>\n" +
+		"  <a href=\"/?q=[url \"/?q=\" &]\">Hi [text a <b>]</a>\n" +
+		"</div>\n"
+	if w.String() != expect {
+		t.Fatalf("expected %q but %q", expect, w.String())
+	}
+
+	var buf bytes.Buffer
+	ow := NewOutputWriter(&buf)
+	ow.WriteEscapedText("p", "<b>")
+	ow.WriteEscapedText("script", "</script>")
+	ow.WriteEscapedURL("", "javascript:alert(1)")
+	expect = `&lt;b&gt;"\u003c/script\u003e"#ZgotmplZ`
+	if buf.String() != expect {
+		t.Fatalf("expected %q but %q", expect, buf.String())
+	}
+}
+
+func TestSplatAttrs(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+mixin field(attrs)
+  input.field type="text" *attrs
+div
+  +field(input)
+  a.btn *link Go
+  p disabled=(off) hidden=(on) plain
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := NewOrderedMap()
+	link.Set("href", "javascript:x")
+	link.Set("title", `"t"`)
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"input": map[string]interface{}{
+			"name":     "q",
+			"required": true,
+			"readonly": false,
+			"class":    []string{"wide"},
+			"value":    "<v>",
+		},
+		"link": link,
+		"off":  false,
+		"on":   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n" +
+		"  <input class=\"field wide\" type=\"text\" name=\"q\" required value=\"&lt;v&gt;\"/>\n" +
+		"  <a class=\"btn\" href=\"#ZgotmplZ\" title=\"&#34;t&#34;\">Go</a>\n" +
+		"  <p hidden>plain</p>\n" +
+		"</div>\n"
+	if buf.String() != expect {
+		t.Fatalf("expected %q but %q", expect, buf.String())
+	}
+
+	err = tmpl.Execute(&buf, Values{
+		"input": map[string]interface{}{`x"y`: 1},
+		"link":  nil,
+	})
+	if err == nil {
+		t.Fatal("should be an error for the invalid name")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  p title=(title) = name
+  a href="/?q=#{q}" Hi #{name}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := Values{"title": "<t>", "name": "<b>", "q": "&"}
+	var expect bytes.Buffer
+	if err := tmpl.Execute(&expect, value); err != nil {
+		t.Fatal(err)
+	}
+	var r Recorder
+	if err := tmpl.Execute(&r, value); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Replay(&buf, r.Ops()); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expect.String() {
+		t.Fatalf("expected %q but %q", expect.String(), buf.String())
+	}
+	var r2 Recorder
+	if err := Replay(&r2, r.Ops()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r.Ops(), r2.Ops()) {
+		t.Fatalf("expected %v but %v", r.Ops(), r2.Ops())
+	}
+}
+
+func BenchmarkReplay(b *testing.B) {
+	tmpl, err := ParseFile("testdata/test_simple.slim")
+	if err != nil {
+		b.Fatal(err)
+	}
+	var r Recorder
+	if err := tmpl.Execute(&r, nil); err != nil {
+		b.Fatal(err)
+	}
+	var buf bytes.Buffer
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if err := Replay(&buf, r.Ops()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestNestedAttrs(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  button data={id: 3, role: "btn", user: {first_name: name}} aria=(aria) Go
+  div *attrs
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, Values{
+		"name":  `"bob"`,
+		"aria":  map[string]interface{}{"hidden": true, "label": "x"},
+		"attrs": map[string]interface{}{"data": map[string]interface{}{"a": 1, "b": false}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n" +
+		"  <button data-id=\"3\" data-role=\"btn\" data-user-first_name=\"&#34;bob&#34;\" aria-hidden=\"true\" aria-label=\"x\">Go</button>\n" +
+		"  <div data-a=\"1\" data-b=\"false\">\n" +
+		"  </div>\n" +
+		"</div>\n"
+	if buf.String() != expect {
+		t.Fatalf("expected %q but %q", expect, buf.String())
+	}
+}
+
+func TestDoctype(t *testing.T) {
+	tests := []struct {
+		in     string
+		expect string
+	}{
+		{"doctype html\nhtml\n  br\n", "<!doctype html>\n<html>\n  <br/>\n</html>\n"},
+		{"doctype 5\np\n", "<!doctype html>\n<p>\n</p>\n"},
+		{"doctype strict\nhtml\n  br\n", "<!DOCTYPE html PUBLIC \"-//W3C//DTD XHTML 1.0 Strict//EN\" \"http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd\">\n<html>\n  <br />\n</html>\n"},
+		{"doctype xml\nfeed\n  link\n", "<?xml version=\"1.0\" encoding=\"utf-8\" ?>\n<feed>\n  <link />\n</feed>\n"},
+		{"doctype xml ISO-8859-1\n", "<?xml version=\"1.0\" encoding=\"ISO-8859-1\" ?>\n"},
+	}
+	for _, tt := range tests {
+		tmpl, err := Parse(strings.NewReader(tt.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, nil); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.expect {
+			t.Fatalf("expected %q but %q", tt.expect, buf.String())
+		}
+	}
+
+	tmpl, err := Parse(strings.NewReader("doctype foo\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpl.Execute(io.Discard, nil); err == nil {
+		t.Fatal("should be fail")
+	}
+}
+
+func TestOutputMode(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  ul
+    - for x in items
+      li = x
+  br
+  p Hello
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := Values{"items": []string{"a", "b"}}
+	tmpl.SetOutputMode(Compact)
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, value); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div><ul><li>a</li><li>b</li></ul><br/><p>Hello</p></div>"
+	if buf.String() != expect {
+		t.Fatalf("expected %q but %q", expect, buf.String())
+	}
+
+	buf.Reset()
+	if err := tmpl.ExecuteContext(WithOutputMode(context.Background(), Pretty), &buf, value); err != nil {
+		t.Fatal(err)
+	}
+	expect = "<div>\n  <ul>\n    <li>a</li>\n    <li>b</li>\n  </ul>\n  <br/>\n  <p>Hello</p>\n</div>\n"
+	if buf.String() != expect {
+		t.Fatalf("expected %q but %q", expect, buf.String())
+	}
+
+	tmpl, err = Parse(strings.NewReader(`
+div
+  p   a    b
+  p
+    | line one
+      line   two
+  pre
+    | a   b
+      c
+  textarea  x   y
+  script
+    | var s = "a   b";
+  p #{name}   z
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SetOutputMode(Compact)
+	buf.Reset()
+	if err := tmpl.Execute(&buf, Values{"name": "x  y"}); err != nil {
+		t.Fatal(err)
+	}
+	expect = "<div><p>a b</p><p>line one line two</p><pre>a   b\nc</pre><textarea>x   y</textarea><script>var s = \"a   b\";</script><p>x  y z</p></div>"
+	if buf.String() != expect {
+		t.Fatalf("expected %q but %q", expect, buf.String())
+	}
+}
+
+func TestFromFuncMap(t *testing.T) {
+	fm, err := FromFuncMap(template.FuncMap{
+		"join": func(sep string, args ...interface{}) string {
+			var ss []string
+			for _, a := range args {
+				ss = append(ss, fmt.Sprint(a))
+			}
+			return strings.Join(ss, sep)
+		},
+		"add": func(a, b int) (int, error) {
+			return a + b, nil
+		},
+		"bold": func(s string) template.HTML {
+			return template.HTML("<b>" + template.HTMLEscapeString(s) + "</b>")
+		},
+		"boom": func() string {
+			panic("boom")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := Parse(strings.NewReader(`
+div
+  p = join("-", "a", 1, 2.5)
+  p = add(1, 2)
+  p = bold("<x>")
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.FuncMap(fm)
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <p>a-1-2.5</p>\n  <p>3</p>\n  <p><b>&lt;x&gt;</b></p>\n</div>\n"
+	if buf.String() != expect {
+		t.Fatalf("expected %q but %q", expect, buf.String())
+	}
+
+	for _, src := range []string{"p = boom()", `p = add("a", 1)`} {
+		tmpl, err := Parse(strings.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.FuncMap(fm)
+		if err := tmpl.Execute(io.Discard, nil); err == nil {
+			t.Fatalf("%s: should be error", src)
+		}
+	}
+
+	if _, err := FromFuncMap(template.FuncMap{"bad": func() {}}); err == nil {
+		t.Fatal("should be error")
+	}
+}
+
+func TestWhitespaceMarkers(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+p
+  a> href="/" Home
+  a< Next
+  span.note<> x
+  img> src="a.png"
+  b=' name
+  i=< name
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SetOutputMode(Compact)
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, Values{"name": "slim"}); err != nil {
+		t.Fatal(err)
+	}
+	expect := `<p><a href="/">Home</a>  <a>Next</a> <span class="note">x</span> <img src="a.png"/> <b>slim</b>  <i>slim</i></p>`
+	if buf.String() != expect {
+		t.Fatalf("expected %q but %q", expect, buf.String())
+	}
+}
+
+func TestTextBlock(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  p
+    | Hello #{name},
+      this is
+        verbatim.
+  ' See
+  |
+    a
+    b
+  p end
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, Values{"name": "<slim>"}); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <p>\n    Hello &lt;slim&gt;,\n    this is\n      verbatim.\n  </p>\n  See \n  a\n  b\n  <p>end</p>\n</div>\n"
+	if buf.String() != expect {
+		t.Fatalf("expected %q but %q", expect, buf.String())
+	}
+}
+
+func TestComments(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  / silent #{broken(}
+    p = nope(
+  /! visible a="b"
+  /[if IE]
+    p Get a better browser
+  p end
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpl.compile(tmpl.root); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <!-- visible a=\"b\" -->\n  <!--[if IE]>\n    <p>Get a better browser</p>\n  <![endif]-->\n  <p>end</p>\n</div>\n"
+	if buf.String() != expect {
+		t.Fatalf("expected %q but %q", expect, buf.String())
+	}
+}
+
+func TestInlineNesting(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+ul
+  li: a href="/x" Text
+  li.item: a.link: b = name
+  li#last: span
+    | child
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SetOutputMode(Compact)
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, Values{"name": "slim"}); err != nil {
+		t.Fatal(err)
+	}
+	expect := `<ul><li><a href="/x">Text</a></li><li class="item"><a class="link"><b>slim</b></a></li><li id="last"><span>child</span></li></ul>`
+	if buf.String() != expect {
+		t.Fatalf("expected %q but %q", expect, buf.String())
+	}
+}
+
+func TestHTMLLines(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  <section class="note" data-name="#{name}">
+    p hello
+    <br>
+  </section>
+  p end
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, Values{"name": "<slim>"}); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n  <section class=\"note\" data-name=\"&lt;slim&gt;\">\n    <p>hello</p>\n    <br>\n  </section>\n  <p>end</p>\n</div>\n"
+	if buf.String() != expect {
+		t.Fatalf("expected %q but %q", expect, buf.String())
+	}
+
+	// the closing line at the top-level is not indented.
+	tmpl, err = Parse(strings.NewReader(`
+<section class="legacy">
+  p Hello #{name}
+</section>
+p end
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := tmpl.Execute(&buf, Values{"name": "<slim>"}); err != nil {
+		t.Fatal(err)
+	}
+	expect = "<section class=\"legacy\">\n  <p>Hello &lt;slim&gt;</p>\n</section>\n<p>end</p>\n"
+	if buf.String() != expect {
+		t.Fatalf("expected %q but %q", expect, buf.String())
+	}
+}
+
+func TestComponent(t *testing.T) {
+	card, err := Parse(strings.NewReader(`
+div class="card #{class}"
+  h2 = title
+  main == content
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterComponent("TestCard", card)
+	RegisterComponent("TestBadge", ComponentFunc(func(ctx context.Context, out io.Writer, attrs Values) error {
+		_, err := fmt.Fprintf(out, "<span>%v:%v</span>\n", attrs["count"], attrs["label"])
+		return err
+	}))
+	tmpl, err := Parse(strings.NewReader(`
+div
+  TestCard.wide title="Hi #{name}"
+    p body
+    TestBadge count=(n) label="new #{name}"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, Values{"name": "<slim>", "n": 3}); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<div>\n<div class=\"card wide\">\n  <h2>Hi &lt;slim&gt;</h2>\n  <main><p>body</p>\n<span>3:new &lt;slim&gt;</span>\n</main>\n</div>\n</div>\n"
+	if buf.String() != expect {
+		t.Fatalf("expected %q but %q", expect, buf.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("should be panic")
+		}
+	}()
+	RegisterComponent("card", card)
+}
@@ -0,0 +1,112 @@
+package slim
+
+import (
+	"reflect"
+)
+
+// Snapshot returns the deep copy of value. Maps, slices, arrays, pointers
+// and the exported fields of structs are copied, and the shared references
+// and the cycles are kept. Functions, channels and the unexported fields are
+// not copied.
+func Snapshot(value interface{}) interface{} {
+	c := &copier{seen: map[copyKey]reflect.Value{}}
+	return c.copyValue(value)
+}
+
+type copyKey struct {
+	typ reflect.Type
+	ptr uintptr
+}
+
+type copier struct {
+	seen map[copyKey]reflect.Value
+}
+
+var orderedMapType = reflect.TypeOf((*OrderedMap)(nil))
+
+func (c *copier) copy(rv reflect.Value) reflect.Value {
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return rv
+		}
+		key := copyKey{rv.Type(), rv.Pointer()}
+		if r, ok := c.seen[key]; ok {
+			return r
+		}
+		if rv.Type() == orderedMapType {
+			om := rv.Interface().(*OrderedMap)
+			nm := NewOrderedMap()
+			c.seen[key] = reflect.ValueOf(nm)
+			for _, k := range om.Keys() {
+				nm.Set(k, c.copyValue(om.Get(k)))
+			}
+			return reflect.ValueOf(nm)
+		}
+		np := reflect.New(rv.Type().Elem())
+		c.seen[key] = np
+		np.Elem().Set(c.copy(rv.Elem()))
+		return np
+	case reflect.Map:
+		if rv.IsNil() {
+			return rv
+		}
+		key := copyKey{rv.Type(), rv.Pointer()}
+		if r, ok := c.seen[key]; ok {
+			return r
+		}
+		nm := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+		c.seen[key] = nm
+		iter := rv.MapRange()
+		for iter.Next() {
+			nm.SetMapIndex(iter.Key(), c.copy(iter.Value()))
+		}
+		return nm
+	case reflect.Slice:
+		if rv.IsNil() {
+			return rv
+		}
+		ns := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			ns.Index(i).Set(c.copy(rv.Index(i)))
+		}
+		return ns
+	case reflect.Array:
+		na := reflect.New(rv.Type()).Elem()
+		for i := 0; i < rv.Len(); i++ {
+			na.Index(i).Set(c.copy(rv.Index(i)))
+		}
+		return na
+	case reflect.Struct:
+		ns := reflect.New(rv.Type()).Elem()
+		ns.Set(rv)
+		for i := 0; i < rv.NumField(); i++ {
+			if f := ns.Field(i); f.CanSet() {
+				f.Set(c.copy(rv.Field(i)))
+			}
+		}
+		return ns
+	case reflect.Interface:
+		if rv.IsNil() {
+			return rv
+		}
+		ni := reflect.New(rv.Type()).Elem()
+		ni.Set(c.copy(rv.Elem()))
+		return ni
+	}
+	return rv
+}
+
+func (c *copier) copyValue(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return c.copy(reflect.ValueOf(value)).Interface()
+}
+
+// SetSnapshot set whether the value is copied by Snapshot before the
+// rendering. It prevents the torn output by the side effects of the helpers
+// or the mutation of the value by the caller while the rendering.
+func (t *Template) SetSnapshot(on bool) {
+	t.snapshot = on
+}
@@ -0,0 +1,77 @@
+package slim
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testNode struct {
+	Name     string
+	Children []*testNode
+	Parent   *testNode
+}
+
+func TestSnapshot(t *testing.T) {
+	root := &testNode{Name: "root"}
+	root.Children = []*testNode{{Name: "child", Parent: root}}
+	om := NewOrderedMap()
+	om.Set("b", []int{1})
+	value := map[string]interface{}{
+		"root":  root,
+		"tags":  []string{"a", "b"},
+		"order": om,
+		"arr":   [2]map[string]int{{"x": 1}},
+	}
+	copied := Snapshot(value).(map[string]interface{})
+	if !reflect.DeepEqual(value, copied) {
+		t.Fatalf("expected %v but %v", value, copied)
+	}
+	value["tags"].([]string)[0] = "changed"
+	root.Children[0].Name = "changed"
+	om.Get("b").([]int)[0] = 2
+	value["arr"].([2]map[string]int)[0]["x"] = 2
+
+	if s := copied["tags"].([]string)[0]; s != "a" {
+		t.Fatalf("expected %q but %q", "a", s)
+	}
+	cr := copied["root"].(*testNode)
+	if cr.Children[0].Name != "child" || cr.Children[0].Parent != cr {
+		t.Fatal("expected the copy of the tree")
+	}
+	if n := copied["order"].(*OrderedMap).Get("b").([]int)[0]; n != 1 {
+		t.Fatalf("expected 1 but %d", n)
+	}
+	if n := copied["arr"].([2]map[string]int)[0]["x"]; n != 1 {
+		t.Fatalf("expected 1 but %d", n)
+	}
+}
+
+func TestSetSnapshot(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+div
+  p = mutate(items)
+  - for x in items
+    p = x
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.FuncMap(Funcs{
+		"mutate": func(args ...Value) (Value, error) {
+			items := args[0].([]string)
+			items[0] = "mutated"
+			return "done", nil
+		},
+	})
+	tmpl.SetSnapshot(true)
+	items := []string{"a", "b"}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, Values{"items": items}); err != nil {
+		t.Fatal(err)
+	}
+	if items[0] != "a" {
+		t.Fatalf("expected the value is not changed but %q", items[0])
+	}
+}
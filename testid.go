@@ -0,0 +1,63 @@
+package slim
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SetTestIDs set whether the data-testid attributes are injected to the
+// elements, like "users/index/div/ul/li-2". The id is derived from the name
+// of the template and the position of the element in it, so the selectors
+// of the end-to-end tests are stable without writing them in the templates.
+// The data-testid written in the template is kept.
+func (t *Template) SetTestIDs(on bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.testid = on
+}
+
+// testID returns the data-testid of n.
+func (t *Template) testID(n *Node) string {
+	t.testIDOnce.Do(func() {
+		prefix := strings.TrimSuffix(filepath.ToSlash(t.name), ".slim")
+		t.testIDs = map[*Node]string{}
+		walkTestIDs(t.testIDs, t.root.Children, prefix, map[string]int{})
+	})
+	return t.testIDs[n]
+}
+
+// walkTestIDs set the ids of the elements in nodes. The nodes which are not
+// the elements like "- for" are transparent, so their children are counted
+// as the siblings.
+func walkTestIDs(ids map[*Node]string, nodes []*Node, prefix string, counts map[string]int) {
+	for _, n := range nodes {
+		switch n.Name {
+		case "", "/", "/!", "/[", "<", "|", "'", "block", "mixin", "+", "doctype":
+			walkTestIDs(ids, n.Children, prefix, counts)
+			if n.Else != nil {
+				walkTestIDs(ids, n.Else.Children, prefix, counts)
+			}
+			continue
+		}
+		name := strings.TrimSuffix(n.Name, ":")
+		counts[name]++
+		id := prefix + "/" + name
+		if c := counts[name]; c > 1 {
+			id += "-" + strconv.Itoa(c)
+		}
+		ids[n] = strings.TrimPrefix(id, "/")
+		walkTestIDs(ids, n.Children, id, map[string]int{})
+	}
+}
+
+// SetTestIDs set whether the data-testid attributes are injected to the
+// elements of the templates in the set.
+func (s *TemplateSet) SetTestIDs(on bool) {
+	s.mu.Lock()
+	s.testid = on
+	s.mu.Unlock()
+	s.cache.each(func(t *Template) {
+		t.SetTestIDs(on)
+	})
+}
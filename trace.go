@@ -0,0 +1,73 @@
+package slim
+
+import (
+	"time"
+)
+
+// TraceKind is a type for indicating kind of TraceEvent.
+type TraceKind int
+
+const (
+	// TraceExpr is the event of evaluating the expression of the node.
+	TraceExpr TraceKind = iota
+	// TracePartial is the event of rendering the partial with render().
+	TracePartial
+)
+
+func (k TraceKind) String() string {
+	switch k {
+	case TraceExpr:
+		return "expr"
+	case TracePartial:
+		return "partial"
+	}
+	return "unknown"
+}
+
+// TraceEvent is an event reported to Tracer.
+type TraceEvent struct {
+	Kind TraceKind
+	// Template is the name of the template.
+	Template string
+	// Line is the line number in the template. It is zero for partials.
+	Line int
+	// Source is the expression or the name of the partial.
+	Source   string
+	Duration time.Duration
+	Err      error
+}
+
+// Tracer is the interface for receiving events of the execution.
+// It may be called by multiple goroutines in parallel.
+type Tracer interface {
+	Trace(e *TraceEvent)
+}
+
+// TracerFunc is an adapter to allow the use of ordinary functions as Tracer.
+type TracerFunc func(e *TraceEvent)
+
+// Trace calls f(e).
+func (f TracerFunc) Trace(e *TraceEvent) {
+	f(e)
+}
+
+// SetTracer set the tracer for the template. Templates rendered by render()
+// share the tracer of the parent.
+func (t *Template) SetTracer(tr Tracer) {
+	t.tracer = tr
+}
+
+func (t *Template) trace(kind TraceKind, line int, source string, start time.Time, err error) {
+	tracer := t.top().tracer
+	if tracer == nil {
+		return
+	}
+	tracer.Trace(&TraceEvent{
+		Kind:     kind,
+		Template: t.name,
+		Line:     line,
+		Source:   source,
+		Duration: time.Since(start),
+		Err:      err,
+	})
+}
@@ -0,0 +1,70 @@
+package slim
+
+import (
+	"fmt"
+	"path"
+)
+
+// Tree is the parsed tree of the template. The directives like "- ifdef" and
+// "- else" are not applied yet.
+type Tree struct {
+	Root        *Node
+	Annotations map[string]string
+}
+
+// copyNode returns the deep copy of n.
+func copyNode(n *Node) *Node {
+	if n == nil {
+		return nil
+	}
+	c := *n
+	c.Class = append([]string(nil), n.Class...)
+	c.Attr = append([]Attr(nil), n.Attr...)
+	c.Children = make([]*Node, len(n.Children))
+	for i, child := range n.Children {
+		c.Children[i] = copyNode(child)
+	}
+	c.Else = copyNode(n.Else)
+	return &c
+}
+
+// AddTree add the template named name with the parsed tree, like the code
+// generated by "slimc embed". The source is not parsed, and the expressions
+// are compiled here. It overrides the template of the loader and AddRaw
+// which has the same name.
+func (s *TemplateSet) AddTree(name string, tree *Tree) error {
+	name = cleanName(name)
+	c := s.cache
+	c.mu.Lock()
+	t, err := c.newTreeTemplate(name, tree)
+	if err == nil {
+		err = t.compile(t.root)
+	}
+	if err != nil {
+		c.mu.Unlock()
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if c.trees == nil {
+		c.trees = map[string]*Tree{}
+	}
+	c.trees[name] = tree
+	c.put(&cacheEntry{name: name, t: t})
+	c.mu.Unlock()
+	return nil
+}
+
+// newTreeTemplate create the template named name of tree in c.
+func (c *Cache) newTreeTemplate(name string, tree *Tree) (*Template, error) {
+	t, err := newTemplate(tree, c.tags)
+	if err != nil {
+		return nil, err
+	}
+	t.name = name
+	t.dir = path.Dir(name)
+	t.loader = c.loader
+	t.cache = c
+	if c.adopt != nil {
+		c.adopt(t)
+	}
+	return t, nil
+}
@@ -0,0 +1,176 @@
+package slim
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ExecuteTyped is same as Execute but the type of value is checked at
+// compile time. It is typically used with the models generated by
+// "slimc gen-model". The fields of the struct and the anonymous structs in
+// it are bound with the names in json tag.
+func ExecuteTyped[T any](t *Template, out io.Writer, value T) error {
+	rv := reflect.Indirect(reflect.ValueOf(value))
+	if rv.Kind() != reflect.Struct {
+		return t.Execute(out, value)
+	}
+	return t.Execute(out, modelValues(rv))
+}
+
+// modelValues returns the fields of the struct rv as Values.
+func modelValues(rv reflect.Value) Values {
+	rt := rv.Type()
+	values := Values{}
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		name := fieldName(sf, true)
+		if name == "" {
+			continue
+		}
+		values[name] = modelValue(rv.Field(i))
+	}
+	return values
+}
+
+// modelValue convert the anonymous structs in rv to Values. Named types are
+// kept as is, so their methods can be called.
+func modelValue(rv reflect.Value) interface{} {
+	rt := rv.Type()
+	switch {
+	case rt.Kind() == reflect.Struct && rt.Name() == "":
+		return modelValues(rv)
+	case (rt.Kind() == reflect.Slice || rt.Kind() == reflect.Array) && rt.Elem().Kind() == reflect.Struct && rt.Elem().Name() == "":
+		items := make([]interface{}, rv.Len())
+		for i := range items {
+			items[i] = modelValues(rv.Index(i))
+		}
+		return items
+	}
+	return rv.Interface()
+}
+
+// Typed is the template which is executed with the value of T. At the first
+// execution, T is validated against the data which the template reads, so
+// the mismatch is found by the tests rather than the rendering in production.
+type Typed[T any] struct {
+	t    *Template
+	once sync.Once
+	err  error
+}
+
+// NewTyped create the typed template of t.
+func NewTyped[T any](t *Template) *Typed[T] {
+	return &Typed[T]{t: t}
+}
+
+// Template returns the underlying template.
+func (tt *Typed[T]) Template() *Template {
+	return tt.t
+}
+
+// Validate check that T has all the fields which the template reads. The
+// result is cached.
+func (tt *Typed[T]) Validate() error {
+	tt.once.Do(func() {
+		r, err := Analyze(tt.t)
+		if err != nil {
+			tt.err = err
+			return
+		}
+		var missing []string
+		rt := reflect.TypeOf((*T)(nil)).Elem()
+		for _, f := range r.Fields {
+			missing = append(missing, checkField(rt, f, f.Name, true)...)
+		}
+		if len(missing) > 0 {
+			tt.err = fmt.Errorf("%v doesn't have the fields which template %q reads: %s", rt, tt.t.name, strings.Join(missing, ", "))
+		}
+	})
+	return tt.err
+}
+
+// Execute validate T at the first call, then execute the template with value
+// like ExecuteTyped.
+func (tt *Typed[T]) Execute(out io.Writer, value T) error {
+	if err := tt.Validate(); err != nil {
+		return err
+	}
+	return ExecuteTyped(tt.t, out, value)
+}
+
+// checkField returns the paths missing in rt for the field f. tagged is true
+// if the fields of rt are bound with the names in json tag.
+func checkField(rt reflect.Type, f *Field, path string, tagged bool) []string {
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	switch rt.Kind() {
+	case reflect.Struct:
+	case reflect.Map:
+		if rt.Key().Kind() != reflect.String {
+			return nil
+		}
+		return checkShape(rt.Elem(), f, path)
+	default:
+		return nil
+	}
+	if f.Method {
+		if _, ok := reflect.PtrTo(rt).MethodByName(f.Name); ok {
+			return nil
+		}
+		if _, ok := rt.MethodByName(f.Name); ok {
+			return nil
+		}
+		return []string{path}
+	}
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" || fieldName(sf, tagged) != f.Name {
+			continue
+		}
+		return checkShape(sf.Type, f, path)
+	}
+	return []string{path}
+}
+
+// checkShape returns the paths missing in rt for the fields and the items of
+// f.
+func checkShape(rt reflect.Type, f *Field, path string) []string {
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	var missing []string
+	anonymous := rt.Name() == ""
+	for _, c := range f.Fields {
+		missing = append(missing, checkField(rt, c, path+"."+c.Name, anonymous)...)
+	}
+	if f.Elem != nil {
+		switch rt.Kind() {
+		case reflect.Array, reflect.Slice, reflect.Chan, reflect.Map:
+			missing = append(missing, checkShape(rt.Elem(), f.Elem, path+"[]")...)
+		}
+	}
+	return missing
+}
+
+func fieldName(sf reflect.StructField, tagged bool) string {
+	if !tagged {
+		return sf.Name
+	}
+	if tag, ok := sf.Tag.Lookup("json"); ok {
+		tag = strings.Split(tag, ",")[0]
+		if tag == "-" {
+			return ""
+		}
+		if tag != "" {
+			return tag
+		}
+	}
+	return sf.Name
+}
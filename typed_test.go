@@ -0,0 +1,100 @@
+package slim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type testModel struct {
+	Title string `json:"title"`
+	Items []struct {
+		Name  string `json:"name"`
+		Price int    `json:"price"`
+	} `json:"items"`
+	Ignored string `json:"-"`
+}
+
+func TestExecuteTyped(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+h1 = title
+- for item in items
+  p = item.name + item.price
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m testModel
+	m.Title = "menu"
+	m.Items = append(m.Items, struct {
+		Name  string `json:"name"`
+		Price int    `json:"price"`
+	}{"tea", 3})
+	var buf bytes.Buffer
+	if err := ExecuteTyped(tmpl, &buf, m); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<h1>menu</h1>\n<p>tea3</p>\n"
+	got := buf.String()
+	if expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+}
+
+type testUser struct {
+	Name string
+}
+
+func (u *testUser) Greet() string {
+	return "hello " + u.Name
+}
+
+func TestTyped(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader(`
+h1 = title
+p = user.Name
+p = user.Greet()
+- for item in items
+  p = item.name
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type good struct {
+		Title string    `json:"title"`
+		User  *testUser `json:"user"`
+		Items []struct {
+			Name string `json:"name"`
+		} `json:"items"`
+	}
+	var buf bytes.Buffer
+	err = NewTyped[good](tmpl).Execute(&buf, good{Title: "t", User: &testUser{Name: "bob"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<h1>t</h1>\n<p>bob</p>\n<p>hello bob</p>\n"
+	if got := buf.String(); expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+
+	type bad struct {
+		Title string   `json:"name"`
+		User  testUser `json:"user"`
+		Items []struct {
+			Title string `json:"title"`
+		} `json:"items"`
+	}
+	typed := NewTyped[bad](tmpl)
+	err = typed.Execute(&buf, bad{})
+	if err == nil {
+		t.Fatal("expected error but nil")
+	}
+	for _, path := range []string{"title", "items[].name"} {
+		if !strings.Contains(err.Error(), path) {
+			t.Fatalf("expected %q in error: %v", path, err)
+		}
+	}
+	if typed.Validate() != err {
+		t.Fatal("expected the cached error")
+	}
+}
@@ -0,0 +1,74 @@
+package slim
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/mattn/go-slim/vm"
+)
+
+// printable returns value converted to the text of the output. nil and the
+// nil pointers are empty. The others are converted by the printer of v if it
+// is set. Otherwise time.Time is formatted with the layout of v, and
+// fmt.Stringer and error are their strings if the methods are allowed by
+// Restrict and RestrictData. The trusted types like HTML and the others are
+// kept as is, so they are not escaped. In the whitelist-only data mode, the
+// values which types are not exposed are refused.
+func printable(v *vm.VM, value interface{}) (interface{}, error) {
+	switch value.(type) {
+	case nil:
+		return "", nil
+	case HTML, JS, CSS, URL:
+		return value, nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		if rv.IsNil() {
+			return "", nil
+		}
+	}
+	switch value.(type) {
+	case time.Time, *time.Time:
+	default:
+		if err := v.CheckPrint(value); err != nil {
+			return nil, err
+		}
+	}
+	if p := v.ValuePrinter(); p != nil {
+		return p(value)
+	}
+	switch t := value.(type) {
+	case string:
+		return t, nil
+	case time.Time:
+		return t.Format(v.TimeLayout()), nil
+	case *time.Time:
+		return t.Format(v.TimeLayout()), nil
+	case error:
+		if err := v.CheckMethodCall(t, "Error"); err != nil {
+			return nil, err
+		}
+		return t.Error(), nil
+	case fmt.Stringer:
+		if err := v.CheckMethodCall(t, "String"); err != nil {
+			return nil, err
+		}
+		return t.String(), nil
+	}
+	return value, nil
+}
+
+// SetTimeLayout set the layout of time.Time printed in the template. The
+// default is time.RFC3339. See vm.VM.SetTimeLayout.
+func (t *Template) SetTimeLayout(layout string) {
+	t.vm.SetTimeLayout(layout)
+}
+
+// SetValuePrinter set the printer which convert the values to the text of
+// the output, like formatting the numbers and the dates for the locale. See
+// vm.VM.SetValuePrinter.
+func (t *Template) SetValuePrinter(p vm.ValuePrinter) {
+	t.vm.SetValuePrinter(p)
+}
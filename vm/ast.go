@@ -1,5 +1,9 @@
 package vm
 
+import (
+	"fmt"
+)
+
 // Expr is a type for indicating expression.
 type Expr interface {
 }
@@ -11,6 +15,12 @@ type BinOpExpr struct {
 	RHS Expr
 }
 
+// UnaryExpr is a type for indicating unary operator.
+type UnaryExpr struct {
+	Op   string
+	Expr Expr
+}
+
 // IdentExpr is a type for indicating ident.
 type IdentExpr struct {
 	Name string
@@ -28,6 +38,68 @@ type ForExpr struct {
 	RHS  Expr
 }
 
+// DeadlineExpr is a type for indicating block which should be rendered in
+// the timeout.
+type DeadlineExpr struct {
+	Timeout Expr
+}
+
+// ElseExpr is a type for indicating fallback block of the previous block.
+type ElseExpr struct {
+}
+
+// BreakExpr is a type for indicating stopping the loop. Cond is nil if it
+// stops unconditionally.
+type BreakExpr struct {
+	Cond Expr
+}
+
+// ContinueExpr is a type for indicating skipping to the next item of the
+// loop. Cond is nil if it skips unconditionally.
+type ContinueExpr struct {
+	Cond Expr
+}
+
+// FlushExpr is a type for indicating flushing the output written so far.
+type FlushExpr struct {
+}
+
+// AssertExpr is a type for indicating the assertion of the data like
+// "assert cond, message". Message is nil if it is omitted.
+type AssertExpr struct {
+	Cond    Expr
+	Message Expr
+}
+
+// DirectiveExpr is a type for indicating custom directive like
+// "name lhs = rhs".
+type DirectiveExpr struct {
+	Name string
+	LHS  string
+	RHS  Expr
+}
+
+// MapExpr is a type for indicating map like keyword arguments
+// "f(a, limit: 10)". It is evaluated as map[string]interface{}.
+type MapExpr struct {
+	Keys   []string
+	Values []Expr
+}
+
+// ArrayExpr is a type for indicating array like ["a", "b"]. It is evaluated
+// as []interface{}.
+type ArrayExpr struct {
+	Exprs []Expr
+}
+
+// CondExpr is a type for indicating conditional operator like
+// "cond ? a : b".
+type CondExpr struct {
+	Cond Expr
+	Then Expr
+	Else Expr
+}
+
 // CallExpr is a type for indicating calling functions.
 type CallExpr struct {
 	Name  string
@@ -52,3 +124,118 @@ type ItemExpr struct {
 	LHS   Expr
 	Index Expr
 }
+
+// SliceExpr is a type for indicating slicing items like items[low:high].
+// Low and High are nil if omitted.
+type SliceExpr struct {
+	LHS  Expr
+	Low  Expr
+	High Expr
+}
+
+// IndexOutOfRangeError is the error returned when the index is out of range.
+type IndexOutOfRangeError struct {
+	Index  int
+	Length int
+}
+
+func (e *IndexOutOfRangeError) Error() string {
+	return fmt.Sprintf("index out of range [%d] with length %d", e.Index, e.Length)
+}
+
+// NilReceiverError is the error returned when the member, the item or the
+// method is referenced on nil.
+type NilReceiverError struct {
+	// Path is the expression like "user.Address.City".
+	Path string
+	// Nil is the segment which was nil like "user.Address".
+	Nil string
+}
+
+func (e *NilReceiverError) Error() string {
+	return fmt.Sprintf("cannot reference %s: %s is nil", e.Path, e.Nil)
+}
+
+// exprPath returns the source of the path like "user.Address.City". The
+// parts which are not the path are written as "(...)".
+func exprPath(expr Expr) string {
+	switch t := expr.(type) {
+	case *IdentExpr:
+		return t.Name
+	case *MemberExpr:
+		return exprPath(t.LHS) + "." + t.Name
+	case *MethodCallExpr:
+		return exprPath(t.LHS) + "." + t.Name + "()"
+	case *CallExpr:
+		return t.Name + "()"
+	case *ItemExpr:
+		if lit, ok := t.Index.(*LitExpr); ok {
+			if s, ok := lit.Value.(string); ok {
+				return fmt.Sprintf("%s[%q]", exprPath(t.LHS), s)
+			}
+			return fmt.Sprintf("%s[%v]", exprPath(t.LHS), lit.Value)
+		}
+		return exprPath(t.LHS) + "[...]"
+	case *SliceExpr:
+		return exprPath(t.LHS) + "[:]"
+	}
+	return "(...)"
+}
+
+// Walk traverse expr in depth-first order and call f for each expression.
+// The children are not visited if f returns false.
+func Walk(expr Expr, f func(Expr) bool) {
+	if expr == nil || !f(expr) {
+		return
+	}
+	switch t := expr.(type) {
+	case *BinOpExpr:
+		Walk(t.LHS, f)
+		Walk(t.RHS, f)
+	case *UnaryExpr:
+		Walk(t.Expr, f)
+	case *ForExpr:
+		Walk(t.RHS, f)
+	case *DeadlineExpr:
+		Walk(t.Timeout, f)
+	case *BreakExpr:
+		Walk(t.Cond, f)
+	case *ContinueExpr:
+		Walk(t.Cond, f)
+	case *AssertExpr:
+		Walk(t.Cond, f)
+		Walk(t.Message, f)
+	case *DirectiveExpr:
+		Walk(t.RHS, f)
+	case *MapExpr:
+		for _, e := range t.Values {
+			Walk(e, f)
+		}
+	case *ArrayExpr:
+		for _, e := range t.Exprs {
+			Walk(e, f)
+		}
+	case *CondExpr:
+		Walk(t.Cond, f)
+		Walk(t.Then, f)
+		Walk(t.Else, f)
+	case *CallExpr:
+		for _, e := range t.Exprs {
+			Walk(e, f)
+		}
+	case *MethodCallExpr:
+		Walk(t.LHS, f)
+		for _, e := range t.Exprs {
+			Walk(e, f)
+		}
+	case *MemberExpr:
+		Walk(t.LHS, f)
+	case *ItemExpr:
+		Walk(t.LHS, f)
+		Walk(t.Index, f)
+	case *SliceExpr:
+		Walk(t.LHS, f)
+		Walk(t.Low, f)
+		Walk(t.High, f)
+	}
+}
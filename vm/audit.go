@@ -0,0 +1,131 @@
+package vm
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Audit records the paths of the data which the VM accessed, like
+// "user.address.city", "items[].name" or "user.FullName()".
+type Audit struct {
+	mu    sync.Mutex
+	paths map[string]int
+	alias map[string]string
+}
+
+// NewAudit create the audit.
+func NewAudit() *Audit {
+	return &Audit{
+		paths: make(map[string]int),
+		alias: make(map[string]string),
+	}
+}
+
+// Alias record the accesses through the variable name as the path of expr.
+// If elem is true, name is bound to the items of expr like the variable of
+// the loop. If expr is not the path, the alias of name is removed.
+func (a *Audit) Alias(name string, expr Expr, elem bool) {
+	root, rest, ok := splitPath(expr)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !ok {
+		delete(a.alias, name)
+		return
+	}
+	if elem {
+		rest += "[]"
+	}
+	if p, ok := a.alias[root]; ok {
+		root = p
+	}
+	a.alias[name] = root + rest
+}
+
+// Paths returns the paths accessed in the sorted order.
+func (a *Audit) Paths() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	paths := make([]string, 0, len(a.paths))
+	for p := range a.paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Count returns the number of the accesses to path.
+func (a *Audit) Count(path string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.paths[path]
+}
+
+func (a *Audit) record(root, rest string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if p, ok := a.alias[root]; ok {
+		root = p
+	}
+	a.paths[root+rest]++
+}
+
+// SetAudit set the audit which records the accesses to the data.
+func (v *VM) SetAudit(a *Audit) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.audit = a
+}
+
+// Audit returns the audit set by SetAudit.
+func (v *VM) Audit() *Audit {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.audit
+}
+
+// splitPath returns the variable and the rest of the path of expr. It returns
+// false if expr is not the path like the call of the function.
+func splitPath(expr Expr) (string, string, bool) {
+	switch t := expr.(type) {
+	case *IdentExpr:
+		return t.Name, "", true
+	case *MemberExpr:
+		root, rest, ok := splitPath(t.LHS)
+		return root, rest + "." + t.Name, ok
+	case *ItemExpr:
+		root, rest, ok := splitPath(t.LHS)
+		if lit, isLit := t.Index.(*LitExpr); isLit {
+			if s, isStr := lit.Value.(string); isStr {
+				return root, rest + "." + s, ok
+			}
+		}
+		return root, rest + "[]", ok
+	case *SliceExpr:
+		root, rest, ok := splitPath(t.LHS)
+		return root, rest + "[]", ok
+	case *MethodCallExpr:
+		root, rest, ok := splitPath(t.LHS)
+		return root, rest + "." + t.Name + "()", ok
+	}
+	return "", "", false
+}
+
+// accessed record the access to the data by expr, and returns val.
+func (v *VM) accessed(expr Expr, val interface{}) (interface{}, error) {
+	a := v.Audit()
+	if a == nil {
+		return val, nil
+	}
+	switch val.(type) {
+	case NullValue, Namespace:
+		return val, nil
+	}
+	if _, ok := expr.(*IdentExpr); ok && reflect.ValueOf(val).Kind() == reflect.Func {
+		return val, nil
+	}
+	if root, rest, ok := splitPath(expr); ok {
+		a.record(root, rest)
+	}
+	return val, nil
+}
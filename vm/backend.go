@@ -0,0 +1,133 @@
+package vm
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Env is the interface for referencing the values of the VM from the
+// programs of the backend.
+type Env interface {
+	Get(name string) (interface{}, bool)
+}
+
+// Program is the expression compiled by the Backend.
+type Program interface {
+	Eval(ctx context.Context, env Env) (interface{}, error)
+}
+
+// Backend is the interface of the expression language. The statements like
+// "for x in expr" are parsed by the VM, and the expressions in them are
+// compiled by the backend.
+type Backend interface {
+	Compile(src string) (Program, error)
+}
+
+// ProgramExpr is a type for indicating the expression compiled by the
+// backend.
+type ProgramExpr struct {
+	Source  string
+	Program Program
+}
+
+// SetBackend set the backend of the expressions. nil means the builtin
+// language. The clones of the VM use the backend of the original.
+func (v *VM) SetBackend(b Backend) {
+	v.backend = b
+	v.ClearCache()
+}
+
+var (
+	backendFor       = regexp.MustCompile(`^for\s+([A-Za-z_]\w*)(?:\s*,\s*([A-Za-z_]\w*))?\s+in\s+(.+)$`)
+	backendDeadline  = regexp.MustCompile(`^deadline\s+(.+)$`)
+	backendJump      = regexp.MustCompile(`^(break|continue)(?:\s+if\s+(.+))?$`)
+	backendAssert    = regexp.MustCompile(`^assert\s+(.+?)(?:\s*,\s*("(?:[^"\\]|\\.)*"))?$`)
+	backendDirective = regexp.MustCompile(`^([A-Za-z_]\w*)\s+([A-Za-z_]\w*)\s*=([^=].*)$`)
+	backendSymbol    = regexp.MustCompile(`^([A-Za-z_]\w*)\s+:([A-Za-z_]\w*)$`)
+)
+
+// compileBackend parse the statement, and compile the expressions with the
+// backend. The statements of the control lines are parsed only if stmt is
+// true.
+func (v *VM) compileBackend(s string, stmt bool) (Expr, error) {
+	s = strings.TrimSpace(s)
+	compile := func(src string) (Expr, error) {
+		p, err := v.backend.Compile(strings.TrimSpace(src))
+		if err != nil {
+			return nil, err
+		}
+		return &ProgramExpr{Source: src, Program: p}, nil
+	}
+	if m := backendFor.FindStringSubmatch(s); m != nil {
+		rhs, err := compile(m[3])
+		if err != nil {
+			return nil, err
+		}
+		return &ForExpr{LHS1: m[1], LHS2: m[2], RHS: rhs}, nil
+	}
+	if stmt {
+		if expr, ok, err := backendStmt(s, compile); ok || err != nil {
+			return expr, err
+		}
+	}
+	if m := backendDirective.FindStringSubmatch(s); m != nil {
+		rhs, err := compile(m[3])
+		if err != nil {
+			return nil, err
+		}
+		return &DirectiveExpr{Name: m[1], LHS: m[2], RHS: rhs}, nil
+	}
+	if m := backendSymbol.FindStringSubmatch(s); m != nil {
+		return &CallExpr{Name: m[1], Exprs: []Expr{&LitExpr{Value: m[2]}}}, nil
+	}
+	return compile(s)
+}
+
+// backendStmt parse the statements which start with the keywords of the
+// control lines. It returns false if s is not the statement.
+func backendStmt(s string, compile func(string) (Expr, error)) (Expr, bool, error) {
+	if s == "else" {
+		return &ElseExpr{}, true, nil
+	}
+	if s == "flush" {
+		return &FlushExpr{}, true, nil
+	}
+	if m := backendDeadline.FindStringSubmatch(s); m != nil {
+		timeout, err := compile(m[1])
+		if err != nil {
+			return nil, true, err
+		}
+		return &DeadlineExpr{Timeout: timeout}, true, nil
+	}
+	if m := backendJump.FindStringSubmatch(s); m != nil {
+		var cond Expr
+		if m[2] != "" {
+			var err error
+			if cond, err = compile(m[2]); err != nil {
+				return nil, true, err
+			}
+		}
+		if m[1] == "break" {
+			return &BreakExpr{Cond: cond}, true, nil
+		}
+		return &ContinueExpr{Cond: cond}, true, nil
+	}
+	if m := backendAssert.FindStringSubmatch(s); m != nil {
+		c, err := compile(m[1])
+		if err != nil {
+			return nil, true, err
+		}
+		var message Expr
+		if m[2] != "" {
+			s, err := strconv.Unquote(m[2])
+			if err != nil {
+				return nil, true, err
+			}
+			message = &LitExpr{Value: s}
+		}
+		return &AssertExpr{Cond: c, Message: message}, true, nil
+	}
+	return nil, false, nil
+}
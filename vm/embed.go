@@ -0,0 +1,75 @@
+package vm
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+)
+
+// nilField returns the path of the nil embedded pointer in the index of the
+// promoted field of rv like "Base", or empty if the field can be referenced.
+func nilField(rv reflect.Value, index []int) string {
+	path := ""
+	for _, i := range index[:len(index)-1] {
+		if path != "" {
+			path += "."
+		}
+		path += rv.Type().Field(i).Name
+		rv = rv.Field(i)
+		if rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				return path
+			}
+			rv = rv.Elem()
+		}
+	}
+	return ""
+}
+
+// nilEmbedded returns the path of the nil embedded pointer of rv which has
+// the method name, or empty if there is no such pointer.
+func nilEmbedded(rv reflect.Value, name string) string {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if !sf.Anonymous {
+			continue
+		}
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				if _, ok := fv.Type().MethodByName(name); ok {
+					return sf.Name
+				}
+				continue
+			}
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Struct {
+			if path := nilEmbedded(fv, name); path != "" {
+				return sf.Name + "." + path
+			}
+		}
+	}
+	return ""
+}
+
+// callMethod call the method of rv referenced by expr. The panic of the
+// method promoted through the nil embedded pointer is returned as
+// NilReceiverError, but the methods which accept the nil receiver are
+// called as usual.
+func (v *VM) callMethod(ctx context.Context, expr, recv Expr, rv reflect.Value, name string, meth reflect.Value, args []reflect.Value) (r interface{}, err error) {
+	if rv.Kind() == reflect.Struct {
+		if path := nilEmbedded(rv, name); path != "" {
+			defer func() {
+				if e := recover(); e != nil {
+					if _, ok := e.(runtime.Error); !ok {
+						panic(e)
+					}
+					r, err = v.missing(&NilReceiverError{Path: exprPath(expr), Nil: exprPath(recv) + "." + path})
+				}
+			}()
+		}
+	}
+	return callFunc(ctx, meth, args)
+}
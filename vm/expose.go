@@ -0,0 +1,232 @@
+package vm
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Exported is the marker to expose the struct in the whitelist-only data
+// mode. Embed it into the struct.
+//
+//	type User struct {
+//		vm.Exported
+//		Name string
+//	}
+type Exported struct{}
+
+var exportedType = reflect.TypeOf(Exported{})
+
+type exposure struct {
+	mu    sync.RWMutex
+	types map[reflect.Type]bool
+}
+
+// RestrictData enable the whitelist-only data mode. In the mode, fields and
+// methods can be accessed only on the types exposed by Expose or the structs
+// which embed Exported, and unexported fields are never accessed. Maps,
+// slices and arrays can be indexed. The clones of the VM share the whitelist.
+func (v *VM) RestrictData() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.exposure == nil {
+		v.exposure = &exposure{types: make(map[reflect.Type]bool)}
+	}
+}
+
+// Expose expose the types of values in the whitelist-only data mode.
+func (v *VM) Expose(values ...interface{}) {
+	v.RestrictData()
+	v.mu.RLock()
+	e := v.exposure
+	v.mu.RUnlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, value := range values {
+		rt := reflect.TypeOf(value)
+		for rt.Kind() == reflect.Ptr {
+			rt = rt.Elem()
+		}
+		e.types[rt] = true
+	}
+}
+
+func (v *VM) getExposure() *exposure {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.exposure
+}
+
+// exposed returns true if rt is exposed.
+func (e *exposure) exposed(rt reflect.Type) bool {
+	e.mu.RLock()
+	ok := e.types[rt]
+	e.mu.RUnlock()
+	if ok {
+		return true
+	}
+	if rt.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < rt.NumField(); i++ {
+		if sf := rt.Field(i); sf.Anonymous && sf.Type == exportedType {
+			return true
+		}
+	}
+	return false
+}
+
+// checkType returns error if methods of rt can't be called in the
+// whitelist-only data mode.
+func (v *VM) checkType(rt reflect.Type) error {
+	e := v.getExposure()
+	if e == nil || e.exposed(rt) {
+		return nil
+	}
+	return fmt.Errorf("cannot reference %v: not exposed", rt)
+}
+
+// checkField returns error if the field name of rt can't be accessed in the
+// whitelist-only data mode. The fields promoted from the embedded structs
+// need the structs to be exposed too.
+func (v *VM) checkField(rt reflect.Type, name string) error {
+	e := v.getExposure()
+	if e == nil {
+		return nil
+	}
+	if !e.exposed(rt) {
+		return fmt.Errorf("cannot reference %v: not exposed", rt)
+	}
+	if sf, ok := rt.FieldByName(name); ok && !sf.IsExported() {
+		return fmt.Errorf("cannot reference unexported field %s of %v", name, rt)
+	}
+	index := v.fieldIndex(rt, name)
+	if index == nil {
+		return nil
+	}
+	ft := rt
+	for _, i := range index[:len(index)-1] {
+		ft = ft.Field(i).Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if !e.exposed(ft) {
+			return fmt.Errorf("cannot reference %v: not exposed", ft)
+		}
+	}
+	return nil
+}
+
+// CheckPrint returns error if value can't be printed in the whitelist-only
+// data mode. The structs, the maps, the slices and the arrays are printed
+// through reflection with all of their fields and items, so their types
+// must be exposed. The fields and the items are checked too, and the structs
+// in them must be exposed, but the maps, the slices and the arrays in them
+// need not. The structs which have the unexported fields can't be printed.
+func (v *VM) CheckPrint(value interface{}) error {
+	e := v.getExposure()
+	if e == nil || value == nil {
+		return nil
+	}
+	return e.checkPrint(reflect.ValueOf(value), true, map[uintptr]bool{})
+}
+
+var (
+	stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// checkPrint check rv and the values in it. top is true if rv is the value
+// to be printed, and seen is the pointers which are checked already.
+func (e *exposure) checkPrint(rv reflect.Value, top bool, seen map[uintptr]bool) error {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		if rv.Kind() == reflect.Ptr {
+			if seen[rv.Pointer()] {
+				return nil
+			}
+			seen[rv.Pointer()] = true
+			// the value is printed by the method.
+			if rt := rv.Type(); rt.Implements(stringerType) || rt.Implements(errorType) {
+				return e.checkPrintType(rt.Elem())
+			}
+		}
+		rv = rv.Elem()
+	}
+	rt := rv.Type()
+	if rt == timeType {
+		return nil
+	}
+	switch rt.Kind() {
+	case reflect.Struct:
+		if err := e.checkPrintType(rt); err != nil {
+			return err
+		}
+	case reflect.Map, reflect.Slice, reflect.Array:
+		if top {
+			if err := e.checkPrintType(rt); err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+	if rt.Implements(stringerType) || rt.Implements(errorType) {
+		return nil
+	}
+	switch rt.Kind() {
+	case reflect.Struct:
+		for i := 0; i < rt.NumField(); i++ {
+			sf := rt.Field(i)
+			if sf.Anonymous && sf.Type == exportedType {
+				continue
+			}
+			if !sf.IsExported() {
+				return fmt.Errorf("cannot print unexported field %s of %v", sf.Name, rt)
+			}
+			if err := e.checkPrint(rv.Field(i), false, seen); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := rv.MapRange()
+		for iter.Next() {
+			if err := e.checkPrint(iter.Key(), false, seen); err != nil {
+				return err
+			}
+			if err := e.checkPrint(iter.Value(), false, seen); err != nil {
+				return err
+			}
+		}
+	default:
+		if !composite(rt.Elem()) {
+			return nil
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := e.checkPrint(rv.Index(i), false, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkPrintType returns error if rt is not exposed.
+func (e *exposure) checkPrintType(rt reflect.Type) error {
+	if rt == timeType || e.exposed(rt) {
+		return nil
+	}
+	return fmt.Errorf("cannot print %v: not exposed", rt)
+}
+
+// composite returns true if the values of rt can have the other values.
+func composite(rt reflect.Type) bool {
+	switch rt.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array, reflect.Ptr, reflect.Interface:
+		return true
+	}
+	return false
+}
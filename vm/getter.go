@@ -0,0 +1,91 @@
+package vm
+
+import (
+	"context"
+	"reflect"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SetGetterFallback set whether the member which is not the field or the key
+// is referenced with the getter method. user.name calls GetName() which takes
+// no arguments and returns the value or the value and the error. The other
+// methods like Delete() are never called. It is disabled by default. The
+// methods are checked like the method calls in the sandboxed mode and the
+// whitelist-only data mode, and the results are passed to the redactor like
+// the fields.
+func (v *VM) SetGetterFallback(on bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.getters = on
+}
+
+// GetterFallback returns true if the getter fallback is enabled.
+func (v *VM) GetterFallback() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.getters
+}
+
+// getterNames returns the names of the getter methods of the member name.
+func getterNames(name string) []string {
+	r, size := utf8.DecodeRuneInString(name)
+	exported := string(unicode.ToUpper(r)) + name[size:]
+	return []string{"Get" + exported}
+}
+
+// getter call the getter method of the member referenced by expr on rv. It
+// returns false if rv has no getter.
+func (v *VM) getter(ctx context.Context, expr *MemberExpr, rv reflect.Value) (interface{}, bool, error) {
+	if !v.GetterFallback() || expr.Name == "" {
+		return nil, false, nil
+	}
+	for _, name := range getterNames(expr.Name) {
+		meth := v.methodByName(rv, name)
+		if !meth.IsValid() && rv.CanAddr() {
+			meth = v.methodByName(rv.Addr(), name)
+		}
+		if !meth.IsValid() {
+			ptr := reflect.New(rv.Type())
+			ptr.Elem().Set(rv)
+			meth = v.methodByName(ptr, name)
+		}
+		if !meth.IsValid() || !isGetter(meth.Type()) {
+			continue
+		}
+		if err := v.checkType(rv.Type()); err != nil {
+			return nil, true, err
+		}
+		if err := v.checkMethod(rv.Type(), name, meth); err != nil {
+			return nil, true, err
+		}
+		r, err := v.callMethod(ctx, expr, expr.LHS, rv, name, meth, nil)
+		if err != nil {
+			return nil, true, err
+		}
+		r, err = v.member(ctx, expr, rv.Type(), expr.Name, r)
+		return r, true, err
+	}
+	return nil, false, nil
+}
+
+// isGetter returns true if the method typed mt takes no arguments except
+// context.Context, and returns the value or the value and the error.
+func isGetter(mt reflect.Type) bool {
+	switch mt.NumIn() {
+	case 0:
+	case 1:
+		if mt.In(0) != contextType {
+			return false
+		}
+	default:
+		return false
+	}
+	switch mt.NumOut() {
+	case 1:
+		return true
+	case 2:
+		return mt.Out(1) == errorType
+	}
+	return false
+}
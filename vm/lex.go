@@ -6,12 +6,18 @@ import (
 	"strconv"
 	"strings"
 	"text/scanner"
+	"time"
+	"unicode"
 )
 
 // Lexer is a lexer.
 type Lexer struct {
-	s *scanner.Scanner
-	e Expr
+	s    *scanner.Scanner
+	e    Expr
+	end  int
+	stmt bool
+	n    int
+	prev int
 }
 
 func (l *Lexer) init(reader *strings.Reader) {
@@ -22,27 +28,49 @@ func (l *Lexer) init(reader *strings.Reader) {
 func (l *Lexer) Lex(v *yySymType) int {
 	var err error
 	var tok int
+	end := l.end
 	i := l.s.Scan()
+	first, prev := l.n == 0, l.prev
+	defer func() {
+		l.end = l.s.Pos().Offset
+		l.n++
+		l.prev = tok
+	}()
 	switch i {
 	case scanner.Ident:
 		v.str = l.s.TokenText()
+		tok = ident
 		switch v.str {
 		case "for":
 			tok = cfor
 		case "in":
 			tok = in
+		case "if":
+			if prev == cbreak || prev == ccontinue {
+				tok = cif
+			}
 		default:
-			tok = ident
+			if first && l.keyword() {
+				tok = keywords[v.str]
+			}
 		}
 	case scanner.Int:
 		tok = lit
-		v.lit, err = strconv.ParseInt(l.s.TokenText(), 10, 64)
+		if unicode.IsLetter(l.s.Peek()) {
+			v.lit, err = l.duration()
+		} else {
+			v.lit, err = strconv.ParseInt(l.s.TokenText(), 10, 64)
+		}
 		if err != nil {
 			return -1
 		}
 	case scanner.Float:
 		tok = lit
-		v.lit, _ = strconv.ParseFloat(l.s.TokenText(), 64)
+		if unicode.IsLetter(l.s.Peek()) {
+			v.lit, err = l.duration()
+		} else {
+			v.lit, err = strconv.ParseFloat(l.s.TokenText(), 64)
+		}
 		if err != nil {
 			return -1
 		}
@@ -54,12 +82,77 @@ func (l *Lexer) Lex(v *yySymType) int {
 		}
 	case scanner.EOF:
 		tok = 0
+	case '?':
+		tok = int(i)
+		if l.s.Peek() == '?' {
+			l.s.Next()
+			tok = coalesce
+		}
+	case '&':
+		tok = int(i)
+		if l.s.Peek() == '&' {
+			l.s.Next()
+			tok = and
+		}
+	case '|':
+		tok = int(i)
+		if l.s.Peek() == '|' {
+			l.s.Next()
+			tok = or
+		}
+	case ':':
+		// the symbol like :head after the space, "(" or "," is the string.
+		if (l.s.Position.Offset == 0 || l.s.Position.Offset > end || prev == '(' || prev == ',') && isSymbolStart(l.s.Peek()) {
+			l.s.Scan()
+			tok = lit
+			v.lit = l.s.TokenText()
+			break
+		}
+		tok = int(i)
 	default:
 		tok = int(i)
 	}
 	return tok
 }
 
+// keywords are the words which start the statements of the control lines.
+var keywords = map[string]int{
+	"deadline": cdeadline,
+	"else":     celse,
+	"break":    cbreak,
+	"continue": ccontinue,
+	"assert":   cassert,
+	"flush":    cflush,
+}
+
+// keyword returns true if the ident which is scanned now is the keyword. The
+// words are the keywords only at the start of the control lines, and not
+// followed by the member, the call or the item, so "flush" can be the name
+// of the value in the other places.
+func (l *Lexer) keyword() bool {
+	if _, ok := keywords[l.s.TokenText()]; !ok || !l.stmt {
+		return false
+	}
+	switch l.s.Peek() {
+	case '.', '(', '[':
+		return false
+	}
+	return true
+}
+
+func isSymbolStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+// duration parse the number followed by the unit like 50ms as time.Duration.
+func (l *Lexer) duration() (time.Duration, error) {
+	s := l.s.TokenText()
+	if l.s.Scan() != scanner.Ident {
+		return 0, fmt.Errorf("invalid duration: %s", s)
+	}
+	return time.ParseDuration(s + l.s.TokenText())
+}
+
 func (l *Lexer) Error(e string) {
 	fmt.Fprintf(os.Stderr, "syntax error: %s\n", e)
 }
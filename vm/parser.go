@@ -20,6 +20,17 @@ const ident = 57346
 const lit = 57347
 const cfor = 57348
 const in = 57349
+const cdeadline = 57350
+const celse = 57351
+const cbreak = 57352
+const ccontinue = 57353
+const cif = 57354
+const cassert = 57355
+const cflush = 57356
+const coalesce = 57357
+const and = 57358
+const or = 57359
+const UNARY = 57360
 
 var yyToknames = [...]string{
 	"$end",
@@ -29,29 +40,46 @@ var yyToknames = [...]string{
 	"lit",
 	"cfor",
 	"in",
-	"','",
-	"'('",
-	"')'",
+	"cdeadline",
+	"celse",
+	"cbreak",
+	"ccontinue",
+	"cif",
+	"cassert",
+	"cflush",
+	"coalesce",
+	"and",
+	"or",
+	"'?'",
 	"'+'",
 	"'-'",
 	"'*'",
 	"'/'",
+	"UNARY",
 	"'.'",
 	"'['",
+	"','",
+	"'='",
+	"':'",
+	"'('",
+	"')'",
+	"'{'",
+	"'}'",
 	"']'",
 }
+
 var yyStatenames = [...]string{}
 
 const yyEofCode = 1
 const yyErrCode = 2
 const yyInitialStackSize = 16
 
-//line parser.go.y:95
+//line parser.go.y:238
 
 /* vim: set et sw=2: */
 
 //line yacctab:1
-var yyExca = [...]int{
+var yyExca = [...]int8{
 	-1, 1,
 	1, -1,
 	-2, 0,
@@ -59,70 +87,123 @@ var yyExca = [...]int{
 
 const yyPrivate = 57344
 
-const yyLast = 53
-
-var yyAct = [...]int{
-
-	26, 3, 31, 25, 37, 31, 14, 32, 29, 18,
-	19, 20, 21, 15, 23, 16, 17, 27, 8, 9,
-	10, 11, 12, 13, 30, 24, 8, 9, 10, 11,
-	12, 13, 35, 34, 36, 8, 9, 10, 11, 12,
-	13, 6, 4, 2, 6, 4, 5, 28, 33, 5,
-	22, 7, 1,
+const yyLast = 301
+
+var yyAct = [...]int8{
+	42, 10, 71, 48, 17, 68, 68, 97, 76, 72,
+	24, 69, 39, 36, 19, 20, 43, 70, 21, 80,
+	21, 50, 95, 52, 53, 70, 55, 56, 57, 58,
+	59, 60, 61, 62, 63, 37, 65, 23, 46, 21,
+	38, 77, 47, 34, 35, 73, 22, 75, 29, 49,
+	88, 44, 18, 11, 85, 78, 28, 27, 26, 25,
+	30, 31, 32, 33, 40, 34, 35, 83, 15, 82,
+	45, 86, 87, 14, 81, 74, 64, 12, 87, 13,
+	90, 93, 39, 92, 91, 30, 31, 32, 33, 96,
+	34, 35, 29, 16, 32, 33, 99, 34, 35, 89,
+	28, 27, 26, 25, 30, 31, 32, 33, 1, 34,
+	35, 29, 0, 0, 0, 0, 0, 0, 98, 28,
+	27, 26, 25, 30, 31, 32, 33, 0, 34, 35,
+	0, 18, 11, 0, 4, 11, 2, 94, 3, 5,
+	6, 7, 0, 9, 8, 0, 0, 15, 0, 0,
+	15, 0, 14, 0, 29, 14, 12, 0, 13, 12,
+	84, 13, 28, 27, 26, 25, 30, 31, 32, 33,
+	29, 34, 35, 18, 11, 0, 0, 67, 28, 27,
+	26, 25, 30, 31, 32, 33, 0, 34, 35, 15,
+	0, 79, 18, 11, 14, 0, 0, 0, 12, 0,
+	13, 0, 41, 0, 0, 0, 0, 0, 15, 0,
+	0, 0, 29, 14, 0, 0, 66, 12, 0, 13,
+	28, 27, 26, 25, 30, 31, 32, 33, 29, 34,
+	35, 54, 18, 11, 0, 51, 11, 0, 0, 0,
+	30, 31, 32, 33, 0, 34, 35, 0, 15, 0,
+	0, 15, 0, 14, 0, 29, 14, 12, 0, 13,
+	12, 0, 13, 28, 27, 26, 25, 30, 31, 32,
+	33, 29, 34, 35, 0, 0, 0, 0, 0, 28,
+	27, 0, 29, 30, 31, 32, 33, 0, 34, 35,
+	28, 0, 0, 0, 30, 31, 32, 33, 0, 34,
+	35,
 }
-var yyPact = [...]int{
 
-	37, -1000, 47, 24, -1000, 40, 4, 8, 40, 40,
-	40, 40, 46, 40, 15, 40, 40, 43, 24, 24,
-	24, 24, -1, 7, -1000, -3, 24, 24, 41, 40,
-	-1000, 40, -1000, 40, -6, 24, 24, -1000,
+var yyPact = [...]int16{
+	130, -32768, 89, 228, 10, -32768, 34, 25, -32768, 228,
+	248, -32768, 228, 8, 169, 228, 44, 248, -9, 11,
+	78, 231, 228, 228, 205, 228, 228, 228, 228, 228,
+	228, 228, 228, 228, 72, 188, 147, -21, -32768, -3,
+	-24, -32768, 248, 19, 228, 71, 228, -20, -22, 15,
+	-20, -11, 248, 248, 228, 163, 264, 275, 221, 66,
+	73, 73, 19, 19, -10, 41, 127, -32768, 50, -32768,
+	228, 228, -32768, 248, 43, 248, -32768, 231, 248, 228,
+	231, -32768, 48, 104, -32768, -6, 248, 248, 228, -20,
+	248, -23, 85, -32768, -32768, 228, 248, -32768, -32768, 248,
 }
-var yyPgo = [...]int{
 
-	0, 52, 0, 3,
+var yyPgo = [...]int8{
+	0, 108, 0, 49, 3, 21,
 }
-var yyR1 = [...]int{
 
-	0, 1, 1, 1, 3, 3, 3, 2, 2, 2,
-	2, 2, 2, 2, 2, 2, 2, 2,
+var yyR1 = [...]int8{
+	0, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+	1, 1, 1, 1, 1, 1, 4, 4, 4, 4,
+	3, 3, 5, 5, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2,
 }
-var yyR2 = [...]int{
 
-	0, 4, 6, 1, 0, 1, 3, 1, 3, 3,
-	3, 3, 3, 4, 6, 3, 4, 1,
+var yyR2 = [...]int8{
+	0, 4, 6, 2, 4, 1, 1, 3, 1, 3,
+	1, 2, 4, 2, 3, 1, 0, 1, 1, 3,
+	1, 3, 3, 5, 1, 3, 3, 2, 3, 2,
+	2, 5, 3, 3, 3, 3, 3, 3, 3, 3,
+	4, 6, 3, 4, 6, 5, 5, 4, 1,
 }
-var yyChk = [...]int{
 
-	-1000, -1, 6, -2, 5, 9, 4, 4, 11, 12,
-	13, 14, 15, 16, -2, 9, 7, 8, -2, -2,
-	-2, -2, 4, -2, 10, -3, -2, -2, 4, 9,
-	17, 8, 10, 7, -3, -2, -2, 10,
+var yyChk = [...]int16{
+	-32768, -1, 6, 8, 4, 9, 10, 11, 14, 13,
+	-2, 5, 29, 31, 25, 20, 4, -2, 4, 4,
+	5, 29, 12, 12, -2, 18, 17, 16, 15, 7,
+	19, 20, 21, 22, 24, 25, -2, -5, 32, 4,
+	-3, 33, -2, -2, 7, 26, 27, -5, -4, -3,
+	-5, 4, -2, -2, 26, -2, -2, -2, -2, -2,
+	-2, -2, -2, -2, 4, -2, 28, 30, 26, 32,
+	28, 26, 33, -2, 4, -2, 30, 26, -2, 28,
+	29, 33, 28, -2, 33, 4, -2, -2, 7, -5,
+	-2, -4, -2, 33, 33, 28, -2, 30, 33, -2,
 }
-var yyDef = [...]int{
 
-	0, -2, 0, 3, 7, 0, 17, 0, 0, 0,
-	0, 0, 0, 0, 0, 4, 0, 0, 9, 10,
-	11, 12, 15, 0, 8, 0, 5, 1, 0, 4,
-	16, 0, 13, 0, 0, 6, 2, 14,
+var yyDef = [...]int8{
+	0, -2, 0, 0, 48, 5, 6, 8, 10, 0,
+	15, 24, 0, 0, 0, 0, 0, 3, 48, 0,
+	13, 16, 0, 0, 11, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 27, 0,
+	0, 29, 20, 30, 0, 0, 0, 14, 0, 17,
+	18, 48, 7, 9, 0, 0, 32, 33, 34, 35,
+	36, 37, 38, 39, 42, 0, 0, 25, 0, 26,
+	0, 0, 28, 1, 0, 4, 40, 0, 12, 0,
+	16, 43, 0, 0, 47, 0, 22, 21, 0, 19,
+	31, 0, 0, 46, 45, 0, 2, 41, 44, 23,
 }
-var yyTok1 = [...]int{
 
+var yyTok1 = [...]int8{
 	1, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	9, 10, 13, 11, 8, 12, 15, 14, 3, 3,
+	29, 30, 21, 19, 26, 20, 24, 22, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 28, 3,
+	3, 27, 3, 18, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 25, 3, 33, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 16, 3, 17,
+	3, 3, 3, 31, 3, 32,
 }
-var yyTok2 = [...]int{
 
-	2, 3, 4, 5, 6, 7,
+var yyTok2 = [...]int8{
+	2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
+	12, 13, 14, 15, 16, 17, 23,
 }
-var yyTok3 = [...]int{
+
+var yyTok3 = [...]int8{
 	0,
 }
 
@@ -165,7 +246,7 @@ func yyNewParser() yyParser {
 	return &yyParserImpl{}
 }
 
-const yyFlag = -1000
+const yyFlag = -32768
 
 func yyTokname(c int) string {
 	if c >= 1 && c-1 < len(yyToknames) {
@@ -204,9 +285,9 @@ func yyErrorMessage(state, lookAhead int) string {
 	expected := make([]int, 0, 4)
 
 	// Look for shiftable tokens.
-	base := yyPact[state]
+	base := int(yyPact[state])
 	for tok := TOKSTART; tok-1 < len(yyToknames); tok++ {
-		if n := base + tok; n >= 0 && n < yyLast && yyChk[yyAct[n]] == tok {
+		if n := base + tok; n >= 0 && n < yyLast && int(yyChk[int(yyAct[n])]) == tok {
 			if len(expected) == cap(expected) {
 				return res
 			}
@@ -216,13 +297,13 @@ func yyErrorMessage(state, lookAhead int) string {
 
 	if yyDef[state] == -2 {
 		i := 0
-		for yyExca[i] != -1 || yyExca[i+1] != state {
+		for yyExca[i] != -1 || int(yyExca[i+1]) != state {
 			i += 2
 		}
 
 		// Look for tokens that we accept or reduce.
 		for i += 2; yyExca[i] >= 0; i += 2 {
-			tok := yyExca[i]
+			tok := int(yyExca[i])
 			if tok < TOKSTART || yyExca[i+1] == 0 {
 				continue
 			}
@@ -253,30 +334,30 @@ func yylex1(lex yyLexer, lval *yySymType) (char, token int) {
 	token = 0
 	char = lex.Lex(lval)
 	if char <= 0 {
-		token = yyTok1[0]
+		token = int(yyTok1[0])
 		goto out
 	}
 	if char < len(yyTok1) {
-		token = yyTok1[char]
+		token = int(yyTok1[char])
 		goto out
 	}
 	if char >= yyPrivate {
 		if char < yyPrivate+len(yyTok2) {
-			token = yyTok2[char-yyPrivate]
+			token = int(yyTok2[char-yyPrivate])
 			goto out
 		}
 	}
 	for i := 0; i < len(yyTok3); i += 2 {
-		token = yyTok3[i+0]
+		token = int(yyTok3[i+0])
 		if token == char {
-			token = yyTok3[i+1]
+			token = int(yyTok3[i+1])
 			goto out
 		}
 	}
 
 out:
 	if token == 0 {
-		token = yyTok2[1] /* unknown char */
+		token = int(yyTok2[1]) /* unknown char */
 	}
 	if yyDebug >= 3 {
 		__yyfmt__.Printf("lex %s(%d)\n", yyTokname(token), uint(char))
@@ -331,7 +412,7 @@ yystack:
 	yyS[yyp].yys = yystate
 
 yynewstate:
-	yyn = yyPact[yystate]
+	yyn = int(yyPact[yystate])
 	if yyn <= yyFlag {
 		goto yydefault /* simple state */
 	}
@@ -342,8 +423,8 @@ yynewstate:
 	if yyn < 0 || yyn >= yyLast {
 		goto yydefault
 	}
-	yyn = yyAct[yyn]
-	if yyChk[yyn] == yytoken { /* valid shift */
+	yyn = int(yyAct[yyn])
+	if int(yyChk[yyn]) == yytoken { /* valid shift */
 		yyrcvr.char = -1
 		yytoken = -1
 		yyVAL = yyrcvr.lval
@@ -356,7 +437,7 @@ yynewstate:
 
 yydefault:
 	/* default state action */
-	yyn = yyDef[yystate]
+	yyn = int(yyDef[yystate])
 	if yyn == -2 {
 		if yyrcvr.char < 0 {
 			yyrcvr.char, yytoken = yylex1(yylex, &yyrcvr.lval)
@@ -365,18 +446,18 @@ yydefault:
 		/* look through exception table */
 		xi := 0
 		for {
-			if yyExca[xi+0] == -1 && yyExca[xi+1] == yystate {
+			if yyExca[xi+0] == -1 && int(yyExca[xi+1]) == yystate {
 				break
 			}
 			xi += 2
 		}
 		for xi += 2; ; xi += 2 {
-			yyn = yyExca[xi+0]
+			yyn = int(yyExca[xi+0])
 			if yyn < 0 || yyn == yytoken {
 				break
 			}
 		}
-		yyn = yyExca[xi+1]
+		yyn = int(yyExca[xi+1])
 		if yyn < 0 {
 			goto ret0
 		}
@@ -398,10 +479,10 @@ yydefault:
 
 			/* find a state where "error" is a legal shift action */
 			for yyp >= 0 {
-				yyn = yyPact[yyS[yyp].yys] + yyErrCode
+				yyn = int(yyPact[yyS[yyp].yys]) + yyErrCode
 				if yyn >= 0 && yyn < yyLast {
-					yystate = yyAct[yyn] /* simulate a shift of "error" */
-					if yyChk[yystate] == yyErrCode {
+					yystate = int(yyAct[yyn]) /* simulate a shift of "error" */
+					if int(yyChk[yystate]) == yyErrCode {
 						goto yystack
 					}
 				}
@@ -437,7 +518,7 @@ yydefault:
 	yypt := yyp
 	_ = yypt // guard against "declared and not used"
 
-	yyp -= yyR2[yyn]
+	yyp -= int(yyR2[yyn])
 	// yyp is now the index of $0. Perform the default action. Iff the
 	// reduced production is ε, $1 is possibly out of range.
 	if yyp+1 >= len(yyS) {
@@ -448,16 +529,16 @@ yydefault:
 	yyVAL = yyS[yyp+1]
 
 	/* consult goto table to find next state */
-	yyn = yyR1[yyn]
-	yyg := yyPgo[yyn]
+	yyn = int(yyR1[yyn])
+	yyg := int(yyPgo[yyn])
 	yyj := yyg + yyS[yyp].yys + 1
 
 	if yyj >= yyLast {
-		yystate = yyAct[yyg]
+		yystate = int(yyAct[yyg])
 	} else {
-		yystate = yyAct[yyj]
-		if yyChk[yystate] != -yyn {
-			yystate = yyAct[yyg]
+		yystate = int(yyAct[yyj])
+		if int(yyChk[yystate]) != -yyn {
+			yystate = int(yyAct[yyg])
 		}
 	}
 	// dummy call; replaced with literal code
@@ -465,103 +546,292 @@ yydefault:
 
 	case 1:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line parser.go.y:22
+//line parser.go.y:34
 		{
 			yylex.(*Lexer).e = &ForExpr{yyDollar[2].str, "", yyDollar[4].expr}
 		}
 	case 2:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line parser.go.y:26
+//line parser.go.y:38
 		{
 			yylex.(*Lexer).e = &ForExpr{yyDollar[2].str, yyDollar[4].str, yyDollar[6].expr}
 		}
 	case 3:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.go.y:42
+		{
+			yylex.(*Lexer).e = &DeadlineExpr{yyDollar[2].expr}
+		}
+	case 4:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line parser.go.y:46
+		{
+			yylex.(*Lexer).e = &DirectiveExpr{yyDollar[1].str, yyDollar[2].str, yyDollar[4].expr}
+		}
+	case 5:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.go.y:30
+//line parser.go.y:50
+		{
+			yylex.(*Lexer).e = &ElseExpr{}
+		}
+	case 6:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.go.y:54
+		{
+			yylex.(*Lexer).e = &BreakExpr{}
+		}
+	case 7:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:58
+		{
+			yylex.(*Lexer).e = &BreakExpr{yyDollar[3].expr}
+		}
+	case 8:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.go.y:62
+		{
+			yylex.(*Lexer).e = &ContinueExpr{}
+		}
+	case 9:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:66
+		{
+			yylex.(*Lexer).e = &ContinueExpr{yyDollar[3].expr}
+		}
+	case 10:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.go.y:70
+		{
+			yylex.(*Lexer).e = &FlushExpr{}
+		}
+	case 11:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.go.y:74
+		{
+			yylex.(*Lexer).e = &AssertExpr{yyDollar[2].expr, nil}
+		}
+	case 12:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line parser.go.y:78
+		{
+			yylex.(*Lexer).e = &AssertExpr{yyDollar[2].expr, yyDollar[4].expr}
+		}
+	case 13:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.go.y:82
+		{
+			yylex.(*Lexer).e = &CallExpr{yyDollar[1].str, []Expr{&LitExpr{yyDollar[2].lit}}}
+		}
+	case 14:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:86
+		{
+			yylex.(*Lexer).e = &CallExpr{yyDollar[1].str, []Expr{&LitExpr{yyDollar[2].lit}, yyDollar[3].expr}}
+		}
+	case 15:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.go.y:90
 		{
 			yylex.(*Lexer).e = yyDollar[1].expr
 		}
-	case 4:
+	case 16:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line parser.go.y:36
+//line parser.go.y:96
 		{
 			yyVAL.exprs = nil
 		}
-	case 5:
+	case 17:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.go.y:100
+		{
+			yyVAL.exprs = yyDollar[1].exprs
+		}
+	case 18:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.go.y:40
+//line parser.go.y:104
 		{
 			yyVAL.exprs = []Expr{yyDollar[1].expr}
 		}
-	case 6:
+	case 19:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:44
+//line parser.go.y:108
 		{
 			yyVAL.exprs = append(yyDollar[1].exprs, yyDollar[3].expr)
 		}
-	case 7:
+	case 20:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.go.y:50
+//line parser.go.y:114
+		{
+			yyVAL.exprs = []Expr{yyDollar[1].expr}
+		}
+	case 21:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:118
+		{
+			yyVAL.exprs = append(yyDollar[1].exprs, yyDollar[3].expr)
+		}
+	case 22:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:124
+		{
+			yyVAL.expr = &MapExpr{Keys: []string{yyDollar[1].str}, Values: []Expr{yyDollar[3].expr}}
+		}
+	case 23:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line parser.go.y:128
+		{
+			m := yyDollar[1].expr.(*MapExpr)
+			m.Keys = append(m.Keys, yyDollar[3].str)
+			m.Values = append(m.Values, yyDollar[5].expr)
+			yyVAL.expr = m
+		}
+	case 24:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.go.y:137
 		{
 			yyVAL.expr = &LitExpr{yyDollar[1].lit}
 		}
-	case 8:
+	case 25:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:54
+//line parser.go.y:141
 		{
 			yyVAL.expr = yyDollar[2].expr
 		}
-	case 9:
+	case 26:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:58
+//line parser.go.y:145
+		{
+			yyVAL.expr = yyDollar[2].expr
+		}
+	case 27:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.go.y:149
+		{
+			yyVAL.expr = &MapExpr{}
+		}
+	case 28:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:153
+		{
+			yyVAL.expr = &ArrayExpr{yyDollar[2].exprs}
+		}
+	case 29:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.go.y:157
+		{
+			yyVAL.expr = &ArrayExpr{}
+		}
+	case 30:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.go.y:161
+		{
+			yyVAL.expr = &UnaryExpr{"-", yyDollar[2].expr}
+		}
+	case 31:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line parser.go.y:165
+		{
+			yyVAL.expr = &CondExpr{yyDollar[1].expr, yyDollar[3].expr, yyDollar[5].expr}
+		}
+	case 32:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:169
+		{
+			yyVAL.expr = &BinOpExpr{"||", yyDollar[1].expr, yyDollar[3].expr}
+		}
+	case 33:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:173
+		{
+			yyVAL.expr = &BinOpExpr{"&&", yyDollar[1].expr, yyDollar[3].expr}
+		}
+	case 34:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:177
+		{
+			yyVAL.expr = &BinOpExpr{"??", yyDollar[1].expr, yyDollar[3].expr}
+		}
+	case 35:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:181
+		{
+			yyVAL.expr = &BinOpExpr{"in", yyDollar[1].expr, yyDollar[3].expr}
+		}
+	case 36:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:185
 		{
 			yyVAL.expr = &BinOpExpr{"+", yyDollar[1].expr, yyDollar[3].expr}
 		}
-	case 10:
+	case 37:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:62
+//line parser.go.y:189
 		{
 			yyVAL.expr = &BinOpExpr{"-", yyDollar[1].expr, yyDollar[3].expr}
 		}
-	case 11:
+	case 38:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:66
+//line parser.go.y:193
 		{
 			yyVAL.expr = &BinOpExpr{"*", yyDollar[1].expr, yyDollar[3].expr}
 		}
-	case 12:
+	case 39:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:70
+//line parser.go.y:197
 		{
 			yyVAL.expr = &BinOpExpr{"/", yyDollar[1].expr, yyDollar[3].expr}
 		}
-	case 13:
+	case 40:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line parser.go.y:74
+//line parser.go.y:201
 		{
 			yyVAL.expr = &CallExpr{yyDollar[1].str, yyDollar[3].exprs}
 		}
-	case 14:
+	case 41:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line parser.go.y:78
+//line parser.go.y:205
 		{
 			yyVAL.expr = &MethodCallExpr{LHS: yyDollar[1].expr, Name: yyDollar[3].str, Exprs: yyDollar[5].exprs}
 		}
-	case 15:
+	case 42:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:82
+//line parser.go.y:209
 		{
 			yyVAL.expr = &MemberExpr{LHS: yyDollar[1].expr, Name: yyDollar[3].str}
 		}
-	case 16:
+	case 43:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line parser.go.y:86
+//line parser.go.y:213
 		{
 			yyVAL.expr = &ItemExpr{LHS: yyDollar[1].expr, Index: yyDollar[3].expr}
 		}
-	case 17:
+	case 44:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line parser.go.y:217
+		{
+			yyVAL.expr = &SliceExpr{LHS: yyDollar[1].expr, Low: yyDollar[3].expr, High: yyDollar[5].expr}
+		}
+	case 45:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line parser.go.y:221
+		{
+			yyVAL.expr = &SliceExpr{LHS: yyDollar[1].expr, High: yyDollar[4].expr}
+		}
+	case 46:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line parser.go.y:225
+		{
+			yyVAL.expr = &SliceExpr{LHS: yyDollar[1].expr, Low: yyDollar[3].expr}
+		}
+	case 47:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line parser.go.y:229
+		{
+			yyVAL.expr = &SliceExpr{LHS: yyDollar[1].expr}
+		}
+	case 48:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.go.y:90
+//line parser.go.y:233
 		{
 			yyVAL.expr = &IdentExpr{yyDollar[1].str}
 		}
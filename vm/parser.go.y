@@ -13,8 +13,20 @@ package vm
 %type<expr> stmt
 %type<expr> expr
 %type<exprs> exprs
+%type<exprs> args
+%type<expr> kwargs
 %token<str> ident
-%token<lit> lit cfor in
+%token<lit> lit cfor in cdeadline celse cbreak ccontinue cif cassert cflush coalesce and or
+
+%right '?'
+%left or
+%left and
+%left coalesce
+%left in
+%left '+' '-'
+%left '*' '/'
+%right UNARY
+%left '.' '['
 
 %%
 
@@ -26,17 +38,79 @@ stmt :  cfor ident in expr
      {
        yylex.(*Lexer).e = &ForExpr{$2, $4, $6}
      }
+     | cdeadline expr
+     {
+       yylex.(*Lexer).e = &DeadlineExpr{$2}
+     }
+     | ident ident '=' expr
+     {
+       yylex.(*Lexer).e = &DirectiveExpr{$1, $2, $4}
+     }
+     | celse
+     {
+       yylex.(*Lexer).e = &ElseExpr{}
+     }
+     | cbreak
+     {
+       yylex.(*Lexer).e = &BreakExpr{}
+     }
+     | cbreak cif expr
+     {
+       yylex.(*Lexer).e = &BreakExpr{$3}
+     }
+     | ccontinue
+     {
+       yylex.(*Lexer).e = &ContinueExpr{}
+     }
+     | ccontinue cif expr
+     {
+       yylex.(*Lexer).e = &ContinueExpr{$3}
+     }
+     | cflush
+     {
+       yylex.(*Lexer).e = &FlushExpr{}
+     }
+     | cassert expr
+     {
+       yylex.(*Lexer).e = &AssertExpr{$2, nil}
+     }
+     | cassert expr ',' expr
+     {
+       yylex.(*Lexer).e = &AssertExpr{$2, $4}
+     }
+     | ident lit
+     {
+       yylex.(*Lexer).e = &CallExpr{$1, []Expr{&LitExpr{$2}}}
+     }
+     | ident lit kwargs
+     {
+       yylex.(*Lexer).e = &CallExpr{$1, []Expr{&LitExpr{$2}, $3}}
+     }
      | expr
      {
        yylex.(*Lexer).e = $1
      }
      ;
 
-exprs :
-      {
-          $$ = nil
-      }
-      | expr 
+args :
+     {
+       $$ = nil
+     }
+     | exprs
+     {
+       $$ = $1
+     }
+     | kwargs
+     {
+       $$ = []Expr{$1}
+     }
+     | exprs ',' kwargs
+     {
+       $$ = append($1, $3)
+     }
+     ;
+
+exprs : expr
       {
           $$ = []Expr{$1}
       }
@@ -46,6 +120,19 @@ exprs :
       }
       ;
 
+kwargs : ident ':' expr
+       {
+         $$ = &MapExpr{Keys: []string{$1}, Values: []Expr{$3}}
+       }
+       | kwargs ',' ident ':' expr
+       {
+         m := $1.(*MapExpr)
+         m.Keys = append(m.Keys, $3)
+         m.Values = append(m.Values, $5)
+         $$ = m
+       }
+       ;
+
 expr : lit
      {
        $$ = &LitExpr{$1}
@@ -54,6 +141,46 @@ expr : lit
      {
        $$ = $2
      }
+     | '{' kwargs '}'
+     {
+       $$ = $2
+     }
+     | '{' '}'
+     {
+       $$ = &MapExpr{}
+     }
+     | '[' exprs ']'
+     {
+       $$ = &ArrayExpr{$2}
+     }
+     | '[' ']'
+     {
+       $$ = &ArrayExpr{}
+     }
+     | '-' expr %prec UNARY
+     {
+       $$ = &UnaryExpr{"-", $2}
+     }
+     | expr '?' expr ':' expr %prec '?'
+     {
+       $$ = &CondExpr{$1, $3, $5}
+     }
+     | expr or expr
+     {
+       $$ = &BinOpExpr{"||", $1, $3}
+     }
+     | expr and expr
+     {
+       $$ = &BinOpExpr{"&&", $1, $3}
+     }
+     | expr coalesce expr
+     {
+       $$ = &BinOpExpr{"??", $1, $3}
+     }
+     | expr in expr
+     {
+       $$ = &BinOpExpr{"in", $1, $3}
+     }
      | expr '+' expr
      {
        $$ = &BinOpExpr{"+", $1, $3}
@@ -70,11 +197,11 @@ expr : lit
      {
        $$ = &BinOpExpr{"/", $1, $3}
      }
-     | ident '(' exprs ')'
+     | ident '(' args ')'
      {
        $$ = &CallExpr{$1, $3}
      }
-     | expr '.' ident '(' exprs ')'
+     | expr '.' ident '(' args ')'
      {
        $$ = &MethodCallExpr{LHS: $1, Name: $3, Exprs: $5}
      }
@@ -86,6 +213,22 @@ expr : lit
      {
        $$ = &ItemExpr{LHS: $1, Index: $3}
      }
+     | expr '[' expr ':' expr ']'
+     {
+       $$ = &SliceExpr{LHS: $1, Low: $3, High: $5}
+     }
+     | expr '[' ':' expr ']'
+     {
+       $$ = &SliceExpr{LHS: $1, High: $4}
+     }
+     | expr '[' expr ':' ']'
+     {
+       $$ = &SliceExpr{LHS: $1, Low: $3}
+     }
+     | expr '[' ':' ']'
+     {
+       $$ = &SliceExpr{LHS: $1}
+     }
      | ident
      {
        $$ = &IdentExpr{$1}
@@ -0,0 +1,44 @@
+package vm
+
+import "time"
+
+// DefaultTimeLayout is the layout of time.Time printed in the templates by
+// default.
+const DefaultTimeLayout = time.RFC3339
+
+// SetTimeLayout set the layout of time.Time printed in the templates. The
+// empty layout is DefaultTimeLayout.
+func (v *VM) SetTimeLayout(layout string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.timeLayout = layout
+}
+
+// TimeLayout returns the layout of time.Time printed in the templates.
+func (v *VM) TimeLayout() string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.timeLayout == "" {
+		return DefaultTimeLayout
+	}
+	return v.timeLayout
+}
+
+// ValuePrinter convert the evaluated value to the text of the output, like
+// formatting the numbers and the dates for the locale.
+type ValuePrinter func(value interface{}) (string, error)
+
+// SetValuePrinter set the printer of the values. The values except nil and
+// the trusted strings are converted by it instead of the default rules.
+func (v *VM) SetValuePrinter(p ValuePrinter) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.printer = p
+}
+
+// ValuePrinter returns the printer set by SetValuePrinter.
+func (v *VM) ValuePrinter() ValuePrinter {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.printer
+}
@@ -0,0 +1,60 @@
+package vm
+
+import (
+	"context"
+	"reflect"
+)
+
+// Member is the member of the struct or the map which is accessed.
+type Member struct {
+	// Path is the path of the member like "user.email". It is empty if the
+	// receiver is not the path like the result of the function.
+	Path string
+	// Name is the name of the field or the key.
+	Name string
+	// Owner is the type of the struct or the map.
+	Owner reflect.Type
+	// Tag is the tag of the field. It is empty for the maps.
+	Tag reflect.StructTag
+}
+
+// Redactor is the hook called on every access to the members of structs
+// and maps. It returns the value to use instead of value, like the masked
+// email. ctx is the context of the execution, so the value can be redacted
+// based on the role of the user.
+type Redactor func(ctx context.Context, m *Member, value interface{}) (interface{}, error)
+
+// SetRedactor set the redactor.
+func (v *VM) SetRedactor(r Redactor) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.redactor = r
+}
+
+func (v *VM) getRedactor() Redactor {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.redactor
+}
+
+// member pass the value of the member accessed by expr to the redactor, and
+// record the access.
+func (v *VM) member(ctx context.Context, expr Expr, owner reflect.Type, name string, value interface{}) (interface{}, error) {
+	if r := v.getRedactor(); r != nil {
+		m := &Member{Name: name, Owner: owner}
+		if root, rest, ok := splitPath(expr); ok {
+			m.Path = root + rest
+		}
+		if owner.Kind() == reflect.Struct {
+			if index := v.fieldIndex(owner, name); index != nil {
+				m.Tag = owner.FieldByIndex(index).Tag
+			}
+		}
+		var err error
+		value, err = r(ctx, m, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return v.accessed(expr, value)
+}
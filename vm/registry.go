@@ -0,0 +1,71 @@
+package vm
+
+import (
+	"strings"
+	"sync"
+)
+
+// Namespace is a collection of functions called with the dotted name like
+// str.upcase(x). Namespaces can be nested.
+type Namespace map[string]interface{}
+
+// setValue set value with name into m. If the name is dotted, the value is
+// set into the namespace. Namespaces are copied on write, so the namespaces
+// already referenced are not modified.
+func setValue(m map[string]interface{}, name string, value interface{}) {
+	pos := strings.IndexByte(name, '.')
+	if pos < 0 {
+		m[name] = value
+		return
+	}
+	ns := Namespace{}
+	if old, ok := m[name[:pos]].(Namespace); ok {
+		for key, val := range old {
+			ns[key] = val
+		}
+	}
+	setValue(ns, name[pos+1:], value)
+	m[name[:pos]] = ns
+}
+
+// Registry is a collection of global values like helper functions. It is
+// safe for concurrent use by multiple goroutines.
+type Registry struct {
+	mu     sync.RWMutex
+	values map[string]interface{}
+}
+
+// NewRegistry create the registry.
+func NewRegistry() *Registry {
+	return &Registry{values: make(map[string]interface{})}
+}
+
+// Default is the registry which new VMs inherit.
+var Default = NewRegistry()
+
+// Register register value with name. If the name is dotted like
+// "str.upcase", the value is registered into the namespace.
+func (r *Registry) Register(name string, value interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	setValue(r.values, name, value)
+}
+
+// Lookup returns the value registered with name.
+func (r *Registry) Lookup(name string) (interface{}, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	value, ok := r.values[name]
+	return value, ok
+}
+
+// Values returns a copy of the registered values.
+func (r *Registry) Values() map[string]interface{} {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	values := make(map[string]interface{}, len(r.values))
+	for name, value := range r.values {
+		values[name] = value
+	}
+	return values
+}
@@ -0,0 +1,73 @@
+package vm
+
+import (
+	"reflect"
+	"strings"
+)
+
+// defaultFieldTags is the struct tags which the fields are looked up with by
+// default.
+var defaultFieldTags = []string{"slim", "json"}
+
+// SetFieldTags set the struct tags to look up the fields, like `slim:"name"`.
+// The field which has the name is used first, and then the field tagged with
+// the name in the order of tags. The default is "slim" and "json", so the
+// templates can use the same names as the API payloads. No tags disable the
+// lookup.
+func (v *VM) SetFieldTags(tags ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.tags = tags
+}
+
+// FieldTags returns the struct tags set by SetFieldTags.
+func (v *VM) FieldTags() []string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.tags
+}
+
+// fieldIndex returns the index of the exported field of rt referenced by
+// name, or nil if it is not found. The index is cached per type and tags.
+func (v *VM) fieldIndex(rt reflect.Type, name string) []int {
+	tags := v.FieldTags()
+	c := v.cache
+	key := lookupKey{typ: rt, name: name, tags: strings.Join(tags, ",")}
+	c.mu.RLock()
+	index, ok := c.fields[key]
+	c.mu.RUnlock()
+	if ok {
+		return index
+	}
+	if sf, found := rt.FieldByName(name); found && sf.IsExported() {
+		index = sf.Index
+	} else {
+		index = tagIndex(rt, name, tags)
+	}
+	c.mu.Lock()
+	c.fields[key] = index
+	c.mu.Unlock()
+	return index
+}
+
+// tagIndex returns the index of the exported field of rt tagged with name.
+func tagIndex(rt reflect.Type, name string, tags []string) []int {
+	for _, tag := range tags {
+		for _, sf := range reflect.VisibleFields(rt) {
+			if !sf.IsExported() {
+				continue
+			}
+			s, ok := sf.Tag.Lookup(tag)
+			if !ok {
+				continue
+			}
+			if i := strings.IndexByte(s, ','); i >= 0 {
+				s = s[:i]
+			}
+			if s == name && s != "-" {
+				return sf.Index
+			}
+		}
+	}
+	return nil
+}
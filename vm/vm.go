@@ -1,31 +1,448 @@
 package vm
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"text/scanner"
+	"time"
 )
 
 // VM is a vertual machine.
+//
+// A VM is safe for concurrent use by multiple goroutines. To render a
+// template from many goroutines, create a VM per render with Clone, which
+// shares the caches of lookups and compiled expressions.
 type VM struct {
-	env map[string]interface{}
+	mu         sync.RWMutex
+	env        map[string]interface{}
+	ctx        context.Context
+	cache      *cache
+	limits     Limits
+	start      time.Time
+	evals      int64
+	iterations int64
+	sandbox    *sandbox
+	backend    Backend
+	null       bool
+	exposure   *exposure
+	audit      *Audit
+	redactor   Redactor
+	tags       []string
+	getters    bool
+	timeLayout string
+	printer    ValuePrinter
 }
 
-// New create the VM.
+// sandbox is a whitelist of types which methods can be called on.
+type sandbox struct {
+	mu    sync.RWMutex
+	types map[reflect.Type][]string
+}
+
+// Limits is a type for indicating the budget of the execution. Zero value
+// means unlimited.
+type Limits struct {
+	MaxEvals      int
+	MaxIterations int
+	Timeout       time.Duration
+
+	// MaxLoopItems is the limit of the iterations of each loop, while
+	// MaxIterations is the total of the loops.
+	MaxLoopItems int
+}
+
+// LimitError is the error returned when the execution exceed the limits.
+type LimitError struct {
+	Limit string
+}
+
+func (e *LimitError) Error() string {
+	return "exceeded the limit of " + e.Limit
+}
+
+// LoopLimitError is the error returned when a loop exceed MaxLoopItems.
+type LoopLimitError struct {
+	Limit int
+}
+
+func (e *LoopLimitError) Error() string {
+	return fmt.Sprintf("loop exceeded the limit of %d items", e.Limit)
+}
+
+// loopChunk is the number of the iterations of a loop between the yields to
+// the scheduler.
+const loopChunk = 1024
+
+// lookupKey is a key for caching resolved fields and methods.
+type lookupKey struct {
+	typ  reflect.Type
+	name string
+	tags string
+}
+
+// cache is shared between the VM and the clones of it.
+type cache struct {
+	mu      sync.RWMutex
+	fields  map[lookupKey][]int
+	methods map[lookupKey]int
+	exprs   map[string]Expr
+	stmts   map[string]Expr
+}
+
+func newCache() *cache {
+	return &cache{
+		fields:  make(map[lookupKey][]int),
+		methods: make(map[lookupKey]int),
+		exprs:   make(map[string]Expr),
+		stmts:   make(map[string]Expr),
+	}
+}
+
+// New create the VM. The VM has values registered in Default.
 func New() *VM {
-	return &VM{make(map[string]interface{})}
+	return &VM{
+		env:   Default.Values(),
+		cache: newCache(),
+		tags:  defaultFieldTags,
+	}
+}
+
+// Clone create a copy of the VM. Values set to the copy doesn't affect to
+// the original. Caches are shared with the original.
+func (v *VM) Clone() *VM {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	env := make(map[string]interface{}, len(v.env))
+	for key, val := range v.env {
+		env[key] = val
+	}
+	return &VM{
+		env:        env,
+		ctx:        v.ctx,
+		cache:      v.cache,
+		limits:     v.limits,
+		start:      time.Now(),
+		sandbox:    v.sandbox,
+		backend:    v.backend,
+		null:       v.null,
+		exposure:   v.exposure,
+		audit:      v.audit,
+		redactor:   v.redactor,
+		tags:       v.tags,
+		getters:    v.getters,
+		timeLayout: v.timeLayout,
+		printer:    v.printer,
+	}
+}
+
+// NullValue is the value of failed access in the null-object mode. Any
+// access to NullValue results NullValue, and it is printed as empty.
+type NullValue struct{}
+
+// String returns empty string.
+func (NullValue) String() string {
+	return ""
+}
+
+// Null is the value of NullValue.
+var Null = NullValue{}
+
+// SetNullObject set the null-object mode. In the mode, access to missing
+// members, items and methods, or access through nil, results Null instead of
+// the error, like the forgiving templates for the content authors.
+func (v *VM) SetNullObject(on bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.null = on
+}
+
+// NullObject returns true if the VM is in the null-object mode.
+func (v *VM) NullObject() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.null
+}
+
+// missing returns Null in the null-object mode. Otherwise err is returned.
+func (v *VM) missing(err error) (interface{}, error) {
+	if v.NullObject() {
+		return Null, nil
+	}
+	return nil, &missingError{err}
+}
+
+// missingError is the error of the value which does not exist. The left
+// side of "??" falls back to the right side on it.
+type missingError struct {
+	error
+}
+
+func (e *missingError) Unwrap() error {
+	return e.error
 }
 
-// Set set value with name.
+// coalesce returns the value of lhs, or the value of rhs if lhs is nil,
+// Null or missing.
+func (v *VM) coalesce(ctx context.Context, lhs, rhs Expr) (interface{}, error) {
+	val, err := v.eval(ctx, lhs)
+	if err != nil {
+		var me *missingError
+		if !errors.As(err, &me) {
+			return nil, err
+		}
+	} else if _, null := val.(NullValue); !null && val != nil && !isNil(reflect.ValueOf(val)) {
+		return val, nil
+	}
+	return v.eval(ctx, rhs)
+}
+
+// logical returns the value of lhs of "lhs && rhs" if it is falsy, or the
+// value of "lhs || rhs" if it is truthy. Otherwise it returns the value of
+// rhs. rhs is not evaluated if it is not needed.
+func (v *VM) logical(ctx context.Context, op string, lhs, rhs Expr) (interface{}, error) {
+	val, err := v.eval(ctx, lhs)
+	if err != nil {
+		return nil, err
+	}
+	if Truthy(val) == (op == "||") {
+		return val, nil
+	}
+	return v.eval(ctx, rhs)
+}
+
+// lener is the type which has the length like the ordered map.
+type lener interface {
+	Len() int
+}
+
+// Truthy returns false for nil, Null, false, zero numbers, and empty strings
+// or collections, like Ruby and Jinja. The pointers which have Len() like the
+// ordered map are falsy if they are empty. Otherwise true. The conditions and
+// the logical operators are evaluated with it.
+func Truthy(x interface{}) bool {
+	if x == nil {
+		return false
+	}
+	if _, ok := x.(NullValue); ok {
+		return false
+	}
+	rv := reflect.ValueOf(x)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.String, reflect.Array, reflect.Slice, reflect.Map, reflect.Chan:
+		return rv.Len() > 0
+	case reflect.Ptr, reflect.Interface, reflect.Func:
+		if rv.IsNil() {
+			return false
+		}
+		if l, ok := x.(lener); ok {
+			return l.Len() > 0
+		}
+		return true
+	case reflect.Struct:
+		return true
+	}
+	return !rv.IsZero()
+}
+
+// Restrict enable the sandboxed mode. In the mode, methods can be called
+// only on the types allowed by Allow. The clones of the VM share the
+// whitelist.
+func (v *VM) Restrict() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.sandbox == nil {
+		v.sandbox = &sandbox{types: make(map[reflect.Type][]string)}
+	}
+}
+
+// Allow allow calling methods on the type of value in the sandboxed mode.
+// If methods are given, only those can be called. Otherwise, all methods
+// which return values can be called. Methods which return nothing are
+// considered to have side effects.
+func (v *VM) Allow(value interface{}, methods ...string) {
+	v.Restrict()
+	rt := reflect.TypeOf(value)
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	sb := v.getSandbox()
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	sb.types[rt] = methods
+}
+
+func (v *VM) getSandbox() *sandbox {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.sandbox
+}
+
+// checkMethod returns error if calling the method is not allowed.
+func (v *VM) checkMethod(rt reflect.Type, name string, meth reflect.Value) error {
+	sb := v.getSandbox()
+	if sb == nil {
+		return nil
+	}
+	sb.mu.RLock()
+	methods, ok := sb.types[rt]
+	sb.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("cannot call method on %v: not allowed", rt)
+	}
+	if len(methods) > 0 {
+		for _, m := range methods {
+			if m == name {
+				return nil
+			}
+		}
+		return fmt.Errorf("cannot call method %s on %v: not allowed", name, rt)
+	}
+	if meth.Type().NumOut() == 0 {
+		return fmt.Errorf("cannot call method %s on %v: may have side effects", name, rt)
+	}
+	return nil
+}
+
+// CheckMethodCall returns error if the method name of value can't be called
+// with Restrict and RestrictData, like the method calls in the expressions.
+// Use it before calling the methods implicitly like String of fmt.Stringer.
+func (v *VM) CheckMethodCall(value interface{}, name string) error {
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() {
+		return fmt.Errorf("cannot reference method: %s", name)
+	}
+	meth := rv.MethodByName(name)
+	if !meth.IsValid() {
+		return fmt.Errorf("cannot reference method: %s", name)
+	}
+	rt := rv.Type()
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	if err := v.checkType(rt); err != nil {
+		return err
+	}
+	return v.checkMethod(rt, name, meth)
+}
+
+// SetLimits set the budget of the execution. Counters of the budget are
+// reset, and the clones of the VM have their own counters.
+func (v *VM) SetLimits(l Limits) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.limits = l
+	v.start = time.Now()
+	atomic.StoreInt64(&v.evals, 0)
+	atomic.StoreInt64(&v.iterations, 0)
+}
+
+func (v *VM) getLimits() (Limits, time.Time) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.limits, v.start
+}
+
+// step count an evaluation and check the limits.
+func (v *VM) step() error {
+	l, start := v.getLimits()
+	if l.MaxEvals > 0 && atomic.AddInt64(&v.evals, 1) > int64(l.MaxEvals) {
+		return &LimitError{"evaluations"}
+	}
+	if l.Timeout > 0 && time.Since(start) > l.Timeout {
+		return &LimitError{"timeout"}
+	}
+	return nil
+}
+
+// Iterate count an iteration of loops. It returns LimitError when the count
+// exceed the limits.
+func (v *VM) Iterate() error {
+	l, start := v.getLimits()
+	if l.MaxIterations > 0 && atomic.AddInt64(&v.iterations, 1) > int64(l.MaxIterations) {
+		return &LimitError{"iterations"}
+	}
+	if l.Timeout > 0 && time.Since(start) > l.Timeout {
+		return &LimitError{"timeout"}
+	}
+	return nil
+}
+
+// IterateLoop count the n-th iteration of a loop like Iterate. It returns
+// LoopLimitError when n exceed MaxLoopItems. Every chunk of the iterations,
+// it yields to the other goroutines and checks the context, so the large
+// loop doesn't occupy the process.
+func (v *VM) IterateLoop(n int) error {
+	if err := v.Iterate(); err != nil {
+		return err
+	}
+	if l, _ := v.getLimits(); l.MaxLoopItems > 0 && n > l.MaxLoopItems {
+		return &LoopLimitError{l.MaxLoopItems}
+	}
+	if n%loopChunk == 0 {
+		runtime.Gosched()
+		return v.Context().Err()
+	}
+	return nil
+}
+
+// ClearCache clear cached indices of fields and methods, and compiled
+// expressions.
+func (v *VM) ClearCache() {
+	c := v.cache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fields = make(map[lookupKey][]int)
+	c.methods = make(map[lookupKey]int)
+	c.exprs = make(map[string]Expr)
+	c.stmts = make(map[string]Expr)
+}
+
+// Set set value with name. If the name is dotted like "str.upcase", the
+// value is set into the namespace.
 func (v *VM) Set(n string, vv interface{}) {
-	v.env[n] = vv
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	setValue(v.env, n, vv)
+}
+
+// Unset remove the value named with name.
+func (v *VM) Unset(n string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.env, n)
+}
+
+// SetContext set the context used by Eval.
+func (v *VM) SetContext(ctx context.Context) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.ctx = ctx
+}
+
+// Context returns the context used by Eval. If it is not set, returns
+// context.Background().
+func (v *VM) Context() context.Context {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.ctx == nil {
+		return context.Background()
+	}
+	return v.ctx
 }
 
 // Get get value named with name.
 func (v *VM) Get(n string) (interface{}, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
 	val, ok := v.env[n]
 	return val, ok
 }
@@ -46,8 +463,273 @@ loop:
 	return rv, nil
 }
 
-func (v *VM) evalAndDerefRv(expr Expr) (reflect.Value, error) {
-	vv, err := v.Eval(expr)
+// fieldByName is same as reflect.Value.FieldByName but the field tagged with
+// name is used too. See SetFieldTags. If the field is promoted through the
+// nil embedded pointer, the path of the pointer is returned.
+func (v *VM) fieldByName(rv reflect.Value, name string) (reflect.Value, string) {
+	index := v.fieldIndex(rv.Type(), name)
+	if index == nil {
+		return reflect.Value{}, ""
+	}
+	fv, err := rv.FieldByIndexErr(index)
+	if err != nil {
+		return reflect.Value{}, nilField(rv, index)
+	}
+	return fv, ""
+}
+
+// methodByName is same as reflect.Value.MethodByName but cache the index of
+// the method per type.
+func (v *VM) methodByName(rv reflect.Value, name string) reflect.Value {
+	c := v.cache
+	key := lookupKey{typ: rv.Type(), name: name}
+	c.mu.RLock()
+	index, ok := c.methods[key]
+	c.mu.RUnlock()
+	if !ok {
+		index = -1
+		if m, found := rv.Type().MethodByName(name); found {
+			index = m.Index
+		}
+		c.mu.Lock()
+		c.methods[key] = index
+		c.mu.Unlock()
+	}
+	if index < 0 {
+		return reflect.Value{}
+	}
+	return rv.Method(index)
+}
+
+// mapKey convert key to the type of the map key.
+func mapKey(key interface{}, kt reflect.Type) (reflect.Value, error) {
+	rk := reflect.ValueOf(key)
+	if !rk.IsValid() {
+		return reflect.Value{}, errors.New("cannot reference item with nil")
+	}
+	if rk.Type().AssignableTo(kt) {
+		return rk, nil
+	}
+	switch kt.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(fmt.Sprint(key)).Convert(kt), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if s, ok := key.(string); ok {
+			i, err := strconv.ParseInt(s, 10, kt.Bits())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			return reflect.ValueOf(i).Convert(kt), nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if s, ok := key.(string); ok {
+			u, err := strconv.ParseUint(s, 10, kt.Bits())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			return reflect.ValueOf(u).Convert(kt), nil
+		}
+	}
+	if rk.Type().ConvertibleTo(kt) && rk.Kind() != reflect.String {
+		ck := rk.Convert(kt)
+		if !sameNumber(rk, ck) {
+			return reflect.Value{}, fmt.Errorf("cannot use %v as key of %v: out of range or not integer", key, kt)
+		}
+		return ck, nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot use %v as key of %v", rk.Type(), kt)
+}
+
+// sameNumber returns false if ck which is converted from rk to the integer
+// loses the value like 1.9 to 1 or 300 to 44 of int8.
+func sameNumber(rk, ck reflect.Value) bool {
+	switch ck.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+	default:
+		return true
+	}
+	f, ok := number(rk)
+	if !ok {
+		return true
+	}
+	g, _ := number(ck)
+	return ck.Convert(rk.Type()).Interface() == rk.Interface() && (f < 0) == (g < 0)
+}
+
+// contains returns true if item is in container. The substring is in the
+// string, the key is in the map, and the element is in the slice or the
+// array. Nothing is in nil.
+func contains(container, item interface{}) (bool, error) {
+	if container == nil {
+		return false, nil
+	}
+	if _, ok := container.(NullValue); ok {
+		return false, nil
+	}
+	rv := reflect.ValueOf(container)
+	switch rv.Kind() {
+	case reflect.String:
+		return strings.Contains(rv.String(), fmt.Sprint(item)), nil
+	case reflect.Map:
+		if rv.IsNil() {
+			return false, nil
+		}
+		rk, err := mapKey(item, rv.Type().Key())
+		if err != nil {
+			return false, nil
+		}
+		return rv.MapIndex(rk).IsValid(), nil
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if equal(rv.Index(i).Interface(), item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("cannot use in with %T", container)
+}
+
+// equal returns true if a and b are the same value. The numbers are compared
+// as the values, because the integer literals are int64.
+func equal(a, b interface{}) bool {
+	ra, rb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if ra.IsValid() && rb.IsValid() {
+		if fa, ok := number(ra); ok {
+			fb, ok := number(rb)
+			return ok && fa == fb
+		}
+		if ra.Kind() == reflect.String && rb.Kind() == reflect.String {
+			return ra.String() == rb.String()
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// number returns rv as float64 if it is the number.
+func number(rv reflect.Value) (float64, bool) {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// mapIndex returns the value of key in the map rv. The keys of
+// map[interface{}]interface{} like the data decoded from YAML are compared
+// as the values, so the integer literals match the int keys. If key is not
+// found, the string key which is equal under the case folding is used, so
+// the data decoded from YAML and JSON can be accessed like user.Name. The
+// returned value is invalid if nothing matches.
+func mapIndex(rv reflect.Value, key interface{}) (reflect.Value, error) {
+	kt := rv.Type().Key()
+	rk, err := mapKey(key, kt)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if mv := rv.MapIndex(rk); mv.IsValid() {
+		return mv, nil
+	}
+	s, isString := key.(string)
+	if kt.Kind() != reflect.Interface && !(isString && kt.Kind() == reflect.String) {
+		return reflect.Value{}, nil
+	}
+	var found reflect.Value
+	var foundKey string
+	iter := rv.MapRange()
+	for iter.Next() {
+		k := iter.Key()
+		if k.Kind() == reflect.Interface {
+			k = k.Elem()
+		}
+		if kt.Kind() == reflect.Interface && k.Kind() != reflect.String && equal(k.Interface(), key) {
+			return iter.Value(), nil
+		}
+		// the smallest key is used if some keys are equal under the folding.
+		if isString && k.Kind() == reflect.String && strings.EqualFold(k.String(), s) {
+			if !found.IsValid() || k.String() < foundKey {
+				found, foundKey = iter.Value(), k.String()
+			}
+		}
+	}
+	return found, nil
+}
+
+// toInt convert integer of any type to int.
+func toInt(i interface{}) (int, bool) {
+	rv := reflect.ValueOf(i)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int(rv.Uint()), true
+	}
+	return 0, false
+}
+
+// itemIndex convert the index to int. Negative index is counted from the
+// end.
+func itemIndex(index interface{}, length int) (int, error) {
+	i, ok := toInt(index)
+	if !ok {
+		return 0, errors.New("cannot reference item")
+	}
+	n := i
+	if n < 0 {
+		n += length
+	}
+	if n < 0 || n >= length {
+		return 0, &IndexOutOfRangeError{Index: i, Length: length}
+	}
+	return n, nil
+}
+
+// sliceBounds evaluate bounds of the slice expression. Negative bounds are
+// counted from the end, and bounds are clamped to the length.
+func (v *VM) sliceBounds(ctx context.Context, t *SliceExpr, length int) (int, int, error) {
+	bound := func(expr Expr, def int) (int, error) {
+		if expr == nil {
+			return def, nil
+		}
+		r, err := v.eval(ctx, expr)
+		if err != nil {
+			return 0, err
+		}
+		i, ok := toInt(r)
+		if !ok {
+			return 0, errors.New("slice bounds must be integer")
+		}
+		if i < 0 {
+			i += length
+		}
+		if i < 0 {
+			i = 0
+		} else if i > length {
+			i = length
+		}
+		return i, nil
+	}
+	low, err := bound(t.Low, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	high, err := bound(t.High, length)
+	if err != nil {
+		return 0, 0, err
+	}
+	if high < low {
+		high = low
+	}
+	return low, high, nil
+}
+
+func (v *VM) evalAndDerefRv(ctx context.Context, expr Expr) (reflect.Value, error) {
+	vv, err := v.eval(ctx, expr)
 	if err != nil {
 		return reflect.ValueOf(nil), err
 	}
@@ -55,25 +737,204 @@ func (v *VM) evalAndDerefRv(expr Expr) (reflect.Value, error) {
 	return deref(rv)
 }
 
-// Eval evaluate the expression.
+// evalReceiver evaluate the receiver of the member, item and method access.
+// In the null-object mode, ok is false if the receiver is nil or Null.
+func (v *VM) evalReceiver(ctx context.Context, parent, expr Expr) (rv reflect.Value, ok bool, err error) {
+	vv, err := v.eval(ctx, expr)
+	if err != nil {
+		return rv, false, err
+	}
+	null := v.NullObject()
+	if _, isNull := vv.(NullValue); isNull && null {
+		return rv, false, nil
+	}
+	rv, err = deref(reflect.ValueOf(vv))
+	if err != nil {
+		if null {
+			return rv, false, nil
+		}
+		return rv, false, &missingError{&NilReceiverError{Path: exprPath(parent), Nil: exprPath(expr)}}
+	}
+	return rv, true, nil
+}
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// contextArgs returns arguments which ctx is prepended if the function takes
+// context.Context as first argument.
+func contextArgs(ctx context.Context, rf reflect.Value, args []reflect.Value) []reflect.Value {
+	rt := rf.Type()
+	if rt.NumIn() > 0 && rt.In(0) == contextType {
+		return append([]reflect.Value{reflect.ValueOf(&ctx).Elem()}, args...)
+	}
+	return args
+}
+
+// evalArgs evaluate the arguments of the function call.
+func (v *VM) evalArgs(ctx context.Context, exprs []Expr) ([]reflect.Value, error) {
+	args := []reflect.Value{}
+	for _, arg := range exprs {
+		arg, err := v.eval(ctx, arg)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, reflect.ValueOf(arg))
+	}
+	return args, nil
+}
+
+// Caller is the interface for the functions which can be called without
+// reflection. The arguments are passed as evaluated.
+type Caller interface {
+	Call(args []interface{}) (interface{}, error)
+}
+
+// callCaller evaluate the arguments and call c.
+func (v *VM) callCaller(ctx context.Context, c Caller, exprs []Expr) (interface{}, error) {
+	args := make([]interface{}, len(exprs))
+	for i, arg := range exprs {
+		arg, err := v.eval(ctx, arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = arg
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.Call(args)
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// checkArgs returns the error if args can't be passed to the function typed
+// rt, so the wrong call in the template fails without the panic. nil
+// arguments are replaced with the zero values of the parameters.
+func checkArgs(rt reflect.Type, args []reflect.Value) error {
+	n := rt.NumIn()
+	if rt.IsVariadic() {
+		if len(args) < n-1 {
+			return fmt.Errorf("wrong number of arguments: %d for at least %d", len(args), n-1)
+		}
+	} else if len(args) != n {
+		return fmt.Errorf("wrong number of arguments: %d for %d", len(args), n)
+	}
+	for i, arg := range args {
+		var at reflect.Type
+		if rt.IsVariadic() && i >= n-1 {
+			at = rt.In(n - 1).Elem()
+		} else {
+			at = rt.In(i)
+		}
+		if !arg.IsValid() {
+			switch at.Kind() {
+			case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+				args[i] = reflect.Zero(at)
+				continue
+			}
+			return fmt.Errorf("cannot use nil as %s in argument", at)
+		}
+		if !arg.Type().AssignableTo(at) {
+			return fmt.Errorf("cannot use %s as %s in argument", arg.Type(), at)
+		}
+	}
+	return nil
+}
+
+// callFunc call the function or the method rf. If the last value returned is
+// error, the error is returned. If it returns multiple values except error,
+// they are returned as slice.
+func callFunc(ctx context.Context, rf reflect.Value, args []reflect.Value) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	args = contextArgs(ctx, rf, args)
+	if err := checkArgs(rf.Type(), args); err != nil {
+		return nil, err
+	}
+	rets := rf.Call(args)
+	if n := len(rets); n > 0 && rf.Type().Out(n-1).Implements(errorType) {
+		last := rets[n-1]
+		if !isNil(last) {
+			return nil, last.Interface().(error)
+		}
+		rets = rets[:n-1]
+	}
+	switch len(rets) {
+	case 0:
+		return nil, nil
+	case 1:
+		return rets[0].Interface(), nil
+	}
+	vals := make([]interface{}, len(rets))
+	for i, ret := range rets {
+		vals[i] = ret.Interface()
+	}
+	return vals, nil
+}
+
+func isNil(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Chan, reflect.Func, reflect.Interface, reflect.Map, reflect.Ptr, reflect.Slice:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// Eval evaluate the expression with the context of the VM.
 func (v *VM) Eval(expr Expr) (interface{}, error) {
+	return v.eval(v.Context(), expr)
+}
+
+// EvalContext evaluate the expression with ctx. The ctx is passed to the
+// functions and methods which take context.Context as first argument.
+func (v *VM) EvalContext(ctx context.Context, expr Expr) (interface{}, error) {
+	return v.eval(ctx, expr)
+}
+
+func (v *VM) eval(ctx context.Context, expr Expr) (interface{}, error) {
+	if err := v.step(); err != nil {
+		return nil, err
+	}
 	switch t := expr.(type) {
 	case *IdentExpr:
-		if r, ok := v.env[t.Name]; ok {
-			return r, nil
+		if r, ok := v.Get(t.Name); ok {
+			return v.accessed(t, r)
 		}
-		return nil, errors.New("invalid token: " + t.Name)
+		return nil, &missingError{errors.New("invalid token: " + t.Name)}
 	case *LitExpr:
 		return t.Value, nil
+	case *UnaryExpr:
+		val, err := v.eval(ctx, t.Expr)
+		if err != nil {
+			return nil, err
+		}
+		rv := reflect.ValueOf(val)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return -rv.Int(), nil
+		case reflect.Float32, reflect.Float64:
+			return -rv.Float(), nil
+		}
+		return nil, errors.New("invalid type conversion")
 	case *BinOpExpr:
-		lhs, err := v.Eval(t.LHS)
+		if t.Op == "??" {
+			return v.coalesce(ctx, t.LHS, t.RHS)
+		}
+		if t.Op == "&&" || t.Op == "||" {
+			return v.logical(ctx, t.Op, t.LHS, t.RHS)
+		}
+		lhs, err := v.eval(ctx, t.LHS)
 		if err != nil {
 			return nil, err
 		}
-		rhs, err := v.Eval(t.RHS)
+		rhs, err := v.eval(ctx, t.RHS)
 		if err != nil {
 			return nil, err
 		}
+		if t.Op == "in" {
+			return contains(rhs, lhs)
+		}
 		switch vt := lhs.(type) {
 		case string:
 			switch t.Op {
@@ -98,6 +959,9 @@ func (v *VM) Eval(expr Expr) (interface{}, error) {
 			case "*":
 				return li * ri, nil
 			case "/":
+				if ri == 0 {
+					return nil, errors.New("integer divide by zero")
+				}
 				return li / ri, nil
 			}
 			return nil, errors.New("unknown operator")
@@ -124,134 +988,262 @@ func (v *VM) Eval(expr Expr) (interface{}, error) {
 		default:
 			return nil, errors.New("invalid type conversion")
 		}
-	case *CallExpr:
-		if f, ok := v.env[t.Name]; ok {
-			rf := reflect.ValueOf(f)
-			args := []reflect.Value{}
-			for _, arg := range t.Exprs {
-				arg, err := v.Eval(arg)
-				if err != nil {
-					return nil, err
-				}
-				args = append(args, reflect.ValueOf(arg))
-			}
-			rets := rf.Call(args)
-			if len(rets) == 0 {
-				return nil, nil
+	case *ProgramExpr:
+		return t.Program.Eval(ctx, v)
+	case *CondExpr:
+		cond, err := v.eval(ctx, t.Cond)
+		if err != nil {
+			return nil, err
+		}
+		if Truthy(cond) {
+			return v.eval(ctx, t.Then)
+		}
+		return v.eval(ctx, t.Else)
+	case *ArrayExpr:
+		a := make([]interface{}, len(t.Exprs))
+		for i, e := range t.Exprs {
+			val, err := v.eval(ctx, e)
+			if err != nil {
+				return nil, err
 			}
-			vals := []interface{}{}
-			for _, ret := range rets {
-				vals = append(vals, ret.Interface())
+			a[i] = val
+		}
+		return a, nil
+	case *MapExpr:
+		m := make(map[string]interface{}, len(t.Keys))
+		for i, key := range t.Keys {
+			val, err := v.eval(ctx, t.Values[i])
+			if err != nil {
+				return nil, err
 			}
-			if len(rets) == 1 {
-				return vals[0], nil
+			m[key] = val
+		}
+		return m, nil
+	case *CallExpr:
+		if f, ok := v.Get(t.Name); ok {
+			if c, ok := f.(Caller); ok {
+				return v.callCaller(ctx, c, t.Exprs)
 			}
-			if err, ok := vals[1].(error); ok {
-				return vals[0], err
+			args, err := v.evalArgs(ctx, t.Exprs)
+			if err != nil {
+				return nil, err
 			}
-			return vals[0], nil
+			return callFunc(ctx, reflect.ValueOf(f), args)
 		}
 		return nil, errors.New("invalid token: " + t.Name)
 	case *ItemExpr:
-		rv, err := v.evalAndDerefRv(t.LHS)
+		rv, ok, err := v.evalReceiver(ctx, t, t.LHS)
 		if err != nil {
 			return nil, err
+		} else if !ok {
+			return Null, nil
 		}
 
-		rhs, err := v.Eval(t.Index)
+		rhs, err := v.eval(ctx, t.Index)
 		if err != nil {
 			return nil, err
 		}
 
 		if rv.Kind() == reflect.Struct {
-			rv = rv.FieldByName(fmt.Sprint(rhs))
-			if !rv.IsValid() {
-				return nil, errors.New("cannot reference item")
+			if err := v.checkField(rv.Type(), fmt.Sprint(rhs)); err != nil {
+				return nil, err
+			}
+			fv, nilPath := v.fieldByName(rv, fmt.Sprint(rhs))
+			if nilPath != "" {
+				return v.missing(&NilReceiverError{Path: exprPath(t), Nil: exprPath(t.LHS) + "." + nilPath})
+			}
+			if !fv.IsValid() {
+				return v.missing(errors.New("cannot reference item"))
 			}
-			return rv.Interface(), nil
+			return v.member(ctx, t, rv.Type(), fmt.Sprint(rhs), fv.Interface())
 		} else if rv.Kind() == reflect.Map {
-			rv = rv.MapIndex(reflect.ValueOf(fmt.Sprint(rhs)))
-			if !rv.IsValid() {
-				return nil, errors.New("cannot reference item")
+			mv, err := mapIndex(rv, rhs)
+			if err != nil {
+				return v.missing(err)
+			}
+			if !mv.IsValid() {
+				return v.missing(errors.New("cannot reference item"))
 			}
-			return rv.Interface(), nil
-		} else if rv.Kind() == reflect.Slice && reflect.TypeOf(rhs).Kind() == reflect.Int64 {
-			rv = rv.Index(int(rhs.(int64)))
-			if !rv.IsValid() {
-				return nil, errors.New("cannot reference item")
+			return v.member(ctx, t, rv.Type(), fmt.Sprint(rhs), mv.Interface())
+		} else if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+			i, err := itemIndex(rhs, rv.Len())
+			if err != nil {
+				return v.missing(err)
+			}
+			return v.accessed(t, rv.Index(i).Interface())
+		} else if rv.Kind() == reflect.String {
+			// strings are indexed by rune, not by byte
+			rs := []rune(rv.String())
+			i, err := itemIndex(rhs, len(rs))
+			if err != nil {
+				return v.missing(err)
+			}
+			return v.accessed(t, string(rs[i]))
+		}
+		return v.missing(errors.New("cannot reference item"))
+	case *SliceExpr:
+		rv, ok, err := v.evalReceiver(ctx, t, t.LHS)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			return Null, nil
+		}
+		if rv.Kind() == reflect.String {
+			// strings are sliced by rune, not by byte
+			rs := []rune(rv.String())
+			low, high, err := v.sliceBounds(ctx, t, len(rs))
+			if err != nil {
+				return nil, err
 			}
-			return rv.Interface(), nil
+			return string(rs[low:high]), nil
 		}
-		return nil, errors.New("cannot reference item")
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return v.missing(errors.New("cannot slice value"))
+		}
+		low, high, err := v.sliceBounds(ctx, t, rv.Len())
+		if err != nil {
+			return nil, err
+		}
+		if rv.Kind() == reflect.Array && !rv.CanAddr() {
+			ptr := reflect.New(rv.Type())
+			ptr.Elem().Set(rv)
+			rv = ptr.Elem()
+		}
+		return rv.Slice(low, high).Interface(), nil
 	case *MethodCallExpr:
-		rv, err := v.evalAndDerefRv(t.LHS)
+		rv, ok, err := v.evalReceiver(ctx, t, t.LHS)
 		if err != nil {
 			return nil, err
+		} else if !ok {
+			return Null, nil
+		}
+		if ns, ok := rv.Interface().(Namespace); ok {
+			f, ok := ns[t.Name]
+			if !ok {
+				return v.missing(fmt.Errorf("cannot reference function: %s", t.Name))
+			}
+			if c, ok := f.(Caller); ok {
+				return v.callCaller(ctx, c, t.Exprs)
+			}
+			args, err := v.evalArgs(ctx, t.Exprs)
+			if err != nil {
+				return nil, err
+			}
+			return callFunc(ctx, reflect.ValueOf(f), args)
+		}
+		meth := v.methodByName(rv, t.Name)
+		if !meth.IsValid() && rv.CanAddr() {
+			meth = v.methodByName(rv.Addr(), t.Name)
 		}
-		meth := rv.MethodByName(t.Name)
 		if !meth.IsValid() {
 			// consider if receiver type is pointer type
 			ptr := reflect.New(rv.Type())
 			ptr.Elem().Set(rv)
-			meth = ptr.MethodByName(t.Name)
+			meth = v.methodByName(ptr, t.Name)
 			if !meth.IsValid() {
-				return nil, fmt.Errorf("cannot reference method: %s", t.Name)
+				return v.missing(fmt.Errorf("cannot reference method: %s", t.Name))
 			}
 		}
+		if err := v.checkType(rv.Type()); err != nil {
+			return nil, err
+		}
+		if err := v.checkMethod(rv.Type(), t.Name, meth); err != nil {
+			return nil, err
+		}
 		args := []reflect.Value{}
 		for _, arg := range t.Exprs {
-			rvarg, err := v.evalAndDerefRv(arg)
+			rvarg, err := v.evalAndDerefRv(ctx, arg)
 			if err != nil {
 				return nil, err
 			}
 			args = append(args, rvarg)
 		}
-		rets := meth.Call(args)
-		if len(rets) == 0 {
-			return nil, nil
-		}
-		vals := []interface{}{}
-		for _, ret := range rets {
-			vals = append(vals, ret.Interface())
-		}
-		if len(rets) == 1 {
-			return vals[0], nil
-		}
-		if err, ok := vals[1].(error); ok {
-			return vals[0], err
+		r, err := v.callMethod(ctx, t, t.LHS, rv, t.Name, meth, args)
+		if err != nil {
+			return nil, err
 		}
-		return vals[0], nil
+		return v.accessed(t, r)
 	case *MemberExpr:
-		rv, err := v.evalAndDerefRv(t.LHS)
+		rv, ok, err := v.evalReceiver(ctx, t, t.LHS)
 		if err != nil {
 			return nil, err
+		} else if !ok {
+			return Null, nil
 		}
 
 		if rv.Kind() == reflect.Struct {
-			rv = rv.FieldByName(t.Name)
-			if !rv.IsValid() {
-				return nil, errors.New("cannot reference member")
+			if err := v.checkField(rv.Type(), t.Name); err != nil {
+				return nil, err
+			}
+			fv, nilPath := v.fieldByName(rv, t.Name)
+			if nilPath != "" {
+				return v.missing(&NilReceiverError{Path: exprPath(t), Nil: exprPath(t.LHS) + "." + nilPath})
+			}
+			if fv.IsValid() {
+				return v.member(ctx, t, rv.Type(), t.Name, fv.Interface())
 			}
-			return rv.Interface(), nil
 		} else if rv.Kind() == reflect.Map {
-			rv = rv.MapIndex(reflect.ValueOf(t.Name))
-			if !rv.IsValid() {
-				return nil, errors.New("cannot reference member")
+			mv, err := mapIndex(rv, t.Name)
+			if err != nil {
+				return v.missing(err)
+			}
+			if mv.IsValid() {
+				return v.member(ctx, t, rv.Type(), t.Name, mv.Interface())
 			}
-			return rv.Interface(), nil
 		}
-		return nil, errors.New("cannot reference member")
+		if r, ok, err := v.getter(ctx, t, rv); ok {
+			return r, err
+		}
+		return v.missing(errors.New("cannot reference member"))
 
 	}
 	return nil, nil
 }
 
-// Compile compile the source.
+// Compile compile the source. Compiled expressions are cached.
 func (v *VM) Compile(s string) (Expr, error) {
-	lex := &Lexer{new(scanner.Scanner), nil}
-	lex.s.Init(strings.NewReader(s))
-	if yyParse(lex) != 0 {
-		return nil, fmt.Errorf("syntax error: %s", s)
+	return v.compile(s, false)
+}
+
+// CompileStmt compile the source of the control line. The words like
+// "deadline", "break" and "flush" at the start are the keywords only in the
+// control lines.
+func (v *VM) CompileStmt(s string) (Expr, error) {
+	return v.compile(s, true)
+}
+
+func (v *VM) compile(s string, stmt bool) (Expr, error) {
+	c := v.cache
+	exprs := c.exprs
+	if stmt {
+		exprs = c.stmts
+	}
+	c.mu.RLock()
+	expr, ok := exprs[s]
+	c.mu.RUnlock()
+	if ok {
+		return expr, nil
+	}
+	if v.backend != nil {
+		var err error
+		expr, err = v.compileBackend(s, stmt)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		lex := &Lexer{s: new(scanner.Scanner), stmt: stmt}
+		lex.s.Init(strings.NewReader(s))
+		if yyParse(lex) != 0 {
+			return nil, fmt.Errorf("syntax error: %s", s)
+		}
+		expr = lex.e
+	}
+	c.mu.Lock()
+	if stmt {
+		c.stmts[s] = expr
+	} else {
+		c.exprs[s] = expr
 	}
-	return lex.e, nil
+	c.mu.Unlock()
+	return expr, nil
 }
@@ -1,8 +1,14 @@
 package vm
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type testStruct1 struct {
@@ -153,3 +159,1551 @@ func TestMethodCallMayReturnError(t *testing.T) {
 		}
 	})
 }
+
+func TestCache(t *testing.T) {
+	v := New()
+	v.Set("test", &testStruct1{
+		Foo: 3,
+	})
+	v.Set("x", 1)
+	v.Set("y", 2)
+	expr, err := v.Compile(`test.SomeFunction(x, y) + test.Foo`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		r, err := v.Eval(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r != int64(9) {
+			t.Fatalf("Expected %v, but %v:", 9, r)
+		}
+	}
+	if len(v.cache.fields) != 1 || len(v.cache.methods) != 2 {
+		t.Fatalf("Expected cached 1 field and 2 methods, but %v and %v:", len(v.cache.fields), len(v.cache.methods))
+	}
+	v.ClearCache()
+	if len(v.cache.fields) != 0 || len(v.cache.methods) != 0 || len(v.cache.exprs) != 0 {
+		t.Fatalf("Expected cache to be cleared")
+	}
+}
+
+func BenchmarkMemberExpr(b *testing.B) {
+	v := New()
+	v.Set("test", testStruct1{
+		Foo: 3,
+	})
+	expr, err := v.Compile(`test.Foo`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := v.Eval(expr); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	v := New()
+	v.Set("m", map[string]interface{}{"flush": "f", "break": "b"})
+	v.Set("deadline", "d")
+	v.Set("flush", map[string]interface{}{"x": "x"})
+	for _, tt := range []struct {
+		in     string
+		expect interface{}
+	}{
+		{`m.flush`, "f"},
+		{`m.break`, "b"},
+		{`deadline`, "d"},
+		{`deadline + m.flush`, "df"},
+		{`flush.x`, "x"},
+	} {
+		expr, err := v.Compile(tt.in)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		r, err := v.Eval(expr)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		if r != tt.expect {
+			t.Fatalf("Expected %v, but %v: %v", tt.expect, r, tt.in)
+		}
+	}
+	for _, tt := range []struct {
+		in     string
+		expect interface{}
+	}{
+		{`flush`, &FlushExpr{}},
+		{`break if m.break`, &BreakExpr{}},
+		{`flush.x`, &MemberExpr{}},
+		{`m.flush`, &MemberExpr{}},
+	} {
+		expr, err := v.CompileStmt(tt.in)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		if reflect.TypeOf(expr) != reflect.TypeOf(tt.expect) {
+			t.Fatalf("Expected %T, but %T: %v", tt.expect, expr, tt.in)
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	v := New()
+	expr, err := v.CompileStmt(`deadline 1h30m`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	de, ok := expr.(*DeadlineExpr)
+	if !ok {
+		t.Fatalf("Expected DeadlineExpr, but %T:", expr)
+	}
+	r, err := v.Eval(de.Timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != 90*time.Minute {
+		t.Fatalf("Expected %v, but %v:", 90*time.Minute, r)
+	}
+}
+
+func TestClone(t *testing.T) {
+	v := New()
+	v.Set("foo", 1)
+	c := v.Clone()
+	c.Set("foo", 2)
+	c.Set("bar", 3)
+	if r, _ := v.Get("foo"); r != 1 {
+		t.Fatalf("Expected %v, but %v:", 1, r)
+	}
+	if _, ok := v.Get("bar"); ok {
+		t.Fatalf("Expected bar not to be set in original")
+	}
+	expr, err := c.Compile(`foo`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v.cache.exprs["foo"]; !ok {
+		t.Fatalf("Expected compiled expression to be shared")
+	}
+	r, err := c.Eval(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != 2 {
+		t.Fatalf("Expected %v, but %v:", 2, r)
+	}
+}
+
+func TestConcurrentEval(t *testing.T) {
+	v := New()
+	v.Set("test", testStruct1{
+		Foo: 3,
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := v.Clone()
+			c.Set("x", i)
+			expr, err := c.Compile(`test.SomeFunction(x, x)`)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			r, err := c.Eval(expr)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if r != 3+i*2 {
+				t.Errorf("Expected %v, but %v:", 3+i*2, r)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+type ctxKey struct{}
+
+func TestEvalContext(t *testing.T) {
+	v := New()
+	v.Set("value", func(ctx context.Context, s string) string {
+		return fmt.Sprint(ctx.Value(ctxKey{}), s)
+	})
+	expr, err := v.Compile(`value("!")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "hello")
+	r, err := v.EvalContext(ctx, expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != "hello!" {
+		t.Fatalf("Expected %v, but %v:", "hello!", r)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = v.EvalContext(ctx, expr)
+	if err != context.Canceled {
+		t.Fatalf("Expected %v, but %v:", context.Canceled, err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	v := New()
+	v.SetLimits(Limits{MaxEvals: 3, MaxIterations: 2})
+	expr, err := v.Compile(`1 + 2 + 3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = v.Eval(expr)
+	var le *LimitError
+	if !errors.As(err, &le) || le.Limit != "evaluations" {
+		t.Fatalf("Expected LimitError, but %v:", err)
+	}
+
+	c := v.Clone()
+	expr, err = c.Compile(`1 + 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Eval(expr); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := c.Iterate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Iterate(); !errors.As(err, &le) || le.Limit != "iterations" {
+		t.Fatalf("Expected LimitError, but %v:", err)
+	}
+
+	v.SetLimits(Limits{Timeout: time.Millisecond})
+	time.Sleep(2 * time.Millisecond)
+	if _, err = v.Eval(expr); !errors.As(err, &le) || le.Limit != "timeout" {
+		t.Fatalf("Expected LimitError, but %v:", err)
+	}
+}
+
+func TestIterateLoop(t *testing.T) {
+	v := New()
+	v.SetLimits(Limits{MaxLoopItems: 3})
+	for i := 1; i <= 3; i++ {
+		if err := v.IterateLoop(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var le *LoopLimitError
+	if err := v.IterateLoop(4); !errors.As(err, &le) || le.Limit != 3 {
+		t.Fatalf("Expected LoopLimitError, but %v:", err)
+	}
+	if err := v.IterateLoop(1); err != nil {
+		t.Fatal(err)
+	}
+
+	v.SetLimits(Limits{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	v.SetContext(ctx)
+	if err := v.IterateLoop(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.IterateLoop(loopChunk); err != context.Canceled {
+		t.Fatalf("Expected %v, but %v:", context.Canceled, err)
+	}
+}
+
+func (v *testStruct1) Reset() {
+	v.Foo = 0
+}
+
+type testStruct2 struct{}
+
+func (testStruct2) Name() string {
+	return "test2"
+}
+
+func TestRestrict(t *testing.T) {
+	v := New()
+	v.Set("test", &testStruct1{Foo: 1})
+	v.Set("test2", testStruct2{})
+	v.Restrict()
+
+	eval := func(s string) error {
+		expr, err := v.Compile(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = v.Eval(expr)
+		return err
+	}
+	if err := eval(`test.Itself()`); err == nil {
+		t.Fatal("Expected to error, but not")
+	}
+	v.Allow(&testStruct1{})
+	if err := eval(`test.Itself()`); err != nil {
+		t.Fatal(err)
+	}
+	if err := eval(`test.Reset()`); err == nil {
+		t.Fatal("Expected to error, but not")
+	}
+	if err := eval(`test2.Name()`); err == nil {
+		t.Fatal("Expected to error, but not")
+	}
+	v.Allow(testStruct2{}, "Name")
+	if err := eval(`test2.Name()`); err != nil {
+		t.Fatal(err)
+	}
+	v.Allow(&testStruct1{}, "Reset")
+	if err := eval(`test.Itself()`); err == nil {
+		t.Fatal("Expected to error, but not")
+	}
+	if err := v.Clone().checkMethod(reflect.TypeOf(testStruct1{}), "Reset", reflect.ValueOf((&testStruct1{}).Reset)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testKey string
+
+func TestItem(t *testing.T) {
+	v := New()
+	v.Set("strs", map[string]int{"1": 1})
+	v.Set("named", map[testKey]int{"a": 2})
+	v.Set("ints", map[int]string{1: "one"})
+	v.Set("uints", map[uint8]string{2: "two"})
+	v.Set("ifaces", map[interface{}]string{int64(3): "three", "x": "ex"})
+	v.Set("floats", map[float64]string{1.5: "f"})
+	v.Set("slice", []string{"a", "b"})
+	v.Set("array", [2]string{"c", "d"})
+	v.Set("idx", uint(1))
+	v.Set("sidx", int32(0))
+	tests := []struct {
+		in     string
+		expect interface{}
+	}{
+		{`strs[1]`, 1},
+		{`named["a"]`, 2},
+		{`ints[1]`, "one"},
+		{`ints["1"]`, "one"},
+		{`ints[1.0]`, "one"},
+		{`uints[2]`, "two"},
+		{`ifaces[3]`, "three"},
+		{`ifaces["x"]`, "ex"},
+		{`floats[1.5]`, "f"},
+		{`slice[idx]`, "b"},
+		{`array[sidx]`, "c"},
+	}
+	for _, tt := range tests {
+		expr, err := v.Compile(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := v.Eval(expr)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		if r != tt.expect {
+			t.Fatalf("Expected %v, but %v: %v", tt.expect, r, tt.in)
+		}
+	}
+	v.Set("int8s", map[int8]string{44: "x"})
+	v.Set("big", int64(300))
+	v.Set("neg", int64(-1))
+	for _, in := range []string{`slice[2]`, `ints["x"]`, `slice["0"]`, `int8s[big]`, `int8s["300"]`, `ints[1.9]`, `uints[neg]`, `uints[258]`} {
+		expr, err := v.Compile(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = v.Eval(expr); err == nil {
+			t.Fatalf("Expected to error, but not: %v", in)
+		}
+	}
+}
+
+func TestNegativeIndex(t *testing.T) {
+	v := New()
+	v.Set("items", []string{"a", "b", "c"})
+	tests := []struct {
+		in     string
+		expect interface{}
+	}{
+		{`items[-1]`, "c"},
+		{`items[-3]`, "a"},
+		{`items[0]`, "a"},
+	}
+	for _, tt := range tests {
+		expr, err := v.Compile(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := v.Eval(expr)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		if r != tt.expect {
+			t.Fatalf("Expected %v, but %v: %v", tt.expect, r, tt.in)
+		}
+	}
+	for _, tt := range []struct {
+		in     string
+		index  int
+		length int
+	}{
+		{`items[3]`, 3, 3},
+		{`items[-4]`, -4, 3},
+	} {
+		expr, err := v.Compile(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = v.Eval(expr)
+		var ie *IndexOutOfRangeError
+		if !errors.As(err, &ie) || ie.Index != tt.index || ie.Length != tt.length {
+			t.Fatalf("Expected IndexOutOfRangeError, but %v: %v", err, tt.in)
+		}
+	}
+}
+
+func TestOperatorPrecedence(t *testing.T) {
+	v := New()
+	v.Set("x", 2)
+	tests := []struct {
+		in     string
+		expect interface{}
+	}{
+		{`1 + 2 * 3`, int64(7)},
+		{`2 - 3 - 1`, int64(-2)},
+		{`8 / 2 / 2`, int64(2)},
+		{`-x * 3`, int64(-6)},
+		{`-1.5`, -1.5},
+		{`-(1 + 2)`, int64(-3)},
+	}
+	for _, tt := range tests {
+		expr, err := v.Compile(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := v.Eval(expr)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		if r != tt.expect {
+			t.Fatalf("Expected %v, but %v: %v", tt.expect, r, tt.in)
+		}
+	}
+	for _, tt := range []string{`1 / 0`, `x / (x - 2)`} {
+		expr, err := v.Compile(tt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := v.Eval(expr); err == nil {
+			t.Fatalf("%v: expected error but not", tt)
+		}
+	}
+}
+
+func TestSlice(t *testing.T) {
+	v := New()
+	v.Set("items", []int{1, 2, 3, 4})
+	v.Set("array", [3]string{"a", "b", "c"})
+	v.Set("n", 2)
+	tests := []struct {
+		in     string
+		expect string
+	}{
+		{`items[1:3]`, "[2 3]"},
+		{`items[:n]`, "[1 2]"},
+		{`items[n:]`, "[3 4]"},
+		{`items[:]`, "[1 2 3 4]"},
+		{`items[-2:]`, "[3 4]"},
+		{`items[:10]`, "[1 2 3 4]"},
+		{`items[3:1]`, "[]"},
+		{`array[1:]`, "[b c]"},
+		{`items[1:3][0]`, "2"},
+	}
+	for _, tt := range tests {
+		expr, err := v.Compile(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := v.Eval(expr)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		if got := fmt.Sprint(r); got != tt.expect {
+			t.Fatalf("Expected %v, but %v: %v", tt.expect, got, tt.in)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			Default.Register(fmt.Sprintf("test_registry%d", i), i)
+		}(i)
+	}
+	wg.Wait()
+	v := New()
+	for i := 0; i < 10; i++ {
+		if r, ok := v.Get(fmt.Sprintf("test_registry%d", i)); !ok || r != i {
+			t.Fatalf("Expected %v, but %v:", i, r)
+		}
+	}
+	if _, ok := Default.Lookup("test_registry0"); !ok {
+		t.Fatal("Expected to be registered")
+	}
+}
+
+func TestStringItemAndSlice(t *testing.T) {
+	v := New()
+	v.Set("title", "こんにちは世界")
+	tests := []struct {
+		in     string
+		expect interface{}
+	}{
+		{`title[0]`, "こ"},
+		{`title[-1]`, "界"},
+		{`title[0:5]`, "こんにちは"},
+		{`title[5:]`, "世界"},
+		{`title[:40]`, "こんにちは世界"},
+	}
+	for _, tt := range tests {
+		expr, err := v.Compile(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := v.Eval(expr)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		if r != tt.expect {
+			t.Fatalf("Expected %v, but %v: %v", tt.expect, r, tt.in)
+		}
+	}
+	expr, err := v.Compile(`title[7]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = v.Eval(expr)
+	var ie *IndexOutOfRangeError
+	if !errors.As(err, &ie) || ie.Length != 7 {
+		t.Fatalf("Expected IndexOutOfRangeError, but %v:", err)
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	v := New()
+	v.Set("upcase", func(s string) string { return "app " + s })
+	v.Set("str.upcase", strings.ToUpper)
+	v.Set("str.html.escape", func(s string) string { return "escaped " + s })
+	ns, _ := v.Get("str")
+	v.Set("str.downcase", strings.ToLower)
+	if _, ok := ns.(Namespace)["downcase"]; ok {
+		t.Fatal("Expected namespace to be copied on write")
+	}
+	tests := []struct {
+		in     string
+		expect interface{}
+	}{
+		{`upcase("x")`, "app x"},
+		{`str.upcase("x")`, "X"},
+		{`str.downcase("X")`, "x"},
+		{`str.html.escape("x")`, "escaped x"},
+	}
+	for _, tt := range tests {
+		expr, err := v.Compile(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := v.Eval(expr)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		if r != tt.expect {
+			t.Fatalf("Expected %v, but %v: %v", tt.expect, r, tt.in)
+		}
+	}
+	expr, err := v.Compile(`str.unknown("x")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = v.Eval(expr); err == nil {
+		t.Fatal("Expected to error, but not")
+	}
+}
+
+type kwargsTest struct{}
+
+func (kwargsTest) Join(a, b string, opts map[string]interface{}) string {
+	return fmt.Sprintf("%s%v%s", a, opts["sep"], b)
+}
+
+func TestKeywordArgs(t *testing.T) {
+	v := New()
+	v.Set("obj", kwargsTest{})
+	v.Set("opts", func(opts map[string]interface{}) int {
+		return len(opts)
+	})
+	tests := []struct {
+		in     string
+		expect interface{}
+	}{
+		{`obj.Join("a", "b", sep: "-")`, "a-b"},
+		{`obj.Join("a", "b", sep: 1 + 2)`, "a3b"},
+		{`opts(limit: 10, offset: 20)`, 2},
+		{`opts({a: 1, b: {c: 2}})`, 2},
+		{`opts({})`, 0},
+	}
+	for _, tt := range tests {
+		expr, err := v.Compile(tt.in)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		r, err := v.Eval(expr)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		if r != tt.expect {
+			t.Fatalf("Expected %v, but %v: %v", tt.expect, r, tt.in)
+		}
+	}
+	if _, err := v.Compile(`opts(limit: 10, 20)`); err == nil {
+		t.Fatal("Expected to error, but not")
+	}
+}
+
+func TestSymbol(t *testing.T) {
+	v := New()
+	v.Set("name", func(s string) string {
+		return s
+	})
+	v.Set("join", func(a, b string) string {
+		return a + b
+	})
+	tests := []struct {
+		in     string
+		expect interface{}
+	}{
+		{`name :head`, "head"},
+		{`name("head")`, "head"},
+		{`name(:head)`, "head"},
+		{`join("a",:b)`, "ab"},
+	}
+	for _, tt := range tests {
+		expr, err := v.Compile(tt.in)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		r, err := v.Eval(expr)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		if r != tt.expect {
+			t.Fatalf("Expected %v, but %v: %v", tt.expect, r, tt.in)
+		}
+	}
+	expr, err := v.Compile(`{a: 1}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Eval(expr); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCallArgs(t *testing.T) {
+	v := New()
+	v.Set("name", func(s string) string {
+		return s
+	})
+	v.Set("deref", func(p *int) bool {
+		return p == nil
+	})
+	v.Set("join", func(sep string, s ...string) string {
+		return strings.Join(s, sep)
+	})
+	v.Set("nothing", nil)
+	tests := []struct {
+		in     string
+		expect interface{}
+	}{
+		{`deref(nothing)`, true},
+		{`join(",")`, ""},
+		{`join(",", "a", "b")`, "a,b"},
+	}
+	for _, tt := range tests {
+		expr, err := v.Compile(tt.in)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		r, err := v.Eval(expr)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		if r != tt.expect {
+			t.Fatalf("Expected %v, but %v: %v", tt.expect, r, tt.in)
+		}
+	}
+	for _, tt := range []string{`name()`, `name("a", "b")`, `name(1)`, `name(nothing)`, `join()`, `join(",", 1)`} {
+		expr, err := v.Compile(tt)
+		if err != nil {
+			t.Fatalf("%v: %v", tt, err)
+		}
+		if _, err := v.Eval(expr); err == nil {
+			t.Fatalf("%v: expected error but not", tt)
+		}
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	v := New()
+	v.Set("user", map[string]interface{}{"name": "mattn", "nick": nil})
+	v.Set("none", (*kwargsTest)(nil))
+	v.Set("fail", func() (string, error) { return "", errors.New("fail") })
+	tests := []struct {
+		in     string
+		expect interface{}
+	}{
+		{`user.name ?? "anonymous"`, "mattn"},
+		{`user.nick ?? "anonymous"`, "anonymous"},
+		{`user.age ?? 0`, int64(0)},
+		{`undefined ?? "x"`, "x"},
+		{`none ?? "x"`, "x"},
+		{`undefined ?? user.nick ?? "x"`, "x"},
+		{`user.nick ?? 1 + 2`, int64(3)},
+	}
+	for _, tt := range tests {
+		expr, err := v.Compile(tt.in)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		r, err := v.Eval(expr)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		if r != tt.expect {
+			t.Fatalf("Expected %v, but %v: %v", tt.expect, r, tt.in)
+		}
+	}
+	expr, err := v.Compile(`fail() ?? "x"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Eval(expr); err == nil {
+		t.Fatal("Expected to error, but not")
+	}
+}
+
+func TestLogical(t *testing.T) {
+	v := New()
+	v.Set("on", true)
+	v.Set("off", false)
+	v.Set("name", "mattn")
+	v.Set("fail", func() (string, error) { return "", errors.New("fail") })
+	tests := []struct {
+		in     string
+		expect interface{}
+	}{
+		{`on ? "on" : ""`, "on"},
+		{`off ? "on" : ""`, ""},
+		{`name ? 1 : 2`, int64(1)},
+		{`off ? 1 : on ? 2 : 3`, int64(2)},
+		{`on && "b"`, "b"},
+		{`off && "b"`, false},
+		{`off && fail()`, false},
+		{`on || fail()`, true},
+		{`"" || name`, "mattn"},
+		{`off || on && "b"`, "b"},
+		{`on ? "a" + "b" : "c"`, "ab"},
+	}
+	for _, tt := range tests {
+		expr, err := v.Compile(tt.in)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		r, err := v.Eval(expr)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		if r != tt.expect {
+			t.Fatalf("Expected %v, but %v: %v", tt.expect, r, tt.in)
+		}
+	}
+}
+
+func TestArray(t *testing.T) {
+	v := New()
+	v.Set("on", true)
+	v.Set("off", false)
+	expr, err := v.Compile(`["a", on && "b", off && "c", [1]]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := v.Eval(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []interface{}{"a", "b", false, []interface{}{int64(1)}}
+	if !reflect.DeepEqual(r, expect) {
+		t.Fatalf("Expected %v, but %v", expect, r)
+	}
+	expr, err = v.Compile(`[]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = v.Eval(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, ok := r.([]interface{}); !ok || len(a) != 0 {
+		t.Fatalf("Expected empty array, but %v", r)
+	}
+}
+
+type returnsTest struct{}
+
+func (returnsTest) Pair() (int, string) { return 1, "a" }
+
+func (returnsTest) Triple() (int, string, error) { return 1, "a", nil }
+
+func (returnsTest) Fail() (int, string, error) { return 0, "", errors.New("fail") }
+
+func (returnsTest) Items() ([]int, error) { return []int{1, 2}, nil }
+
+func TestReturnValues(t *testing.T) {
+	v := New()
+	v.Set("obj", returnsTest{})
+	v.Set("noop", func() error { return nil })
+	tests := []struct {
+		in     string
+		expect interface{}
+	}{
+		{`obj.Pair()`, []interface{}{1, "a"}},
+		{`obj.Triple()`, []interface{}{1, "a"}},
+		{`obj.Items()[1]`, 2},
+		{`noop()`, nil},
+	}
+	for _, tt := range tests {
+		expr, err := v.Compile(tt.in)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		r, err := v.Eval(expr)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		if !reflect.DeepEqual(r, tt.expect) {
+			t.Fatalf("Expected %v, but %v: %v", tt.expect, r, tt.in)
+		}
+	}
+	expr, err := v.Compile(`obj.Fail()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = v.Eval(expr); err == nil || err.Error() != "fail" {
+		t.Fatalf("Expected fail, but %v", err)
+	}
+}
+
+// pipeBackend is a tiny language like "name | upper".
+type pipeBackend struct{}
+
+type pipeProgram []string
+
+func (pipeBackend) Compile(src string) (Program, error) {
+	var p pipeProgram
+	for _, s := range strings.Split(src, "|") {
+		p = append(p, strings.TrimSpace(s))
+	}
+	return p, nil
+}
+
+func (p pipeProgram) Eval(ctx context.Context, env Env) (interface{}, error) {
+	v, ok := env.Get(p[0])
+	if !ok {
+		return nil, fmt.Errorf("unknown variable: %s", p[0])
+	}
+	for _, f := range p[1:] {
+		switch f {
+		case "upper":
+			v = strings.ToUpper(fmt.Sprint(v))
+		case "not":
+			v = v != true
+		default:
+			return nil, fmt.Errorf("unknown filter: %s", f)
+		}
+	}
+	return v, nil
+}
+
+func TestBackend(t *testing.T) {
+	v := New()
+	v.SetBackend(pipeBackend{})
+	v.Set("name", "golang")
+	v.Set("ok", true)
+	tests := []struct {
+		in     string
+		expect interface{}
+	}{
+		{`name | upper`, "GOLANG"},
+		{`ok | not`, false},
+	}
+	for _, tt := range tests {
+		expr, err := v.Compile(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := v.Clone().Eval(expr)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		if r != tt.expect {
+			t.Fatalf("Expected %v, but %v: %v", tt.expect, r, tt.in)
+		}
+	}
+	stmts := []struct {
+		in     string
+		expect interface{}
+	}{
+		{`for i, x in items | upper`, &ForExpr{}},
+		{`deadline timeout`, &DeadlineExpr{}},
+		{`break if ok | not`, &BreakExpr{}},
+		{`continue`, &ContinueExpr{}},
+		{`assert ok | not, "not ok"`, &AssertExpr{}},
+		{`memo key = name | upper`, &DirectiveExpr{}},
+		{`else`, &ElseExpr{}},
+		{`flush`, &FlushExpr{}},
+	}
+	for _, tt := range stmts {
+		expr, err := v.CompileStmt(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reflect.TypeOf(expr) != reflect.TypeOf(tt.expect) {
+			t.Fatalf("Expected %T, but %T: %v", tt.expect, expr, tt.in)
+		}
+	}
+}
+
+func TestNullObject(t *testing.T) {
+	v := New()
+	v.Set("user", map[string]interface{}{
+		"name": "mattn",
+	})
+	v.Set("items", []int{1, 2})
+	v.Set("nothing", (*testStruct1)(nil))
+	v.Set("fail", func() (string, error) {
+		return "", errors.New("failed")
+	})
+
+	tests := []string{
+		`user.address.city`,
+		`user["address"].city`,
+		`user.address.Format(1)`,
+		`items[5].name`,
+		`items[5][1:2]`,
+		`nothing.Foo`,
+	}
+	for _, tt := range tests {
+		expr, err := v.Compile(tt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := v.Eval(expr); err == nil {
+			t.Fatalf("%s: expected error but not", tt)
+		}
+		nv := v.Clone()
+		nv.SetNullObject(true)
+		r, err := nv.Eval(expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt, err)
+		}
+		if r != Null {
+			t.Fatalf("%s: expected Null but %v", tt, r)
+		}
+		if s := fmt.Sprint(r); s != "" {
+			t.Fatalf("%s: expected empty but %q", tt, s)
+		}
+	}
+
+	v.SetNullObject(true)
+	for _, tt := range []struct {
+		src    string
+		expect interface{}
+	}{
+		{`user.name`, "mattn"},
+		{`"(" + user.age + ")"`, "()"},
+	} {
+		expr, err := v.Compile(tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := v.Eval(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r != tt.expect {
+			t.Fatalf("%s: expected %v but %v", tt.src, tt.expect, r)
+		}
+	}
+
+	// errors other than the failed access are not hidden
+	for _, tt := range []string{`unknown.name`, `fail().name`} {
+		expr, err := v.Compile(tt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := v.Eval(expr); err == nil {
+			t.Fatalf("%s: expected error but not", tt)
+		}
+	}
+}
+
+type testExposed struct {
+	Exported
+	Name   string
+	secret string
+	Inner  testHidden
+	testHidden
+}
+
+type testHidden struct {
+	Token string
+}
+
+func (testHidden) Reveal() string {
+	return "revealed"
+}
+
+type testPrinted struct {
+	Exported
+	Name  string
+	At    time.Time
+	Inner *testHidden
+	Items []interface{}
+}
+
+func TestRestrictData(t *testing.T) {
+	v := New()
+	v.Set("user", &testExposed{
+		Name:       "mattn",
+		secret:     "secret",
+		Inner:      testHidden{Token: "inner"},
+		testHidden: testHidden{Token: "embedded"},
+	})
+	v.Set("hidden", testHidden{Token: "token"})
+	v.Set("items", []map[string]interface{}{{"name": "foo"}})
+	v.RestrictData()
+
+	eval := func(s string) (interface{}, error) {
+		expr, err := v.Compile(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.Eval(expr)
+	}
+	for _, tt := range []string{`user.Name`, `user["Name"]`, `items[0].name`} {
+		if _, err := eval(tt); err != nil {
+			t.Fatalf("%s: %v", tt, err)
+		}
+	}
+	for _, tt := range []string{
+		`user.secret`,
+		`user.Inner.Token`,
+		`user.Token`,
+		`hidden.Token`,
+		`hidden["Token"]`,
+		`hidden.Reveal()`,
+	} {
+		if _, err := eval(tt); err == nil {
+			t.Fatalf("%s: expected error but not", tt)
+		}
+	}
+
+	for _, value := range []interface{}{
+		testHidden{},
+		&testHidden{},
+		[]int{1},
+		map[string]string{},
+		&testExposed{},
+		testPrinted{Inner: &testHidden{}},
+		testPrinted{Items: []interface{}{testHidden{}}},
+	} {
+		if err := v.CheckPrint(value); err == nil {
+			t.Fatalf("%#v: expected error but not", value)
+		}
+	}
+	for _, value := range []interface{}{"foo", 1, testPrinted{Name: "foo"}, &testPrinted{At: time.Now()}} {
+		if err := v.CheckPrint(value); err != nil {
+			t.Fatalf("%T: %v", value, err)
+		}
+	}
+
+	v.Clone().Expose(testHidden{})
+	for _, tt := range []string{`user.Inner.Token`, `user.Token`, `hidden.Reveal()`} {
+		if _, err := eval(tt); err != nil {
+			t.Fatalf("%s: %v", tt, err)
+		}
+	}
+	if err := v.CheckPrint(testHidden{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	v := New()
+	v.Set("user", &testStruct1{Foo: 1})
+	v.Set("m", map[string]interface{}{"key": []int{1, 2}})
+	a := NewAudit()
+	v.SetAudit(a)
+	for _, s := range []string{`user.Foo`, `user.Itself().Foo`, `m["key"][0]`, `to_upper("x")`, `m.missing`} {
+		expr, err := v.Compile(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.Eval(expr)
+	}
+	expect := []string{
+		"m",
+		"m.key",
+		"m.key[]",
+		"user",
+		"user.Foo",
+		"user.Itself()",
+		"user.Itself().Foo",
+	}
+	if got := a.Paths(); !reflect.DeepEqual(expect, got) {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+}
+
+type testContact struct {
+	Name  string
+	Email string `redact:"email"`
+}
+
+func TestRedactor(t *testing.T) {
+	v := New()
+	v.Set("c", &testContact{Name: "mattn", Email: "mattn@example.com"})
+	v.Set("m", map[string]interface{}{"email": "foo@example.com"})
+	var paths []string
+	v.SetRedactor(func(ctx context.Context, m *Member, value interface{}) (interface{}, error) {
+		paths = append(paths, m.Path)
+		if m.Tag.Get("redact") == "email" || m.Name == "email" {
+			return "***", nil
+		}
+		return value, nil
+	})
+	tests := []struct {
+		src    string
+		expect interface{}
+	}{
+		{`c.Name`, "mattn"},
+		{`c.Email`, "***"},
+		{`c["Email"]`, "***"},
+		{`m.email`, "***"},
+	}
+	for _, tt := range tests {
+		expr, err := v.Compile(tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := v.Eval(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r != tt.expect {
+			t.Fatalf("%s: expected %v but %v", tt.src, tt.expect, r)
+		}
+	}
+	expect := []string{"c.Name", "c.Email", "c.Email", "m.email"}
+	if !reflect.DeepEqual(expect, paths) {
+		t.Fatalf("expected %v but %v", expect, paths)
+	}
+}
+
+func TestIn(t *testing.T) {
+	v := New()
+	v.Set("items", []interface{}{1, "a", 2.5})
+	v.Set("ids", map[int]string{1: "a"})
+	v.Set("none", nil)
+	tests := []struct {
+		in     string
+		expect interface{}
+	}{
+		{`1 in items`, true},
+		{`"a" in items`, true},
+		{`2.5 in items`, true},
+		{`3 in items`, false},
+		{`1 in ids`, true},
+		{`"1" in ids`, true},
+		{`2 in ids`, false},
+		{`"x" in ids`, false},
+		{`"ell" in "hello"`, true},
+		{`"x" in "hello"`, false},
+		{`1 in none`, false},
+		{`0 + 1 in ids`, true},
+	}
+	for _, tt := range tests {
+		expr, err := v.Compile(tt.in)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		r, err := v.Eval(expr)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		if r != tt.expect {
+			t.Fatalf("Expected %v, but %v: %v", tt.expect, r, tt.in)
+		}
+	}
+	expr, err := v.Compile(`1 in 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Eval(expr); err == nil {
+		t.Fatal("Expected to error, but not")
+	}
+}
+
+type nilReceiverTest struct {
+	Address *struct{ City string }
+}
+
+func TestNilReceiverError(t *testing.T) {
+	v := New()
+	v.Set("user", &nilReceiverTest{})
+	v.Set("users", []*nilReceiverTest{nil})
+	tests := []struct {
+		in   string
+		path string
+		nil  string
+	}{
+		{`user.Address.City`, "user.Address.City", "user.Address"},
+		{`users[0].Address`, "users[0].Address", "users[0]"},
+		{`users[0].Address.City`, "users[0].Address", "users[0]"},
+	}
+	for _, tt := range tests {
+		expr, err := v.Compile(tt.in)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		_, err = v.Eval(expr)
+		var ne *NilReceiverError
+		if !errors.As(err, &ne) {
+			t.Fatalf("Expected NilReceiverError, but %v: %v", err, tt.in)
+		}
+		if ne.Path != tt.path || ne.Nil != tt.nil {
+			t.Fatalf("Expected %v and %v, but %v and %v: %v", tt.path, tt.nil, ne.Path, ne.Nil, tt.in)
+		}
+	}
+}
+
+func TestInterfaceMap(t *testing.T) {
+	v := New()
+	v.Set("doc", map[interface{}]interface{}{
+		"name":  "mattn",
+		"Title": "engineer",
+		1:       "one",
+		"tags":  []interface{}{"go"},
+		"owner": map[interface{}]interface{}{"name": "a"},
+	})
+	v.Set("json", map[string]interface{}{"user_name": "mattn", "id": 1})
+	tests := []struct {
+		in     string
+		expect interface{}
+	}{
+		{`doc.name`, "mattn"},
+		{`doc["name"]`, "mattn"},
+		{`doc[1]`, "one"},
+		{`doc.tags[0]`, "go"},
+		{`doc.owner.name`, "a"},
+		{`doc.Name`, "mattn"},
+		{`doc.title`, "engineer"},
+		{`json.User_Name`, "mattn"},
+		{`json.ID`, 1},
+	}
+	for _, tt := range tests {
+		expr, err := v.Compile(tt.in)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		r, err := v.Eval(expr)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		if r != tt.expect {
+			t.Fatalf("Expected %v, but %v: %v", tt.expect, r, tt.in)
+		}
+	}
+	expr, err := v.Compile(`doc[2]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Eval(expr); err == nil {
+		t.Fatal("Expected to error, but not")
+	}
+}
+
+type fieldTagTest struct {
+	UserName string `json:"user_name"`
+	Email    string `slim:"mail" json:"email"`
+	Secret   string `json:"-"`
+	hidden   string
+	fieldTagEmbedded
+}
+
+type fieldTagEmbedded struct {
+	Role string `json:"role"`
+}
+
+func TestFieldTags(t *testing.T) {
+	v := New()
+	v.Set("user", &fieldTagTest{
+		UserName:         "mattn",
+		Email:            "mattn@example.com",
+		Secret:           "secret",
+		hidden:           "hidden",
+		fieldTagEmbedded: fieldTagEmbedded{Role: "admin"},
+	})
+	eval := func(s string) (interface{}, error) {
+		expr, err := v.Compile(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.Eval(expr)
+	}
+	tests := []struct {
+		in     string
+		expect interface{}
+	}{
+		{`user.UserName`, "mattn"},
+		{`user.user_name`, "mattn"},
+		{`user["user_name"]`, "mattn"},
+		{`user.mail`, "mattn@example.com"},
+		{`user.email`, "mattn@example.com"},
+		{`user.Secret`, "secret"},
+		{`user.role`, "admin"},
+	}
+	for _, tt := range tests {
+		r, err := eval(tt.in)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		if r != tt.expect {
+			t.Fatalf("Expected %v, but %v: %v", tt.expect, r, tt.in)
+		}
+	}
+	for _, tt := range []string{`user.hidden`, `user["-"]`} {
+		if _, err := eval(tt); err == nil {
+			t.Fatalf("%s: expected error but not", tt)
+		}
+	}
+
+	v.SetFieldTags("slim")
+	if _, err := eval(`user.user_name`); err == nil {
+		t.Fatal("user.user_name: expected error but not")
+	}
+	if r, err := eval(`user.mail`); err != nil || r != "mattn@example.com" {
+		t.Fatalf("user.mail: %v, %v", r, err)
+	}
+}
+
+type getterTest struct {
+	first, last string
+}
+
+func (g getterTest) Name() string { return g.first + " " + g.last }
+
+func (g *getterTest) GetFirst() string { return g.first }
+
+func (g getterTest) GetAge(ctx context.Context) (int, error) { return 42, nil }
+
+func (g getterTest) GetPair() (int, int) { return 1, 2 }
+
+func (g *getterTest) Delete() error {
+	g.first = ""
+	return nil
+}
+
+func (g getterTest) Greet(name string) string { return "hi " + name }
+
+func (g getterTest) Touch() {}
+
+func TestGetterFallback(t *testing.T) {
+	v := New()
+	user := &getterTest{first: "Yasuhiro", last: "Matsumoto"}
+	v.Set("user", user)
+	v.Set("value", getterTest{first: "a", last: "b"})
+	eval := func(s string) (interface{}, error) {
+		expr, err := v.Compile(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.Eval(expr)
+	}
+	if _, err := eval(`user.first`); err == nil {
+		t.Fatal("user.first: expected error but not")
+	}
+
+	v.SetGetterFallback(true)
+	tests := []struct {
+		in     string
+		expect interface{}
+	}{
+		{`user.first`, "Yasuhiro"},
+		{`value.first`, "a"},
+		{`user.age`, 42},
+	}
+	for _, tt := range tests {
+		r, err := eval(tt.in)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		if r != tt.expect {
+			t.Fatalf("Expected %v, but %v: %v", tt.expect, r, tt.in)
+		}
+	}
+	for _, tt := range []string{`user.name`, `user.greet`, `user.touch`, `user.last`, `user.pair`, `user.delete`} {
+		if _, err := eval(tt); err == nil {
+			t.Fatalf("%s: expected error but not", tt)
+		}
+	}
+	if user.first != "Yasuhiro" {
+		t.Fatal("user.delete: Delete() should not be called")
+	}
+
+	var member *Member
+	v.SetRedactor(func(ctx context.Context, m *Member, value interface{}) (interface{}, error) {
+		member = m
+		return "***", nil
+	})
+	if r, err := eval(`user.first`); err != nil || r != "***" {
+		t.Fatalf("Expected redacted value, but %v: %v", r, err)
+	}
+	if member == nil || member.Name != "first" || member.Path != "user.first" {
+		t.Fatalf("unexpected member: %+v", member)
+	}
+	v.SetRedactor(nil)
+
+	v.SetGetterFallback(false)
+	if _, err := eval(`user.first`); err == nil {
+		t.Fatal("user.first: expected error but not")
+	}
+}
+
+type embeddedInner struct {
+	Token string
+}
+
+func (i *embeddedInner) GetPtrName() string { return "ptr " + i.Token }
+
+func (i embeddedInner) GetValName() string { return "val " + i.Token }
+
+func (i *embeddedInner) Safe() string {
+	if i == nil {
+		return "nil"
+	}
+	return i.Token
+}
+
+type embeddedBase struct {
+	ID int
+}
+
+func (b *embeddedBase) Inc() int {
+	b.ID++
+	return b.ID
+}
+
+type embeddedOuter struct {
+	*embeddedInner
+	embeddedBase
+	Name string
+}
+
+type embeddedDeep struct {
+	embeddedOuter
+}
+
+func TestEmbedded(t *testing.T) {
+	v := New()
+	outer := &embeddedOuter{embeddedInner: &embeddedInner{Token: "a"}, embeddedBase: embeddedBase{ID: 1}}
+	v.Set("o", outer)
+	v.Set("ov", *outer)
+	v.Set("n", &embeddedOuter{})
+	v.Set("d", &embeddedDeep{embeddedOuter{embeddedInner: &embeddedInner{Token: "d"}}})
+	v.Set("dn", &embeddedDeep{})
+	v.SetGetterFallback(true)
+	eval := func(s string) (interface{}, error) {
+		expr, err := v.Compile(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.Eval(expr)
+	}
+	tests := []struct {
+		in     string
+		expect interface{}
+	}{
+		{`o.Token`, "a"},
+		{`o["Token"]`, "a"},
+		{`o.ID`, 1},
+		{`o.GetPtrName()`, "ptr a"},
+		{`o.GetValName()`, "val a"},
+		{`o.valName`, "val a"},
+		{`ov.Token`, "a"},
+		{`ov.GetPtrName()`, "ptr a"},
+		{`d.Token`, "d"},
+		{`d.GetPtrName()`, "ptr d"},
+		{`d.ptrName`, "ptr d"},
+		{`n.Safe()`, "nil"},
+		{`o.Inc()`, 2},
+	}
+	for _, tt := range tests {
+		r, err := eval(tt.in)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.in, err)
+		}
+		if r != tt.expect {
+			t.Fatalf("Expected %v, but %v: %v", tt.expect, r, tt.in)
+		}
+	}
+	if outer.ID != 2 {
+		t.Fatalf("Expected the method is called on the embedded struct, but %v", outer.ID)
+	}
+
+	nils := []struct {
+		in  string
+		nil string
+	}{
+		{`n.Token`, "n.embeddedInner"},
+		{`n["Token"]`, "n.embeddedInner"},
+		{`n.GetValName()`, "n.embeddedInner"},
+		{`n.GetPtrName()`, "n.embeddedInner"},
+		{`n.valName`, "n.embeddedInner"},
+		{`dn.Token`, "dn.embeddedOuter.embeddedInner"},
+	}
+	for _, tt := range nils {
+		_, err := eval(tt.in)
+		var ne *NilReceiverError
+		if !errors.As(err, &ne) {
+			t.Fatalf("Expected NilReceiverError, but %v: %v", err, tt.in)
+		}
+		if ne.Nil != tt.nil {
+			t.Fatalf("Expected %v, but %v: %v", tt.nil, ne.Nil, tt.in)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package slim
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultWatchInterval is the interval of Watch to check the files.
+var DefaultWatchInterval = 500 * time.Millisecond
+
+// Watcher watches the directory of the templates, and reloads the changed
+// templates in the set.
+type Watcher struct {
+	set      *TemplateSet
+	dir      string
+	onReload func(name string, err error)
+	modTimes map[string]time.Time
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// Watch create the set of the templates in dir, and watch the files for the
+// development. The changed templates are parsed again and swapped in the set
+// atomically, so the renderings in progress are not affected. onReload is
+// called with the name of the template and the error of the reloading, and
+// the template is not swapped on the error. The files are checked for each
+// DefaultWatchInterval.
+func Watch(dir string, onReload func(name string, err error)) (*Watcher, error) {
+	w := &Watcher{
+		set:      NewTemplateSet(OSLoader(dir)),
+		dir:      dir,
+		onReload: onReload,
+		modTimes: map[string]time.Time{},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if _, err := w.scan(); err != nil {
+		return nil, err
+	}
+	go w.loop()
+	return w, nil
+}
+
+// Set returns the set of the templates watched.
+func (w *Watcher) Set() *TemplateSet {
+	return w.set
+}
+
+// Close stop watching.
+func (w *Watcher) Close() error {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+	return nil
+}
+
+func (w *Watcher) loop() {
+	defer close(w.done)
+	ticker := time.NewTicker(DefaultWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			changed, err := w.scan()
+			if err != nil {
+				w.report("", err)
+				continue
+			}
+			w.reload(changed)
+		}
+	}
+}
+
+// scan returns the names of the templates which are changed or removed since
+// the last scan.
+func (w *Watcher) scan() ([]string, error) {
+	seen := map[string]bool{}
+	var changed []string
+	err := filepath.WalkDir(w.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, ".slim") {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(w.dir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		seen[name] = true
+		if old, ok := w.modTimes[name]; !ok || !old.Equal(fi.ModTime()) {
+			w.modTimes[name] = fi.ModTime()
+			if ok {
+				changed = append(changed, name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for name := range w.modTimes {
+		if !seen[name] {
+			delete(w.modTimes, name)
+			changed = append(changed, name)
+		}
+	}
+	return changed, nil
+}
+
+// reload reload the changed templates. The removed templates are removed from
+// the set.
+func (w *Watcher) reload(changed []string) {
+	for _, name := range changed {
+		if _, ok := w.modTimes[name]; !ok {
+			w.set.cache.Invalidate(name)
+			w.report(name, nil)
+			continue
+		}
+		w.report(name, w.set.cache.reload(name))
+	}
+}
+
+func (w *Watcher) report(name string, err error) {
+	if w.onReload != nil {
+		w.onReload(name, err)
+	}
+}
@@ -0,0 +1,70 @@
+package slim
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "index.slim")
+	if err := os.WriteFile(file, []byte("p old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := make(chan error, 10)
+	w, err := Watch(dir, func(name string, err error) {
+		if name == "index.slim" {
+			reloaded <- err
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	render := func() string {
+		var buf bytes.Buffer
+		if err := w.Set().Render(&buf, "index", nil); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	if got := render(); got != "<p>old</p>\n" {
+		t.Fatalf("expected old but %q", got)
+	}
+
+	update := func(src string, d time.Duration) error {
+		if err := os.WriteFile(file, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mt := time.Now().Add(d)
+		if err := os.Chtimes(file, mt, mt); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-reloaded:
+			return err
+		case <-time.After(10 * DefaultWatchInterval):
+			t.Fatal("timeout")
+		}
+		return nil
+	}
+
+	if err := update("p new", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if got := render(); got != "<p>new</p>\n" {
+		t.Fatalf("expected new but %q", got)
+	}
+
+	if err := update("p = (1 +", 2*time.Second); err == nil {
+		t.Fatal("expected syntax error but not")
+	}
+	if got := render(); got != "<p>new</p>\n" {
+		t.Fatalf("expected the previous template but %q", got)
+	}
+}
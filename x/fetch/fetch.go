@@ -0,0 +1,71 @@
+// Package fetch provides experimental "fetch" directive which bind the data
+// fetched from the data sources like GraphQL or REST API. For example,
+// `- fetch products = query("{ products { name } }")` call the data source
+// registered as "query" and bind the result to products.
+//
+// The API of this package may change.
+package fetch
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mattn/go-slim"
+	"github.com/mattn/go-slim/vm"
+)
+
+// DataSource is the interface for fetching data with the query.
+type DataSource interface {
+	Query(ctx context.Context, query string, args ...interface{}) (interface{}, error)
+}
+
+// DataSourceFunc is an adapter to allow the use of ordinary functions as
+// DataSource.
+type DataSourceFunc func(ctx context.Context, query string, args ...interface{}) (interface{}, error)
+
+// Query calls f(ctx, query, args...).
+func (f DataSourceFunc) Query(ctx context.Context, query string, args ...interface{}) (interface{}, error) {
+	return f(ctx, query, args...)
+}
+
+// Sources is a map of function names used in fetch directive to the data
+// sources.
+type Sources map[string]DataSource
+
+// Register register fetch directive to t. In the directive, the right hand
+// side must be a call of the function named in sources. The first argument
+// is the query, and rest are passed as args.
+func Register(t *slim.Template, sources Sources) {
+	t.RegisterDirective("fetch", func(v *vm.VM, d *vm.DirectiveExpr) error {
+		call, ok := d.RHS.(*vm.CallExpr)
+		if !ok {
+			return errors.New("fetch require call of data source")
+		}
+		ds, ok := sources[call.Name]
+		if !ok {
+			return errors.New("unknown data source: " + call.Name)
+		}
+		if len(call.Exprs) == 0 {
+			return errors.New(call.Name + " require query")
+		}
+		ctx := v.Context()
+		args := []interface{}{}
+		for _, expr := range call.Exprs {
+			arg, err := v.EvalContext(ctx, expr)
+			if err != nil {
+				return err
+			}
+			args = append(args, arg)
+		}
+		query, ok := args[0].(string)
+		if !ok {
+			return errors.New(call.Name + " require query as string")
+		}
+		r, err := ds.Query(ctx, query, args[1:]...)
+		if err != nil {
+			return err
+		}
+		v.Set(d.LHS, r)
+		return nil
+	})
+}
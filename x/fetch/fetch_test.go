@@ -0,0 +1,57 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mattn/go-slim"
+)
+
+func TestFetch(t *testing.T) {
+	tmpl, err := slim.Parse(strings.NewReader(`
+- fetch products = query("products", limit)
+ul
+  - for p in products
+    li = p
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	Register(tmpl, Sources{
+		"query": DataSourceFunc(func(ctx context.Context, query string, args ...interface{}) (interface{}, error) {
+			var r []string
+			for i := int64(0); i < args[0].(int64); i++ {
+				r = append(r, fmt.Sprintf("%s%d", query, i))
+			}
+			return r, nil
+		}),
+	})
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, slim.Values{
+		"limit": int64(2),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<ul>\n  <li>products0</li>\n  <li>products1</li>\n</ul>\n"
+	got := buf.String()
+	if expect != got {
+		t.Fatalf("expected %v but %v", expect, got)
+	}
+}
+
+func TestUnknownSource(t *testing.T) {
+	tmpl, err := slim.Parse(strings.NewReader(`- fetch products = rest("/products")`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	Register(tmpl, Sources{})
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, nil)
+	if err == nil {
+		t.Fatal("should be fail")
+	}
+}